@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/service"
+)
+
+const createAdminUsage = "usage: finsys create-admin username [email]"
+
+// runCreateAdmin implements "finsys create-admin username", which makes an
+// existing user an administrator, and "finsys create-admin username email",
+// which creates one. The new user's password is read from
+// FINSYS_ADMIN_PASSWORD, or from the first line of standard input.
+func runCreateAdmin(dbConfig *config.DatabaseConfig, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(createAdminUsage)
+	}
+	// Lookups of the new username and email are expected to miss, so keep
+	// GORM from logging them.
+	quiet := *dbConfig
+	quiet.LogLevel = "silent"
+	if config.InitDB(&quiet) == nil {
+		return errors.New("cannot connect to database")
+	}
+	users := service.NewUserService()
+	var user *service.UserResponse
+	var err error
+	if len(args) == 1 {
+		user, err = users.PromoteAdmin(args[0])
+	} else {
+		var password string
+		password, err = readAdminPassword()
+		if err != nil {
+			return err
+		}
+		user, err = users.CreateAdmin(&service.RegisterRequest{Username: args[0], Password: password, Email: args[1]})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (id %d) is an administrator\n", user.Username, user.ID)
+	return nil
+}
+
+func readAdminPassword() (string, error) {
+	if password := os.Getenv("FINSYS_ADMIN_PASSWORD"); password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("cannot read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func createAdminCommand(dbConfig *config.DatabaseConfig, args []string) {
+	if err := runCreateAdmin(dbConfig, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
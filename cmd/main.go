@@ -1,42 +1,90 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/middleware"
+	"github.com/Mitsui515/finsys/repository"
 	"github.com/Mitsui515/finsys/router"
+	"github.com/Mitsui515/finsys/service"
+	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/network/standard"
 	"github.com/hertz-contrib/cors"
 )
 
 func main() {
-	appConfig := config.DefaultConfig()
-	db := config.InitDB()
+	appConfig, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		migrateCommand(&appConfig.Database, args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "create-admin" {
+		createAdminCommand(&appConfig.Database, args[1:])
+		return
+	}
+	if err := middleware.InitSigningKeys(&appConfig.JWT); err != nil {
+		log.Fatalf("Fail to load signing keys: %v", err)
+	}
+	db := config.InitDB(&appConfig.Database)
 	if db == nil {
 		log.Fatal("Fail to initial database")
 	}
-	// mongodb := config.InitMongoDB()
-	// if mongodb == nil {
-	// 	log.Fatal("Fail to initial mongodb")
-	// }
+	importService := service.NewImportService(db)
+	if err := importService.RecoverInterrupted(); err != nil {
+		log.Printf("Fail to recover interrupted import jobs: %v", err)
+	}
+	importService.StartSpoolSweeper()
+	if appConfig.Report.Storage == config.ReportStorageMongo {
+		mongodb := config.InitMongoDB(&appConfig.Mongo)
+		if mongodb == nil {
+			log.Fatal("Fail to initial mongodb")
+		}
+		if err := repository.EnsureMongoReportIndexes(mongodb); err != nil {
+			log.Fatalf("Fail to create mongodb indexes: %v", err)
+		}
+	}
 	hostPort := fmt.Sprintf("%s:%d", appConfig.Server.Host, appConfig.Server.Port)
 	h := server.New(
 		server.WithHostPorts(hostPort),
-		server.WithMaxRequestBodySize(1024*1024*1024),
+		server.WithMaxRequestBodySize(int(appConfig.Import.MaxUploadBytes)),
+		// Request bodies are streamed to the handlers so that uploads can be
+		// spooled to disk as they arrive instead of being buffered in memory.
+		server.WithStreamBody(true),
+		server.WithDisablePreParseMultipartForm(true),
 		server.WithTransport(standard.NewTransporter),
 	)
+	trustedProxies, err := appConfig.Server.TrustedProxyNets()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Hertz trusts forwarding headers from any peer by default, which would let
+	// clients pick the IP that login throttling and the audit log see.
+	h.SetClientIPFunc(app.ClientIPWithOption(app.ClientIPOptions{
+		RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		TrustedCIDRs:    trustedProxies,
+	}))
 	h.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	h.Use(middleware.RequestID())
 	h.Use(middleware.Logger())
 	router.RegisterRoutes(h)
 	h.Spin()
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/migration"
+)
+
+const migrateUsage = "usage: finsys migrate up|down [steps]|status"
+
+// runMigrate implements "finsys migrate up", "finsys migrate down [steps]",
+// which reverts one migration unless told otherwise, and "finsys migrate
+// status".
+func runMigrate(dbConfig *config.DatabaseConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	// Keep the output to the migration results rather than every statement.
+	quiet := *dbConfig
+	quiet.LogLevel = "warn"
+	db, err := config.OpenDB(&quiet)
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	switch args[0] {
+	case "up":
+		ran, err := migration.Up(db)
+		for _, m := range ran {
+			fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migration.Down(db, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case "status":
+		statuses, err := migration.Statuses(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+func migrateCommand(dbConfig *config.DatabaseConfig, args []string) {
+	if err := runMigrate(dbConfig, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -1,16 +1,66 @@
 package config
 
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+)
+
 type AppConfig struct {
-	Server ServerConfig `json:"server"`
-	Log    LogConfig    `json:"log"`
-	LLM    LLMConfig    `json:"llm"`
+	Server    ServerConfig    `json:"server"`
+	Database  DatabaseConfig  `json:"database"`
+	Mongo     MongoDBConfig   `json:"mongo"`
+	Report    ReportConfig    `json:"report"`
+	Log       LogConfig       `json:"log"`
+	JWT       JWTConfig       `json:"jwt"`
+	OIDC      OIDCConfig      `json:"oidc"`
+	Login     LoginConfig     `json:"login"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Mail      MailConfig      `json:"mail"`
+	LLM       LLMConfig       `json:"llm"`
+	Redaction RedactionConfig `json:"redaction"`
+	Thrift    ThriftConfig    `json:"thrift"`
+	Import    ImportConfig    `json:"import"`
 }
 
+// ServerConfig sets where the API listens. TrustedProxies lists the IPs or
+// CIDRs of reverse proxies whose X-Forwarded-For and X-Real-IP headers are
+// believed; when it is empty the client IP is the remote address.
 type ServerConfig struct {
-	Port    int    `json:"port"`
-	Host    string `json:"host"`
-	Mode    string `json:"mode"`
-	Version string `json:"version"`
+	Port           int      `json:"port"`
+	Host           string   `json:"host"`
+	Mode           string   `json:"mode"`
+	Version        string   `json:"version"`
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// TrustedProxyNets parses TrustedProxies, taking a bare IP as a single
+// address.
+func (c *ServerConfig) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
 }
 
 type LogConfig struct {
@@ -22,8 +72,156 @@ type LogConfig struct {
 	Compress   bool   `json:"compress"`
 }
 
+// ImportConfig controls transaction imports. Uploads are streamed into
+// SpoolDir; the spooled files of failed and cancelled jobs are kept for
+// SpoolRetention so the jobs can be resumed, then deleted.
+type ImportConfig struct {
+	SpoolDir       string        `json:"spool_dir"`
+	MaxConcurrent  int           `json:"max_concurrent"`
+	MaxUploadBytes int64         `json:"max_upload_bytes"`
+	SpoolRetention time.Duration `json:"spool_retention"`
+}
+
+const (
+	ReportStorageSQL   = "sql"
+	ReportStorageMongo = "mongo"
+)
+
+// ReportConfig selects where fraud report bodies are kept: in the SQL
+// fraud_reports table, or in MongoDB with one document per version.
+type ReportConfig struct {
+	Storage string `json:"storage"`
+}
+
+// DefaultJWTSecret is only good for development; Validate rejects it in
+// release mode.
+const DefaultJWTSecret = "HKU_Project"
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// JWTConfig selects how access tokens are signed. HS256 uses Secret, which
+// every verifier must share. RS256 and EdDSA sign with private keys kept in
+// KeyDir, replaced every RotationInterval and published as a JWKS.
+type JWTConfig struct {
+	Algorithm        string        `json:"algorithm"`
+	Secret           string        `json:"secret"`
+	KeyDir           string        `json:"key_dir"`
+	RotationInterval time.Duration `json:"rotation_interval"`
+	Issuer           string        `json:"issuer"`
+	Audience         string        `json:"audience"`
+	AccessTokenTTL   time.Duration `json:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `json:"refresh_token_ttl"`
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider. A
+// first login links the identity to the user with the same email when both
+// the provider and finsys have verified it, or creates a user with
+// DefaultRole when AutoProvision is on. RequireVerifiedEmail refuses to
+// create users from emails the provider has not verified. Tokens are
+// handed to FrontendRedirectURL in the fragment when it is set, and returned
+// as JSON otherwise.
+type OIDCConfig struct {
+	Enabled              bool     `json:"enabled"`
+	Issuer               string   `json:"issuer"`
+	ClientID             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret"`
+	RedirectURL          string   `json:"redirect_url"`
+	FrontendRedirectURL  string   `json:"frontend_redirect_url"`
+	Scopes               []string `json:"scopes"`
+	RequireVerifiedEmail bool     `json:"require_verified_email"`
+	AutoProvision        bool     `json:"auto_provision"`
+	DefaultRole          string   `json:"default_role"`
+}
+
+// LoginConfig limits password guessing. Failures count per username and per
+// client IP, and are forgotten after FailureWindow without one. From the
+// DelayAfter-th failure a username has to wait before trying again, doubling
+// from one second up to MaxDelay; at MaxFailures it is locked for
+// LockoutDuration. An IP is locked at IPMaxFailures, set higher since many
+// users can share one address.
+type LoginConfig struct {
+	MaxFailures     int           `json:"max_failures"`
+	IPMaxFailures   int           `json:"ip_max_failures"`
+	FailureWindow   time.Duration `json:"failure_window"`
+	LockoutDuration time.Duration `json:"lockout_duration"`
+	DelayAfter      int           `json:"delay_after"`
+	MaxDelay        time.Duration `json:"max_delay"`
+}
+
+// RateLimitConfig limits authenticated requests per user, or per API key,
+// with a token bucket for each route group: Default covers every group, and
+// Chat and Import add stricter limits on the routes that cost the most.
+type RateLimitConfig struct {
+	Enabled bool  `json:"enabled"`
+	Default Limit `json:"default"`
+	Chat    Limit `json:"chat"`
+	Import  Limit `json:"import"`
+}
+
+// Limit refills RequestsPerMinute and allows up to Burst requests at
+// once. A RequestsPerMinute of zero turns the limit off.
+type Limit struct {
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	Burst             int     `json:"burst"`
+}
+
+// MailConfig sends account emails, for email verification and password
+// resets, through an SMTP server. Without SMTPHost they are written to the
+// log instead, for development. Links in them point at LinkBaseURL, the
+// frontend. RequireVerifiedEmail refuses password logins until the user has
+// followed the verification link.
+type MailConfig struct {
+	SMTPHost             string `json:"smtp_host"`
+	SMTPPort             int    `json:"smtp_port"`
+	Username             string `json:"username"`
+	Password             string `json:"password"`
+	From                 string `json:"from"`
+	LinkBaseURL          string `json:"link_base_url"`
+	RequireVerifiedEmail bool   `json:"require_verified_email"`
+}
+
+// LLMConfig reaches the chat model. Usage is costed at the prices per
+// thousand prompt and completion tokens. Users get DailyTokenBudget and
+// MonthlyTokenBudget unless an administrator sets a budget for them or their
+// role; zero means no limit. Replies are capped at MaxCompletionTokens, which
+// is also what a request reserves against the budget for its reply.
 type LLMConfig struct {
-	APIKey string `json:"api_key"`
+	APIKey               string  `json:"api_key"`
+	BaseURL              string  `json:"base_url"`
+	MaxCompletionTokens  int64   `json:"max_completion_tokens"`
+	PromptPricePer1K     float64 `json:"prompt_price_per_1k"`
+	CompletionPricePer1K float64 `json:"completion_price_per_1k"`
+	DailyTokenBudget     int64   `json:"daily_token_budget"`
+	MonthlyTokenBudget   int64   `json:"monthly_token_budget"`
+}
+
+// RedactionConfig replaces personal and financial details in chat prompts
+// with placeholders before they reach the LLM provider, and puts them back in
+// the reply. Account names are found by AccountPattern. Amounts are replaced
+// when they have more than AmountSignificantDigits significant digits, with
+// the placeholder carrying the amount rounded to that many.
+type RedactionConfig struct {
+	Enabled                 bool   `json:"enabled"`
+	AccountPattern          string `json:"account_pattern"`
+	AmountSignificantDigits int    `json:"amount_significant_digits"`
+}
+
+// ThriftConfig locates the fraud prediction service.
+type ThriftConfig struct {
+	Address string        `json:"address"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+var current = DefaultConfig()
+
+// Current returns the configuration loaded by Load, or the defaults before
+// Load has run.
+func Current() AppConfig {
+	return current
 }
 
 func DefaultConfig() AppConfig {
@@ -34,6 +232,11 @@ func DefaultConfig() AppConfig {
 			Mode:    "debug",
 			Version: "v1",
 		},
+		Database: *DefaultDBConfig(),
+		Mongo:    *DefaultMongoDBConfig(),
+		Report: ReportConfig{
+			Storage: ReportStorageSQL,
+		},
 		Log: LogConfig{
 			Level:      "info",
 			FilePath:   "./logs/app.log",
@@ -42,8 +245,62 @@ func DefaultConfig() AppConfig {
 			MaxAge:     30,
 			Compress:   true,
 		},
+		JWT: JWTConfig{
+			Algorithm:        JWTAlgorithmRS256,
+			Secret:           DefaultJWTSecret,
+			KeyDir:           "./data/keys",
+			RotationInterval: 30 * 24 * time.Hour,
+			Issuer:           "finsys",
+			Audience:         "user",
+			AccessTokenTTL:   15 * time.Minute,
+			RefreshTokenTTL:  30 * 24 * time.Hour,
+		},
+		OIDC: OIDCConfig{
+			Scopes:               []string{"openid", "email", "profile"},
+			RequireVerifiedEmail: true,
+			AutoProvision:        true,
+			DefaultRole:          model.RoleViewer,
+		},
+		Login: LoginConfig{
+			MaxFailures:     10,
+			IPMaxFailures:   100,
+			FailureWindow:   15 * time.Minute,
+			LockoutDuration: 15 * time.Minute,
+			DelayAfter:      3,
+			MaxDelay:        30 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Default: Limit{RequestsPerMinute: 600, Burst: 100},
+			Chat:    Limit{RequestsPerMinute: 10, Burst: 5},
+			Import:  Limit{RequestsPerMinute: 6, Burst: 3},
+		},
+		Mail: MailConfig{
+			SMTPPort:             587,
+			From:                 "no-reply@finsys.local",
+			LinkBaseURL:          "http://localhost:8080",
+			RequireVerifiedEmail: true,
+		},
 		LLM: LLMConfig{
-			APIKey: "sk-0709296703ab41f280007b5f45b8f9a0",
+			BaseURL:              "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions",
+			MaxCompletionTokens:  2048,
+			PromptPricePer1K:     0.0003,
+			CompletionPricePer1K: 0.0006,
+		},
+		Redaction: RedactionConfig{
+			Enabled:                 true,
+			AccountPattern:          `\b[CM]\d{5,}\b`,
+			AmountSignificantDigits: 2,
+		},
+		Thrift: ThriftConfig{
+			Address: "localhost:9090",
+			Timeout: 5 * time.Second,
+		},
+		Import: ImportConfig{
+			SpoolDir:       "./data/imports",
+			MaxConcurrent:  2,
+			MaxUploadBytes: 1 << 30,
+			SpoolRetention: 7 * 24 * time.Hour,
 		},
 	}
 }
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
-	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/migration"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -11,15 +16,64 @@ import (
 
 var DB *gorm.DB
 
+// DatabaseConfig selects the database driver. Type is sqlite, postgres or
+// mysql. DSN is passed to the driver as is; for sqlite it falls back to Path,
+// opened so that transactions take the write lock when they begin. A
+// transaction that reads and then writes would otherwise fail with "database
+// is locked" when another connection writes first, instead of waiting.
+// MySQL DSNs need parseTime=true so that timestamps scan into time.Time.
 type DatabaseConfig struct {
-	Type     string `json:"type"`
-	Path     string `json:"path"`
-	LogLevel string `json:"log_level"`
+	Type            string        `json:"type"`
+	DSN             string        `json:"dsn"`
+	Path            string        `json:"path"`
+	LogLevel        string        `json:"log_level"`
+	MaxOpenConns    int           `json:"max_open_conns"`
+	MaxIdleConns    int           `json:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `json:"conn_max_idle_time"`
+	MigrateOnStart  bool          `json:"migrate_on_start"`
 }
 
-func InitDB() *gorm.DB {
-	dbConfig := DefaultDBConfig()
+// InitDB connects to the configured database and brings its schema up to
+// date, or refuses to start when migrations are pending and MigrateOnStart is
+// off.
+func InitDB(dbConfig *DatabaseConfig) *gorm.DB {
 	var err error
+	DB, err = OpenDB(dbConfig)
+	if err != nil {
+		log.Fatalf("cannot connect to database: %v", err)
+	}
+	if dbConfig.MigrateOnStart {
+		ran, err := migration.Up(DB)
+		if err != nil {
+			log.Fatalf("fail to migrate database: %v", err)
+			return nil
+		}
+		for _, m := range ran {
+			log.Printf("applied migration %d %s", m.Version, m.Name)
+		}
+	} else {
+		pending, err := migration.Pending(DB)
+		if err != nil {
+			log.Fatalf("fail to read migration status: %v", err)
+			return nil
+		}
+		if len(pending) > 0 {
+			log.Fatalf("database has %d pending migrations, run finsys migrate up", len(pending))
+			return nil
+		}
+	}
+	log.Printf("successfully init %s database", dbConfig.Type)
+	return DB
+}
+
+// OpenDB connects to the configured database and applies the pool limits,
+// without touching the schema.
+func OpenDB(dbConfig *DatabaseConfig) (*gorm.DB, error) {
+	dialector, err := dbConfig.Dialector()
+	if err != nil {
+		return nil, err
+	}
 	logLevel := logger.Info
 	switch dbConfig.LogLevel {
 	case "silent":
@@ -29,25 +83,65 @@ func InitDB() *gorm.DB {
 	case "warn":
 		logLevel = logger.Warn
 	}
-	DB, err = gorm.Open(sqlite.Open(dbConfig.Path), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logLevel),
 	})
 	if err != nil {
-		log.Fatalf("cannot connect to database: %v", err)
+		return nil, err
 	}
-	err = DB.AutoMigrate(&model.Transaction{}, &model.User{}, &model.FraudReport{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("fail to automatically migrate: %v", err)
-		return nil
+		return nil, err
 	}
-	log.Println("successfully init database")
-	return DB
+	if dbConfig.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	}
+	if dbConfig.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	}
+	if dbConfig.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+	}
+	if dbConfig.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime)
+	}
+	return db, nil
+}
+
+// Dialector returns the GORM dialector for the configured driver.
+func (c *DatabaseConfig) Dialector() (gorm.Dialector, error) {
+	switch c.Type {
+	case "", "sqlite":
+		dsn := c.DSN
+		if dsn == "" && c.Path != "" {
+			dsn = c.Path
+			if !strings.Contains(dsn, "?") {
+				dsn += "?_txlock=immediate"
+			}
+		}
+		return sqlite.Open(dsn), nil
+	case "postgres":
+		if c.DSN == "" {
+			return nil, fmt.Errorf("database dsn is required for %s", c.Type)
+		}
+		return postgres.Open(c.DSN), nil
+	case "mysql":
+		if c.DSN == "" {
+			return nil, fmt.Errorf("database dsn is required for %s", c.Type)
+		}
+		return mysql.Open(c.DSN), nil
+	}
+	return nil, fmt.Errorf("unsupported database type %q, expected sqlite, postgres or mysql", c.Type)
 }
 
 func DefaultDBConfig() *DatabaseConfig {
 	return &DatabaseConfig{
-		Type:     "sqlite",
-		Path:     "./finsys.db",
-		LogLevel: "info",
+		Type:            "sqlite",
+		Path:            "./finsys.db",
+		LogLevel:        "info",
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+		MigrateOnStart:  true,
 	}
 }
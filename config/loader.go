@@ -0,0 +1,235 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts every environment variable Load reads. A setting's
+// variable is the prefix plus its key in upper case with dots replaced by
+// underscores, so database.dsn is FINSYS_DATABASE_DSN.
+const EnvPrefix = "FINSYS_"
+
+// Load builds the configuration from the defaults, then the config file, then
+// environment variables, then command-line flags, each overriding the one
+// before. The file is named by -config or FINSYS_CONFIG and may be YAML or
+// JSON; every other setting has a flag named after its key, such as
+// -database.dsn. Load validates the result, makes it the one Current returns,
+// and hands back the arguments left after the flags.
+func Load(args []string) (AppConfig, []string, error) {
+	appConfig := DefaultConfig()
+	settings := configSettings(&appConfig)
+
+	flags := flag.NewFlagSet("finsys", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path of a YAML or JSON config file")
+	overrides := make(map[string]*settingFlag, len(settings))
+	for _, key := range sortedKeys(settings) {
+		overrides[key] = &settingFlag{isBool: settings[key].Kind() == reflect.Bool}
+		flags.Var(overrides[key], key, "overrides "+key+", also "+envName(key))
+	}
+	if err := flags.Parse(args); err != nil {
+		return appConfig, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, settings); err != nil {
+			return appConfig, nil, err
+		}
+	}
+	for _, key := range sortedKeys(settings) {
+		if value, ok := os.LookupEnv(envName(key)); ok {
+			if err := setString(settings[key], value); err != nil {
+				return appConfig, nil, fmt.Errorf("%s: %w", envName(key), err)
+			}
+		}
+	}
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		override, ok := overrides[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := setString(settings[f.Name], override.value); setErr != nil {
+			err = fmt.Errorf("-%s: %w", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return appConfig, nil, err
+	}
+
+	if err := appConfig.Validate(); err != nil {
+		return appConfig, nil, err
+	}
+	current = appConfig
+	return appConfig, flags.Args(), nil
+}
+
+// settingFlag holds a flag's raw value until the file and environment have
+// been applied.
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configSettings maps each setting's dotted key, built from the json tags,
+// to the field it sets.
+func configSettings(appConfig *AppConfig) map[string]reflect.Value {
+	settings := make(map[string]reflect.Value)
+	collectSettings(reflect.ValueOf(appConfig).Elem(), "", settings)
+	return settings
+}
+
+func collectSettings(v reflect.Value, prefix string, settings map[string]reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			collectSettings(field, prefix+name+".", settings)
+			continue
+		}
+		settings[prefix+name] = field
+	}
+}
+
+func sortedKeys(settings map[string]reflect.Value) []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadFile applies the settings in a YAML or JSON file. Unknown keys are an
+// error so that a misspelt setting does not silently keep its default.
+func loadFile(path string, settings map[string]reflect.Value) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+	return applyFileValues(values, "", settings)
+}
+
+func applyFileValues(values map[string]interface{}, prefix string, settings map[string]reflect.Value) error {
+	for name, value := range values {
+		key := prefix + name
+		if value == nil {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := applyFileValues(nested, key+".", settings); err != nil {
+				return err
+			}
+			continue
+		}
+		field, ok := settings[key]
+		if !ok {
+			return fmt.Errorf("unknown config setting %q", key)
+		}
+		if list, ok := value.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			value = strings.Join(items, ",")
+		}
+		if err := setString(field, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setString parses value into field. Durations take Go syntax such as "10s"
+// and lists are comma-separated.
+func setString(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported setting type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
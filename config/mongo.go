@@ -12,9 +12,9 @@ import (
 var MongoDB *mongo.Database
 
 type MongoDBConfig struct {
-	URI      string
-	Database string
-	Timeout  time.Duration
+	URI      string        `json:"uri"`
+	Database string        `json:"database"`
+	Timeout  time.Duration `json:"timeout"`
 }
 
 func DefaultMongoDBConfig() *MongoDBConfig {
@@ -25,8 +25,7 @@ func DefaultMongoDBConfig() *MongoDBConfig {
 	}
 }
 
-func InitMongoDB() *mongo.Database {
-	mongoConfig := DefaultMongoDBConfig()
+func InitMongoDB(mongoConfig *MongoDBConfig) *mongo.Database {
 	ctx, cancel := context.WithTimeout(context.Background(), mongoConfig.Timeout)
 	defer cancel()
 
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/Mitsui515/finsys/model"
+)
+
+const (
+	ModeDebug   = "debug"
+	ModeTest    = "test"
+	ModeRelease = "release"
+)
+
+// minReleaseSecretLength is the shortest JWT secret accepted in release mode,
+// 256 bits for HS256.
+const minReleaseSecretLength = 32
+
+// Validate reports every problem with the configuration at once. In release
+// mode it also refuses development secrets.
+func (c *AppConfig) Validate() error {
+	var errs []error
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d is out of range", c.Server.Port))
+	}
+	switch c.Server.Mode {
+	case ModeDebug, ModeTest, ModeRelease:
+	default:
+		errs = append(errs, fmt.Errorf("server.mode must be %s, %s or %s", ModeDebug, ModeTest, ModeRelease))
+	}
+	if _, err := c.Server.TrustedProxyNets(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.Database.Dialector(); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Report.Storage {
+	case ReportStorageSQL:
+	case ReportStorageMongo:
+		if c.Mongo.URI == "" || c.Mongo.Database == "" {
+			errs = append(errs, errors.New("mongo.uri and mongo.database are required for mongo report storage"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("report.storage must be %s or %s", ReportStorageSQL, ReportStorageMongo))
+	}
+	switch c.JWT.Algorithm {
+	case JWTAlgorithmHS256:
+		if c.JWT.Secret == "" {
+			errs = append(errs, errors.New("jwt.secret is required for HS256"))
+		}
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+		if c.JWT.KeyDir == "" {
+			errs = append(errs, fmt.Errorf("jwt.key_dir is required for %s", c.JWT.Algorithm))
+		}
+		if c.JWT.RotationInterval <= c.JWT.AccessTokenTTL {
+			errs = append(errs, errors.New("jwt.rotation_interval must be longer than jwt.access_token_ttl"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jwt.algorithm must be %s, %s or %s", JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmEdDSA))
+	}
+	if c.JWT.AccessTokenTTL <= 0 || c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		errs = append(errs, errors.New("jwt.access_token_ttl must be positive and shorter than jwt.refresh_token_ttl"))
+	}
+	if c.OIDC.Enabled {
+		if c.OIDC.Issuer == "" || c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			errs = append(errs, errors.New("oidc.issuer, oidc.client_id and oidc.redirect_url are required when oidc is enabled"))
+		}
+		if !model.ValidRole(c.OIDC.DefaultRole) {
+			errs = append(errs, fmt.Errorf("oidc.default_role %q is not a role", c.OIDC.DefaultRole))
+		}
+	}
+	if c.Login.MaxFailures <= 0 || c.Login.IPMaxFailures <= 0 {
+		errs = append(errs, errors.New("login.max_failures and login.ip_max_failures must be at least 1"))
+	}
+	if c.Login.FailureWindow <= 0 || c.Login.LockoutDuration <= 0 || c.Login.MaxDelay < 0 || c.Login.DelayAfter < 0 {
+		errs = append(errs, errors.New("login.failure_window and login.lockout_duration must be positive, login.max_delay and login.delay_after not negative"))
+	}
+	errs = append(errs,
+		c.RateLimit.Default.validate("rate_limit.default"),
+		c.RateLimit.Chat.validate("rate_limit.chat"),
+		c.RateLimit.Import.validate("rate_limit.import"),
+	)
+	if c.LLM.MaxCompletionTokens <= 0 {
+		errs = append(errs, errors.New("llm.max_completion_tokens must be positive"))
+	}
+	if c.LLM.PromptPricePer1K < 0 || c.LLM.CompletionPricePer1K < 0 || c.LLM.DailyTokenBudget < 0 || c.LLM.MonthlyTokenBudget < 0 {
+		errs = append(errs, errors.New("llm prices and token budgets must not be negative"))
+	}
+	if c.Redaction.Enabled {
+		if _, err := regexp.Compile(c.Redaction.AccountPattern); err != nil {
+			errs = append(errs, fmt.Errorf("redaction.account_pattern: %w", err))
+		}
+		if c.Redaction.AmountSignificantDigits < 1 {
+			errs = append(errs, errors.New("redaction.amount_significant_digits must be at least 1"))
+		}
+	}
+	if c.Mail.SMTPHost != "" && (c.Mail.SMTPPort <= 0 || c.Mail.SMTPPort > 65535 || c.Mail.From == "") {
+		errs = append(errs, errors.New("mail.smtp_port must be a valid port and mail.from is required with mail.smtp_host"))
+	}
+	if c.Mail.LinkBaseURL == "" {
+		errs = append(errs, errors.New("mail.link_base_url is required"))
+	}
+	if c.Thrift.Address == "" {
+		errs = append(errs, errors.New("thrift.address is required"))
+	}
+	if c.Import.MaxConcurrent <= 0 {
+		errs = append(errs, errors.New("import.max_concurrent must be at least 1"))
+	}
+	if c.Import.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("import.max_upload_bytes must be positive"))
+	}
+	if c.Import.SpoolRetention <= 0 {
+		errs = append(errs, errors.New("import.spool_retention must be positive"))
+	}
+	if c.Server.Mode == ModeRelease {
+		if c.JWT.Algorithm == JWTAlgorithmHS256 && (c.JWT.Secret == DefaultJWTSecret || len(c.JWT.Secret) < minReleaseSecretLength) {
+			errs = append(errs, fmt.Errorf("jwt.secret must be set to a random value of at least %d characters in release mode", minReleaseSecretLength))
+		}
+		if c.LLM.APIKey == "" {
+			errs = append(errs, errors.New("llm.api_key is required in release mode"))
+		}
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host is required in release mode, or reset links end up in the log"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l Limit) validate(key string) error {
+	if l.RequestsPerMinute < 0 {
+		return fmt.Errorf("%s.requests_per_minute must not be negative", key)
+	}
+	if l.RequestsPerMinute > 0 && l.Burst < 1 {
+		return fmt.Errorf("%s.burst must be at least 1", key)
+	}
+	return nil
+}
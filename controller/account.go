@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/Mitsui515/finsys/service"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+func (c *UserController) VerifyEmailHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.UserTokenRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := c.userService.VerifyEmail(&req, requestActor(reqCtx)); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Email verified successfully",
+	})
+}
+
+func (c *UserController) ResendVerificationHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.EmailRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := c.userService.ResendVerification(&req); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusAccepted, utils.H{
+		"code":    consts.StatusAccepted,
+		"message": "If the address belongs to an unverified user, a verification link has been sent",
+	})
+}
+
+func (c *UserController) ForgotPasswordHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.EmailRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := c.userService.ForgotPassword(&req); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusAccepted, utils.H{
+		"code":    consts.StatusAccepted,
+		"message": "If the address belongs to a user, a reset link has been sent",
+	})
+}
+
+func (c *UserController) ResetPasswordHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.ResetPasswordRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := c.userService.ResetPassword(&req, requestActor(reqCtx)); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Password reset successfully, log in again",
+	})
+}
+
+func (c *UserController) ChangeEmailHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.ChangeEmailRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	userID, _ := reqCtx.Get("user_id")
+	if err := c.userService.ChangeEmail(userID.(uint), &req); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusAccepted, utils.H{
+		"code":    consts.StatusAccepted,
+		"message": "A verification link has been sent to the new address, the email changes once it is followed",
+	})
+}
+
+func (c *UserController) ChangePasswordHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.ChangePasswordRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	userID, _ := reqCtx.Get("user_id")
+	sessionID, _ := reqCtx.Get("session_id")
+	if err := c.userService.ChangePassword(userID.(uint), sessionID.(string), &req, requestActor(reqCtx)); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Password changed successfully, other sessions have been logged out",
+	})
+}
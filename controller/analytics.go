@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type AnalyticsController struct {
+	analyticsService *service.AnalyticsService
+}
+
+func NewAnalyticsController() *AnalyticsController {
+	return &AnalyticsController{
+		analyticsService: service.NewAnalyticsService(config.DB),
+	}
+}
+
+func (c *AnalyticsController) VolumeHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	volume, err := c.analyticsService.Volume(reqCtx.Query("bucket"), filter)
+	if err != nil {
+		writeAnalyticsError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, volume)
+}
+
+func (c *AnalyticsController) FraudRateHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	rate, err := c.analyticsService.FraudRate(reqCtx.Query("bucket"), filter)
+	if err != nil {
+		writeAnalyticsError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, rate)
+}
+
+func (c *AnalyticsController) ProbabilityHistogramHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	bins := 0
+	if binsStr := reqCtx.Query("bins"); binsStr != "" {
+		var err error
+		bins, err = strconv.Atoi(binsStr)
+		if err != nil || bins <= 0 {
+			writeAnalyticsError(reqCtx, finsysutils.ErrInvalidHistogramBins)
+			return
+		}
+	}
+	histogram, err := c.analyticsService.ProbabilityHistogram(bins, filter)
+	if err != nil {
+		writeAnalyticsError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, histogram)
+}
+
+func (c *AnalyticsController) TopAccountsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(reqCtx.Query("limit"))
+	accounts, err := c.analyticsService.TopAccounts(reqCtx.Query("side"), limit, filter)
+	if err != nil {
+		writeAnalyticsError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, accounts)
+}
+
+func writeAnalyticsError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrInvalidAnalyticsBucket),
+		errors.Is(err, finsysutils.ErrInvalidHistogramBins),
+		errors.Is(err, finsysutils.ErrInvalidAccountSide),
+		errors.Is(err, finsysutils.ErrInvalidTransactionQuery):
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	default:
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+	}
+}
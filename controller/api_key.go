@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type APIKeyController struct {
+	apiKeyService *service.APIKeyService
+}
+
+func NewAPIKeyController() *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: service.NewAPIKeyService(),
+	}
+}
+
+func (c *APIKeyController) ListAPIKeysHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	page, err := strconv.Atoi(reqCtx.Query("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	size, err := strconv.Atoi(reqCtx.Query("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	var userID *uint
+	if value := reqCtx.Query("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Invalid Input",
+				"details": "Invalid user ID",
+			})
+			return
+		}
+		uid := uint(id)
+		userID = &uid
+	}
+	keys, err := c.apiKeyService.List(page, size, userID)
+	if err != nil {
+		writeAPIKeyError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    keys,
+	})
+}
+
+// CreateAPIKeyHandler returns the new key in full. It cannot be retrieved
+// again.
+func (c *APIKeyController) CreateAPIKeyHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.CreateAPIKeyRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	key, err := c.apiKeyService.Create(&req, requestActor(reqCtx))
+	if err != nil {
+		writeAPIKeyError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusCreated, utils.H{
+		"code":    consts.StatusCreated,
+		"message": "API key created successfully",
+		"data":    key,
+	})
+}
+
+func (c *APIKeyController) RevokeAPIKeyHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid API key ID",
+		})
+		return
+	}
+	key, err := c.apiKeyService.Revoke(uint(id), requestActor(reqCtx))
+	if err != nil {
+		writeAPIKeyError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "API key revoked successfully",
+		"data":    key,
+	})
+}
+
+func writeAPIKeyError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrAPIKeyNotExists):
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrInvalidAPIKeyName), errors.Is(err, finsysutils.ErrInvalidAPIKeyScope),
+		errors.Is(err, finsysutils.ErrAPIKeyScopeNotGranted), errors.Is(err, finsysutils.ErrInvalidExpiry),
+		errors.Is(err, finsysutils.ErrUserDisabled):
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	default:
+		writeUserError(reqCtx, err)
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type AuditController struct {
+	auditService *service.AuditService
+}
+
+func NewAuditController() *AuditController {
+	return &AuditController{
+		auditService: service.NewAuditService(config.DB),
+	}
+}
+
+// requestActor describes the user and request behind a change, for the audit
+// log.
+func requestActor(reqCtx *app.RequestContext) *model.Actor {
+	actor := &model.Actor{IP: reqCtx.ClientIP()}
+	if value, exists := reqCtx.Get("user_id"); exists {
+		actor.UserID = value.(uint)
+	}
+	if value, exists := reqCtx.Get("role"); exists {
+		actor.Role = value.(string)
+	}
+	if value, exists := reqCtx.Get("request_id"); exists {
+		actor.RequestID = value.(string)
+	}
+	return actor
+}
+
+func (c *AuditController) ListAuditLogsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	page, err := strconv.Atoi(reqCtx.Query("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	size, err := strconv.Atoi(reqCtx.Query("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	filter := &model.AuditFilter{
+		Action: reqCtx.Query("action"),
+		Entity: reqCtx.Query("entity"),
+	}
+	ids := []struct {
+		param string
+		dest  **uint
+	}{
+		{"actor_id", &filter.ActorID},
+		{"entity_id", &filter.EntityID},
+	}
+	for _, id := range ids {
+		valueStr := reqCtx.Query(id.param)
+		if valueStr == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(valueStr, 10, 32)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid " + id.param + " value",
+			})
+			return
+		}
+		parsed := uint(value)
+		*id.dest = &parsed
+	}
+	times := []struct {
+		param string
+		dest  **time.Time
+	}{
+		{"start_time", &filter.StartTime},
+		{"end_time", &filter.EndTime},
+	}
+	for _, t := range times {
+		valueStr := reqCtx.Query(t.param)
+		if valueStr == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, valueStr)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid " + t.param + " format",
+			})
+			return
+		}
+		*t.dest = &value
+	}
+	entries, err := c.auditService.List(page, size, filter)
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, entries)
+}
+
+func (c *AuditController) GetAuditLogHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid audit log ID",
+		})
+		return
+	}
+	entry, err := c.auditService.GetByID(uint(id))
+	if errors.Is(err, finsysutils.ErrAuditLogNotExists) {
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, entry)
+}
+
+func (c *AuditController) VerifyAuditLogHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	result, err := c.auditService.Verify()
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, result)
+}
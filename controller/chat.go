@@ -2,9 +2,13 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strconv"
 
 	"github.com/Mitsui515/finsys/service"
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 )
 
@@ -24,10 +28,26 @@ func (c *ChatController) ChatHandler(ctx context.Context, reqCtx *app.RequestCon
 		reqCtx.JSON(consts.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		return
 	}
-	resp, err := c.chatService.HandleChat(ctx, &req)
+	userID, _ := reqCtx.Get("user_id")
+	resp, err := c.chatService.HandleChat(ctx, &req, userID.(uint))
 	if err != nil {
+		var exceeded *service.LLMBudgetExceededError
+		if errors.As(err, &exceeded) {
+			writeBudgetExceeded(reqCtx, exceeded)
+			return
+		}
 		reqCtx.JSON(consts.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
 	reqCtx.JSON(consts.StatusOK, resp)
 }
+
+func writeBudgetExceeded(reqCtx *app.RequestContext, err *service.LLMBudgetExceededError) {
+	seconds := int64(math.Ceil(err.RetryAfter.Seconds()))
+	reqCtx.Response.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	reqCtx.JSON(consts.StatusTooManyRequests, utils.H{
+		"code":    consts.StatusTooManyRequests,
+		"message": "Too Many Requests",
+		"details": err.Error(),
+	})
+}
@@ -2,10 +2,13 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"io"
 	"strconv"
 
 	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/utils"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
@@ -13,11 +16,13 @@ import (
 
 type FraudReportController struct {
 	fraudReportService *service.FraudReportService
+	exportService      *service.ExportService
 }
 
 func NewFraudReportController() *FraudReportController {
 	return &FraudReportController{
 		fraudReportService: service.NewFraudReportService(config.DB),
+		exportService:      service.NewExportService(config.DB),
 	}
 }
 
@@ -78,7 +83,22 @@ func (c *FraudReportController) ListFraudReportsHandler(ctx context.Context, req
 	if err != nil || size <= 0 {
 		size = 10
 	}
-	reports, err := c.fraudReportService.List(page, size)
+	// Passing cursor, even empty for the first page, switches to keyset
+	// pagination, which skips OFFSET and counts only when with_total=true.
+	var reports interface{}
+	if reqCtx.QueryArgs().Has("cursor") {
+		reports, err = c.fraudReportService.ListByCursor(reqCtx.Query("cursor"), size, reqCtx.Query("with_total") == "true")
+	} else {
+		reports, err = c.fraudReportService.List(page, size)
+	}
+	if errors.Is(err, finsysutils.ErrInvalidCursor) {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -90,6 +110,25 @@ func (c *FraudReportController) ListFraudReportsHandler(ctx context.Context, req
 	reqCtx.JSON(consts.StatusOK, reports)
 }
 
+func (c *FraudReportController) ExportFraudReportsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	format := reqCtx.DefaultQuery("format", service.ExportFormatMarkdown)
+	if format != service.ExportFormatMarkdown && format != service.ExportFormatPDF {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Unsupported export format, expected md or pdf",
+		})
+		return
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(c.exportService.ExportFraudReports(writer, format))
+	}()
+	reqCtx.Header("Content-Disposition", `attachment; filename="fraud-reports.zip"`)
+	reqCtx.SetContentType("application/zip")
+	reqCtx.SetBodyStream(reader, -1)
+}
+
 func (c *FraudReportController) CreateFraudReportHandler(ctx context.Context, reqCtx *app.RequestContext) {
 	var req service.FraudReportRequest
 	if err := reqCtx.BindJSON(&req); err != nil {
@@ -100,7 +139,7 @@ func (c *FraudReportController) CreateFraudReportHandler(ctx context.Context, re
 		})
 		return
 	}
-	id, err := c.fraudReportService.Create(&req)
+	id, err := c.fraudReportService.Create(&req, requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -125,7 +164,7 @@ func (c *FraudReportController) UpdateFraudReportHandler(ctx context.Context, re
 		})
 		return
 	}
-	report, err := c.fraudReportService.Update(uint(id))
+	report, err := c.fraudReportService.Update(uint(id), requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -148,7 +187,7 @@ func (c *FraudReportController) DeleteFraudReportHandler(ctx context.Context, re
 		})
 		return
 	}
-	err = c.fraudReportService.Delete(uint(id))
+	err = c.fraudReportService.Delete(uint(id), requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -171,7 +210,7 @@ func (c *FraudReportController) GenerateReportHandler(ctx context.Context, reqCt
 		})
 		return
 	}
-	report, err := c.fraudReportService.GenerateReport(uint(id))
+	report, err := c.fraudReportService.GenerateReport(uint(id), requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -182,3 +221,94 @@ func (c *FraudReportController) GenerateReportHandler(ctx context.Context, reqCt
 	}
 	reqCtx.JSON(consts.StatusOK, report)
 }
+
+func (c *FraudReportController) ListReportVersionsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid fraud report ID",
+		})
+		return
+	}
+	versions, err := c.fraudReportService.Versions(uint(id))
+	if err != nil {
+		writeReportVersionError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"versions": versions,
+	})
+}
+
+func (c *FraudReportController) GetReportVersionHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid fraud report ID",
+		})
+		return
+	}
+	number, err := strconv.Atoi(reqCtx.Param("version"))
+	if err != nil || number <= 0 {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid report version",
+		})
+		return
+	}
+	version, err := c.fraudReportService.GetVersion(uint(id), number)
+	if err != nil {
+		writeReportVersionError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, version)
+}
+
+func (c *FraudReportController) DiffReportVersionsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid fraud report ID",
+		})
+		return
+	}
+	from, fromErr := strconv.Atoi(reqCtx.Query("from"))
+	to, toErr := strconv.Atoi(reqCtx.Query("to"))
+	if fromErr != nil || toErr != nil || from <= 0 || to <= 0 {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "from and to must be report versions",
+		})
+		return
+	}
+	diff, err := c.fraudReportService.Diff(uint(id), from, to)
+	if err != nil {
+		writeReportVersionError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, diff)
+}
+
+func writeReportVersionError(reqCtx *app.RequestContext, err error) {
+	if errors.Is(err, finsysutils.ErrFraudReportNotExists) || errors.Is(err, finsysutils.ErrReportVersionNotExists) {
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+		"code":    consts.StatusInternalServerError,
+		"message": "Internal Server Error",
+		"details": err.Error(),
+	})
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type ImportController struct {
+	importService *service.ImportService
+}
+
+func NewImportController() *ImportController {
+	return &ImportController{
+		importService: service.NewImportService(config.DB),
+	}
+}
+
+func (c *ImportController) GetImportHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportID(reqCtx)
+	if !ok {
+		return
+	}
+	job, err := c.importService.GetJob(id, requestActor(reqCtx))
+	if err != nil {
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": "Import job not found",
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, job)
+}
+
+func (c *ImportController) CancelImportHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportID(reqCtx)
+	if !ok {
+		return
+	}
+	if err := c.importService.Cancel(id, requestActor(reqCtx)); err != nil {
+		writeImportError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusAccepted, utils.H{
+		"message": "Cancellation requested",
+		"job_id":  id,
+	})
+}
+
+func (c *ImportController) ResumeImportHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportID(reqCtx)
+	if !ok {
+		return
+	}
+	job, err := c.importService.Resume(id, requestActor(reqCtx))
+	if err != nil {
+		writeImportError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusAccepted, job)
+}
+
+func parseImportID(reqCtx *app.RequestContext) (uint, bool) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid import job ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeImportError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrImportJobNotExists):
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrImportJobNotActive), errors.Is(err, finsysutils.ErrImportJobNotResume):
+		reqCtx.JSON(consts.StatusConflict, utils.H{
+			"code":    consts.StatusConflict,
+			"message": "Conflict",
+			"details": err.Error(),
+		})
+	default:
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+	}
+}
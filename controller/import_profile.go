@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type ImportProfileController struct {
+	importProfileService *service.ImportProfileService
+}
+
+func NewImportProfileController() *ImportProfileController {
+	return &ImportProfileController{
+		importProfileService: service.NewImportProfileService(config.DB),
+	}
+}
+
+func (c *ImportProfileController) ListImportProfilesHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	profiles, err := c.importProfileService.List()
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"profiles": profiles,
+	})
+}
+
+func (c *ImportProfileController) GetImportProfileHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportProfileID(reqCtx)
+	if !ok {
+		return
+	}
+	profile, err := c.importProfileService.GetByID(id)
+	if err != nil {
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": "Import profile not found",
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, profile)
+}
+
+func (c *ImportProfileController) CreateImportProfileHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.ImportProfileRequest
+	if err := reqCtx.BindJSON(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid request body",
+		})
+		return
+	}
+	id, err := c.importProfileService.Create(&req, requestActor(reqCtx))
+	if err != nil {
+		writeImportProfileError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"id": id,
+	})
+}
+
+func (c *ImportProfileController) UpdateImportProfileHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportProfileID(reqCtx)
+	if !ok {
+		return
+	}
+	var req service.ImportProfileRequest
+	if err := reqCtx.BindJSON(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid request body",
+		})
+		return
+	}
+	profile, err := c.importProfileService.Update(id, &req, requestActor(reqCtx))
+	if err != nil {
+		writeImportProfileError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, profile)
+}
+
+func (c *ImportProfileController) DeleteImportProfileHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, ok := parseImportProfileID(reqCtx)
+	if !ok {
+		return
+	}
+	if err := c.importProfileService.Delete(id, requestActor(reqCtx)); err != nil {
+		writeImportProfileError(reqCtx, err)
+		return
+	}
+	reqCtx.Status(consts.StatusNoContent)
+}
+
+func parseImportProfileID(reqCtx *app.RequestContext) (uint, bool) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 32)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Invalid import profile ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeImportProfileError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrImportProfileNotExists):
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrExistedImportProfile):
+		reqCtx.JSON(consts.StatusConflict, utils.H{
+			"code":    consts.StatusConflict,
+			"message": "Conflict",
+			"details": err.Error(),
+		})
+	default:
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	}
+}
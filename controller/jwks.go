@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/Mitsui515/finsys/middleware"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// JWKSHandler publishes the public keys access tokens are signed with, so
+// other services can verify them without a shared secret.
+func JWKSHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	reqCtx.Header("Cache-Control", "public, max-age=300")
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"keys": middleware.JWKS(),
+	})
+}
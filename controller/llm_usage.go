@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type LLMUsageController struct {
+	llmUsageService *service.LLMUsageService
+}
+
+func NewLLMUsageController() *LLMUsageController {
+	return &LLMUsageController{
+		llmUsageService: service.NewLLMUsageService(),
+	}
+}
+
+// UsageStatusHandler shows the caller their own usage and budget.
+func (c *LLMUsageController) UsageStatusHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	userID, _ := reqCtx.Get("user_id")
+	status, err := c.llmUsageService.Status(userID.(uint))
+	if err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    status,
+	})
+}
+
+// UsageReportHandler totals usage grouped by group_by, optionally for one
+// user_id and between start_time and end_time.
+func (c *LLMUsageController) UsageReportHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	filter := &model.LLMUsageFilter{}
+	if value := reqCtx.Query("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Invalid Input",
+				"details": "Invalid user ID",
+			})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	if value := reqCtx.Query("start_time"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Invalid Input",
+				"details": "Invalid start time format",
+			})
+			return
+		}
+		filter.From = t
+	}
+	if value := reqCtx.Query("end_time"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Invalid Input",
+				"details": "Invalid end time format",
+			})
+			return
+		}
+		filter.To = t
+	}
+	report, err := c.llmUsageService.Report(reqCtx.Query("group_by"), filter)
+	if err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    report,
+	})
+}
+
+func (c *LLMUsageController) ListBudgetsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	budgets, err := c.llmUsageService.ListBudgets()
+	if err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    budgets,
+	})
+}
+
+func (c *LLMUsageController) SetUserBudgetHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	var req service.LLMBudgetRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	budget, err := c.llmUsageService.SetUserBudget(uint(id), &req, requestActor(reqCtx))
+	if err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Budget updated",
+		"data":    budget,
+	})
+}
+
+func (c *LLMUsageController) SetRoleBudgetHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.LLMBudgetRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	budget, err := c.llmUsageService.SetRoleBudget(reqCtx.Param("role"), &req, requestActor(reqCtx))
+	if err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Budget updated",
+		"data":    budget,
+	})
+}
+
+func (c *LLMUsageController) DeleteUserBudgetHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	if err := c.llmUsageService.DeleteUserBudget(uint(id), requestActor(reqCtx)); err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Budget removed",
+	})
+}
+
+func (c *LLMUsageController) DeleteRoleBudgetHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	if err := c.llmUsageService.DeleteRoleBudget(reqCtx.Param("role"), requestActor(reqCtx)); err != nil {
+		writeLLMUsageError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Budget removed",
+	})
+}
+
+func writeLLMUsageError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrInvalidUsageGroup), errors.Is(err, finsysutils.ErrInvalidLLMBudget):
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	default:
+		writeUserError(reqCtx, err)
+	}
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// VerifyMFAHandler completes a login with the challenge token from Login and
+// a code.
+func (c *UserController) VerifyMFAHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.MFAVerifyRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	login, err := c.userService.VerifyMFA(&req, requestActor(reqCtx))
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, login)
+}
+
+// EnrollWithChallengeHandler sets up TOTP during a login that requires it.
+func (c *UserController) EnrollWithChallengeHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.MFAChallengeRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	enrollment, err := c.userService.EnrollTOTPForChallenge(&req)
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    enrollment,
+	})
+}
+
+func (c *UserController) MFAStatusHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	userID, _ := reqCtx.Get("user_id")
+	status, err := c.userService.MFAStatus(userID.(uint))
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    status,
+	})
+}
+
+func (c *UserController) EnrollTOTPHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	userID, _ := reqCtx.Get("user_id")
+	enrollment, err := c.userService.EnrollTOTP(userID.(uint))
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    enrollment,
+	})
+}
+
+func (c *UserController) ConfirmTOTPHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.TOTPCodeRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	userID, _ := reqCtx.Get("user_id")
+	codes, err := c.userService.ConfirmTOTP(userID.(uint), &req, requestActor(reqCtx))
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Two-factor authentication enabled",
+		"data":    codes,
+	})
+}
+
+func (c *UserController) DisableTOTPHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.TOTPCodeRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	userID, _ := reqCtx.Get("user_id")
+	if err := c.userService.DisableTOTP(userID.(uint), &req, requestActor(reqCtx)); err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (c *UserController) RegenerateRecoveryCodesHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.TOTPCodeRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	userID, _ := reqCtx.Get("user_id")
+	codes, err := c.userService.RegenerateRecoveryCodes(userID.(uint), &req)
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    codes,
+	})
+}
+
+// ResetTOTPHandler lets an administrator remove another user's TOTP.
+func (c *UserController) ResetTOTPHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	if err := c.userService.ResetTOTP(uint(id), requestActor(reqCtx)); err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Two-factor authentication reset",
+	})
+}
+
+func (c *UserController) SetRolePolicyHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.RolePolicyRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	policy, err := c.userService.SetRolePolicy(reqCtx.Param("role"), &req, requestActor(reqCtx))
+	if err != nil {
+		writeMFAError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Role policy updated",
+		"data":    policy,
+	})
+}
+
+func writeMFAError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrInvalidMFAChallenge), errors.Is(err, finsysutils.ErrInvalidTOTPCode):
+		reqCtx.JSON(consts.StatusUnauthorized, utils.H{
+			"code":    consts.StatusUnauthorized,
+			"message": "Unauthorized",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrTOTPNotEnrolled), errors.Is(err, finsysutils.ErrTOTPAlreadyEnabled):
+		reqCtx.JSON(consts.StatusConflict, utils.H{
+			"code":    consts.StatusConflict,
+			"message": "Conflict",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrLoginThrottled):
+		writeLoginThrottled(reqCtx, err)
+	case errors.Is(err, finsysutils.ErrTOTPRequired):
+		reqCtx.JSON(consts.StatusForbidden, utils.H{
+			"code":    consts.StatusForbidden,
+			"message": "Forbidden",
+			"details": err.Error(),
+		})
+	default:
+		writeUserError(reqCtx, err)
+	}
+}
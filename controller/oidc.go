@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type OIDCController struct {
+	oidcService *service.OIDCService
+}
+
+func NewOIDCController() *OIDCController {
+	return &OIDCController{
+		oidcService: service.NewOIDCService(),
+	}
+}
+
+// oidcLoginCookie binds a login to the browser that started it, so a callback
+// URL completed in another browser is refused.
+const (
+	oidcLoginCookie     = "finsys_oidc_login"
+	oidcLoginCookiePath = "/api/auth/oidc"
+)
+
+// LoginHandler sends the browser to the identity provider.
+func (c *OIDCController) LoginHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	authURL, binder, err := c.oidcService.AuthURL(ctx)
+	if err != nil {
+		writeOIDCError(reqCtx, err)
+		return
+	}
+	// Lax still sends the cookie on the provider's top-level redirect back.
+	reqCtx.SetCookie(oidcLoginCookie, binder, int(service.OIDCLoginTTL.Seconds()), oidcLoginCookiePath, "",
+		protocol.CookieSameSiteLaxMode, c.oidcService.LoginCookieSecure(), true)
+	reqCtx.Redirect(consts.StatusFound, []byte(authURL))
+}
+
+// CallbackHandler is where the identity provider sends the browser back. On
+// success the tokens, or the two-factor challenge, go to the configured
+// frontend in the URL fragment, which browsers do not send to servers, or are
+// returned as JSON.
+func (c *OIDCController) CallbackHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	if providerError := reqCtx.Query("error"); providerError != "" {
+		reqCtx.JSON(consts.StatusUnauthorized, utils.H{
+			"code":    consts.StatusUnauthorized,
+			"message": "Unauthorized",
+			"details": providerError + ": " + reqCtx.Query("error_description"),
+		})
+		return
+	}
+	var req service.OIDCCallbackRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil || req.Code == "" || req.State == "" {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "code and state are required",
+		})
+		return
+	}
+	binder := string(reqCtx.Cookie(oidcLoginCookie))
+	reqCtx.SetCookie(oidcLoginCookie, "", -1, oidcLoginCookiePath, "",
+		protocol.CookieSameSiteLaxMode, c.oidcService.LoginCookieSecure(), true)
+	login, err := c.oidcService.Callback(ctx, &req, binder, requestActor(reqCtx), string(reqCtx.UserAgent()))
+	if err != nil {
+		writeOIDCError(reqCtx, err)
+		return
+	}
+	if frontend := c.oidcService.FrontendRedirectURL(); frontend != "" {
+		fragment := url.Values{}
+		if login.MFARequired {
+			fragment.Set("mfa_required", "true")
+			fragment.Set("enrollment_required", strconv.FormatBool(login.EnrollmentRequired))
+			fragment.Set("challenge_token", login.ChallengeToken)
+			fragment.Set("challenge_expires_in", strconv.FormatInt(login.ChallengeExpiresIn, 10))
+		} else {
+			fragment.Set("token", login.Token)
+			fragment.Set("refresh_token", login.RefreshToken)
+			fragment.Set("expires_in", strconv.FormatInt(login.ExpiresIn, 10))
+		}
+		reqCtx.Redirect(consts.StatusFound, []byte(frontend+"#"+fragment.Encode()))
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, login)
+}
+
+func writeOIDCError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrOIDCDisabled):
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrInvalidOIDCState):
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrIdentityNotLinked), errors.Is(err, finsysutils.ErrOIDCEmailRequired),
+		errors.Is(err, finsysutils.ErrOIDCEmailNotVerified), errors.Is(err, finsysutils.ErrUserNotExists):
+		reqCtx.JSON(consts.StatusForbidden, utils.H{
+			"code":    consts.StatusForbidden,
+			"message": "Forbidden",
+			"details": err.Error(),
+		})
+	default:
+		reqCtx.JSON(consts.StatusUnauthorized, utils.H{
+			"code":    consts.StatusUnauthorized,
+			"message": "Unauthorized",
+			"details": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/service"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+type SecurityController struct {
+	securityService *service.SecurityService
+}
+
+func NewSecurityController() *SecurityController {
+	return &SecurityController{
+		securityService: service.NewSecurityService(config.DB),
+	}
+}
+
+func (c *SecurityController) ListSecurityEventsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	page, err := strconv.Atoi(reqCtx.Query("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	size, err := strconv.Atoi(reqCtx.Query("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	events, err := c.securityService.ListEvents(page, size, reqCtx.Query("type"))
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    events,
+	})
+}
+
+// ListLocksHandler lists the usernames and IPs currently locked out.
+func (c *SecurityController) ListLocksHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	locks, err := c.securityService.Locks()
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    locks,
+	})
+}
+
+func (c *SecurityController) UnlockIPHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	ip := reqCtx.Param("ip")
+	if net.ParseIP(ip) == nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid IP address",
+		})
+		return
+	}
+	if err := c.securityService.UnlockIP(ip, requestActor(reqCtx)); err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "IP unlocked successfully",
+	})
+}
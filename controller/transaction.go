@@ -1,25 +1,38 @@
 package controller
 
 import (
+	"bytes"
 	"context"
-	"path/filepath"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
 	"strconv"
 	"time"
 
 	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/utils"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 )
 
+// maxImportMappingSize bounds the "mapping" field of an import upload.
+const maxImportMappingSize = 64 << 10
+
 type TransactionController struct {
 	transactionService *service.TransactionService
+	importService      *service.ImportService
+	exportService      *service.ExportService
 }
 
 func NewTransactionController() *TransactionController {
 	return &TransactionController{
 		transactionService: service.NewTransactionService(config.DB),
+		importService:      service.NewImportService(config.DB),
+		exportService:      service.NewExportService(config.DB),
 	}
 }
 
@@ -49,9 +62,6 @@ func (c *TransactionController) GetTransactionHandler(ctx context.Context, reqCt
 func (c *TransactionController) ListTransactionHandler(ctx context.Context, reqCtx *app.RequestContext) {
 	pageStr := reqCtx.Query("page")
 	sizeStr := reqCtx.Query("size")
-	transactionType := reqCtx.Query("type")
-	startTimeStr := reqCtx.Query("start_time")
-	endTimeStr := reqCtx.Query("end_time")
 	page, err := strconv.Atoi(pageStr)
 	if err != nil || page <= 0 {
 		page = 1
@@ -60,8 +70,85 @@ func (c *TransactionController) ListTransactionHandler(ctx context.Context, reqC
 	if err != nil || size <= 0 {
 		size = 10
 	}
-	var startTime, endTime *time.Time
-	if startTimeStr != "" {
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	// Passing cursor, even empty for the first page, switches to keyset
+	// pagination, which skips OFFSET and counts only when with_total=true.
+	var transactions interface{}
+	if reqCtx.QueryArgs().Has("cursor") {
+		transactions, err = c.transactionService.ListByCursor(reqCtx.Query("cursor"), size, filter, reqCtx.Query("with_total") == "true")
+	} else {
+		transactions, err = c.transactionService.ListByPage(page, size, filter)
+	}
+	if errors.Is(err, finsysutils.ErrInvalidTransactionQuery) || errors.Is(err, finsysutils.ErrInvalidSortField) ||
+		errors.Is(err, finsysutils.ErrInvalidCursor) || errors.Is(err, finsysutils.ErrCursorSortField) {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, transactions)
+}
+
+func (c *TransactionController) ExportTransactionsHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	format := reqCtx.DefaultQuery("format", service.ExportFormatCSV)
+	contentType, ok := service.TransactionExportContentType(format)
+	if !ok {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": "Unsupported export format, expected csv, jsonl or parquet",
+		})
+		return
+	}
+	filter, ok := parseTransactionFilter(reqCtx)
+	if !ok {
+		return
+	}
+	if err := c.transactionService.ValidateFilter(filter); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+		return
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(c.exportService.ExportTransactions(writer, format, filter))
+	}()
+	reqCtx.Header("Content-Disposition", `attachment; filename="transactions.`+format+`"`)
+	reqCtx.SetContentType(contentType)
+	reqCtx.SetBodyStream(reader, -1)
+}
+
+// parseTransactionFilter reads the filter query parameters shared by the list
+// and export endpoints. It writes the error response and returns false when a
+// parameter is invalid.
+func parseTransactionFilter(reqCtx *app.RequestContext) (*model.TransactionFilter, bool) {
+	filter := &model.TransactionFilter{
+		Type:           reqCtx.Query("type"),
+		NameOrig:       reqCtx.Query("name_orig"),
+		NameOrigPrefix: reqCtx.Query("name_orig_prefix"),
+		NameDest:       reqCtx.Query("name_dest"),
+		NameDestPrefix: reqCtx.Query("name_dest_prefix"),
+		Query:          reqCtx.Query("q"),
+		SortBy:         reqCtx.Query("sort"),
+		SortOrder:      reqCtx.Query("order"),
+	}
+	if startTimeStr := reqCtx.Query("start_time"); startTimeStr != "" {
 		t, err := time.Parse(time.RFC3339, startTimeStr)
 		if err != nil {
 			reqCtx.JSON(consts.StatusBadRequest, utils.H{
@@ -69,11 +156,11 @@ func (c *TransactionController) ListTransactionHandler(ctx context.Context, reqC
 				"message": "Bad Request",
 				"details": "Invalid start time format",
 			})
-			return
+			return nil, false
 		}
-		startTime = &t
+		filter.StartTime = &t
 	}
-	if endTimeStr != "" {
+	if endTimeStr := reqCtx.Query("end_time"); endTimeStr != "" {
 		t, err := time.Parse(time.RFC3339, endTimeStr)
 		if err != nil {
 			reqCtx.JSON(consts.StatusBadRequest, utils.H{
@@ -81,20 +168,48 @@ func (c *TransactionController) ListTransactionHandler(ctx context.Context, reqC
 				"message": "Bad Request",
 				"details": "Invalid end time format",
 			})
-			return
+			return nil, false
 		}
-		endTime = &t
+		filter.EndTime = &t
 	}
-	transactions, err := c.transactionService.ListByPage(page, size, transactionType, startTime, endTime)
-	if err != nil {
-		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
-			"code":    consts.StatusInternalServerError,
-			"message": "Internal Server Error",
-			"details": err.Error(),
-		})
-		return
+	if isFraudStr := reqCtx.Query("is_fraud"); isFraudStr != "" {
+		isFraud, err := strconv.ParseBool(isFraudStr)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid is_fraud value",
+			})
+			return nil, false
+		}
+		filter.IsFraud = &isFraud
 	}
-	reqCtx.JSON(consts.StatusOK, transactions)
+	bounds := []struct {
+		param string
+		dest  **float64
+	}{
+		{"min_amount", &filter.MinAmount},
+		{"max_amount", &filter.MaxAmount},
+		{"min_probability", &filter.MinProbability},
+		{"max_probability", &filter.MaxProbability},
+	}
+	for _, bound := range bounds {
+		valueStr := reqCtx.Query(bound.param)
+		if valueStr == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid " + bound.param + " value",
+			})
+			return nil, false
+		}
+		*bound.dest = &value
+	}
+	return filter, true
 }
 
 func (c *TransactionController) CreateTransactionHandler(ctx context.Context, reqCtx *app.RequestContext) {
@@ -107,7 +222,7 @@ func (c *TransactionController) CreateTransactionHandler(ctx context.Context, re
 		})
 		return
 	}
-	id, err := c.transactionService.Create(&req)
+	id, err := c.transactionService.Create(&req, requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
@@ -141,7 +256,7 @@ func (c *TransactionController) UpdateTransactionHandler(ctx context.Context, re
 		})
 		return
 	}
-	transaction, err := c.transactionService.Update(uint(id), &req)
+	transaction, err := c.transactionService.Update(uint(id), &req, requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusNotFound, utils.H{
 			"code":    consts.StatusNotFound,
@@ -164,7 +279,7 @@ func (c *TransactionController) DeleteTransactionHandler(ctx context.Context, re
 		})
 		return
 	}
-	err = c.transactionService.Delete(uint(id))
+	err = c.transactionService.Delete(uint(id), requestActor(reqCtx))
 	if err != nil {
 		reqCtx.JSON(consts.StatusNotFound, utils.H{
 			"code":    consts.StatusNotFound,
@@ -177,45 +292,115 @@ func (c *TransactionController) DeleteTransactionHandler(ctx context.Context, re
 }
 
 func (c *TransactionController) ImportTransactionsHandler(ctx context.Context, reqCtx *app.RequestContext) {
-	file, err := reqCtx.FormFile("file")
-	if err != nil {
-		reqCtx.JSON(consts.StatusBadRequest, utils.H{
-			"code":    consts.StatusBadRequest,
-			"message": "Bad Request",
-			"details": "Please select CSV file to upload",
+	opts := &service.ImportOptions{
+		Format: reqCtx.Query("format"),
+		DryRun: reqCtx.Query("dry_run") == "true",
+	}
+	if profileStr := reqCtx.Query("profile_id"); profileStr != "" {
+		profileID, err := strconv.ParseUint(profileStr, 10, 32)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid import profile ID",
+			})
+			return
+		}
+		opts.ProfileID = uint(profileID)
+	}
+	if userID, exists := reqCtx.Get("user_id"); exists {
+		opts.UserID = userID.(uint)
+	}
+	upload, mapping, ok := c.readImportForm(reqCtx)
+	if !ok {
+		return
+	}
+	opts.Mapping = mapping
+	result, err := c.importService.Submit(upload, opts)
+	if errors.Is(err, finsysutils.ErrImportProfileNotExists) {
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
 		})
 		return
 	}
-	if filepath.Ext(file.Filename) != ".csv" {
+	if errors.Is(err, finsysutils.ErrUnsupportedImportFormat) || errors.Is(err, finsysutils.ErrInvalidImportMapping) ||
+		errors.Is(err, finsysutils.ErrInvalidSeparator) || errors.Is(err, finsysutils.ErrInvalidTimezone) {
 		reqCtx.JSON(consts.StatusBadRequest, utils.H{
 			"code":    consts.StatusBadRequest,
 			"message": "Bad Request",
-			"details": "Only CSV file is allowed",
+			"details": err.Error(),
 		})
 		return
 	}
-	src, err := file.Open()
 	if err != nil {
 		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
 			"code":    consts.StatusInternalServerError,
 			"message": "Internal Server Error",
-			"details": "Cannot read file",
+			"details": err.Error(),
 		})
 		return
 	}
-	defer src.Close()
-	importService := service.NewTransactionService(config.DB)
-	count, err := importService.ImportFromCSV(src)
-	if err != nil {
-		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
-			"code":    consts.StatusInternalServerError,
-			"message": "Internal Server Error",
-			"details": err.Error(),
+	reqCtx.JSON(consts.StatusAccepted, result)
+}
+
+// readImportForm reads the multipart import request as it arrives. The "file"
+// part is spooled straight to disk and the optional "mapping" field holds a
+// JSON column mapping. On failure it writes the error response and returns
+// false.
+func (c *TransactionController) readImportForm(reqCtx *app.RequestContext) (*service.ImportUpload, service.ColumnMapping, bool) {
+	var upload *service.ImportUpload
+	var mapping service.ColumnMapping
+	fail := func(status int, message, details string) (*service.ImportUpload, service.ColumnMapping, bool) {
+		if upload != nil {
+			upload.Discard()
+		}
+		reqCtx.JSON(status, utils.H{
+			"code":    status,
+			"message": message,
+			"details": details,
 		})
-		return
+		return nil, nil, false
 	}
-	reqCtx.JSON(consts.StatusOK, utils.H{
-		"message": "Successfully imported transactions",
-		"count":   count,
-	})
+	boundary := string(reqCtx.Request.Header.MultipartFormBoundary())
+	if boundary == "" {
+		return fail(consts.StatusBadRequest, "Bad Request", "Please select a CSV, JSONL, Parquet or XLSX file to upload")
+	}
+	var body io.Reader
+	if reqCtx.Request.IsBodyStream() {
+		body = reqCtx.Request.BodyStream()
+	} else {
+		body = bytes.NewReader(reqCtx.Request.Body())
+	}
+	form := multipart.NewReader(body, boundary)
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(consts.StatusBadRequest, "Bad Request", "Invalid multipart form")
+		}
+		switch {
+		case part.FormName() == "file" && part.FileName() != "" && upload == nil:
+			upload, err = c.importService.Spool(part.FileName(), part)
+			if errors.Is(err, finsysutils.ErrImportTooLarge) {
+				return fail(consts.StatusRequestEntityTooLarge, "Request Entity Too Large", err.Error())
+			}
+			if err != nil {
+				return fail(consts.StatusInternalServerError, "Internal Server Error", "Cannot read file")
+			}
+		case part.FormName() == "mapping":
+			data, err := io.ReadAll(io.LimitReader(part, maxImportMappingSize))
+			if err != nil || json.Unmarshal(data, &mapping) != nil {
+				return fail(consts.StatusBadRequest, "Bad Request", "Invalid column mapping")
+			}
+		}
+		part.Close()
+	}
+	if upload == nil {
+		return fail(consts.StatusBadRequest, "Bad Request", "Please select a CSV, JSONL, Parquet or XLSX file to upload")
+	}
+	return upload, mapping, true
 }
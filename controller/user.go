@@ -2,8 +2,13 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strconv"
 
+	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/service"
+	finsysutils "github.com/Mitsui515/finsys/utils"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/utils"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
@@ -36,6 +41,7 @@ func (c *UserController) Register(ctx context.Context, reqCtx *app.RequestContex
 			"message": "Invalid Input",
 			"details": err.Error(),
 		})
+		return
 	}
 	reqCtx.JSON(consts.StatusCreated, utils.H{
 		"user_id": userID,
@@ -52,17 +58,106 @@ func (c *UserController) Login(ctx context.Context, reqCtx *app.RequestContext)
 		})
 		return
 	}
-	token, err := c.userService.Login(&req)
+	login, err := c.userService.Login(&req, reqCtx.ClientIP(), string(reqCtx.UserAgent()))
+	if err != nil {
+		switch {
+		case errors.Is(err, finsysutils.ErrInvalidCredentials):
+			reqCtx.JSON(consts.StatusUnauthorized, utils.H{
+				"code":    consts.StatusUnauthorized,
+				"message": "Unauthorized",
+				"details": "Invalid username or password",
+			})
+		case errors.Is(err, finsysutils.ErrLoginThrottled):
+			writeLoginThrottled(reqCtx, err)
+		case errors.Is(err, finsysutils.ErrUserDisabled), errors.Is(err, finsysutils.ErrEmailNotVerified):
+			reqCtx.JSON(consts.StatusForbidden, utils.H{
+				"code":    consts.StatusForbidden,
+				"message": "Forbidden",
+				"details": err.Error(),
+			})
+		default:
+			reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+				"code":    consts.StatusInternalServerError,
+				"message": "Internal Server Error",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, login)
+}
+
+func (c *UserController) Refresh(ctx context.Context, reqCtx *app.RequestContext) {
+	var req service.RefreshRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	tokens, err := c.userService.Refresh(&req)
+	if err != nil {
+		status, message := consts.StatusUnauthorized, "Unauthorized"
+		if !errors.Is(err, finsysutils.ErrInvalidRefreshToken) && !errors.Is(err, finsysutils.ErrRefreshTokenReused) {
+			status, message = consts.StatusInternalServerError, "Internal Server Error"
+		}
+		reqCtx.JSON(status, utils.H{
+			"code":    status,
+			"message": message,
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, tokens)
+}
+
+func (c *UserController) Logout(ctx context.Context, reqCtx *app.RequestContext) {
+	sessionID, _ := reqCtx.Get("session_id")
+	if err := c.userService.Logout(sessionID.(string)); err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Logged out successfully",
+	})
+}
+
+func (c *UserController) LogoutAll(ctx context.Context, reqCtx *app.RequestContext) {
+	userID, _ := reqCtx.Get("user_id")
+	c.logoutAll(reqCtx, userID.(uint))
+}
+
+// LogoutUserHandler lets an administrator end every session of another user.
+func (c *UserController) LogoutUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
 	if err != nil {
-		reqCtx.JSON(consts.StatusUnauthorized, utils.H{
-			"code":    consts.StatusUnauthorized,
-			"message": "Unauthorized",
-			"details": "Invalid username or password",
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
 		})
 		return
 	}
+	c.logoutAll(reqCtx, uint(id))
+}
+
+func (c *UserController) logoutAll(reqCtx *app.RequestContext, userID uint) {
+	revoked, err := c.userService.LogoutAll(userID)
+	if err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
 	reqCtx.JSON(consts.StatusOK, utils.H{
-		"token": token,
+		"code":    consts.StatusOK,
+		"message": "All sessions logged out successfully",
+		"data":    utils.H{"revoked": revoked},
 	})
 }
 
@@ -86,9 +181,246 @@ func (c *UserController) GetUserInfo(ctx context.Context, reqCtx *app.RequestCon
 		return
 	}
 	reqCtx.JSON(consts.StatusOK, utils.H{
-		"user_id":    userID,
-		"username":   user.Username,
-		"email":      user.Email,
-		"created_at": user.CreatedAt,
+		"user_id":        userID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"role":           user.Role,
+		"permissions":    model.RolePermissions(user.Role),
+		"created_at":     user.CreatedAt,
 	})
 }
+
+func (c *UserController) ListUsersHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	page, err := strconv.Atoi(reqCtx.Query("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	size, err := strconv.Atoi(reqCtx.Query("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	filter := &model.UserFilter{
+		Query: reqCtx.Query("q"),
+		Role:  reqCtx.Query("role"),
+	}
+	if disabledStr := reqCtx.Query("disabled"); disabledStr != "" {
+		disabled, err := strconv.ParseBool(disabledStr)
+		if err != nil {
+			reqCtx.JSON(consts.StatusBadRequest, utils.H{
+				"code":    consts.StatusBadRequest,
+				"message": "Bad Request",
+				"details": "Invalid disabled value",
+			})
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	users, err := c.userService.List(page, size, filter)
+	if err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    users,
+	})
+}
+
+func (c *UserController) ListRolesHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	roles, err := c.userService.Roles()
+	if err != nil {
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    roles,
+	})
+}
+
+func (c *UserController) AssignRoleHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	var req service.RoleRequest
+	if err := reqCtx.BindAndValidate(&req); err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": err.Error(),
+		})
+		return
+	}
+	user, err := c.userService.AssignRole(uint(id), &req, requestActor(reqCtx))
+	if err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Role assigned successfully",
+		"data":    user,
+	})
+}
+
+func (c *UserController) GetUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	user, err := c.userService.Get(uint(id))
+	if err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "Success",
+		"data":    user,
+	})
+}
+
+func (c *UserController) DisableUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	c.setDisabled(reqCtx, true)
+}
+
+func (c *UserController) EnableUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	c.setDisabled(reqCtx, false)
+}
+
+func (c *UserController) setDisabled(reqCtx *app.RequestContext, disabled bool) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	user, err := c.userService.SetDisabled(uint(id), disabled, requestActor(reqCtx))
+	if err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	message := "User enabled successfully"
+	if disabled {
+		message = "User disabled successfully"
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": message,
+		"data":    user,
+	})
+}
+
+func (c *UserController) DeleteUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	if err := c.userService.Delete(uint(id), requestActor(reqCtx)); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "User deleted successfully",
+	})
+}
+
+// UnlockUserHandler lets an administrator lift a login lockout early.
+func (c *UserController) UnlockUserHandler(ctx context.Context, reqCtx *app.RequestContext) {
+	id, err := strconv.ParseUint(reqCtx.Param("id"), 10, 64)
+	if err != nil {
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Invalid Input",
+			"details": "Invalid user ID",
+		})
+		return
+	}
+	if err := c.userService.UnlockUser(uint(id), requestActor(reqCtx)); err != nil {
+		writeUserError(reqCtx, err)
+		return
+	}
+	reqCtx.JSON(consts.StatusOK, utils.H{
+		"code":    consts.StatusOK,
+		"message": "User unlocked successfully",
+	})
+}
+
+// writeLoginThrottled answers a locked or delayed login with 429 and a
+// Retry-After header in whole seconds.
+func writeLoginThrottled(reqCtx *app.RequestContext, err error) {
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		seconds := int64(math.Ceil(throttled.RetryAfter.Seconds()))
+		reqCtx.Response.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	reqCtx.JSON(consts.StatusTooManyRequests, utils.H{
+		"code":    consts.StatusTooManyRequests,
+		"message": "Too Many Requests",
+		"details": err.Error(),
+	})
+}
+
+func writeUserError(reqCtx *app.RequestContext, err error) {
+	switch {
+	case errors.Is(err, finsysutils.ErrUserNotExists):
+		reqCtx.JSON(consts.StatusNotFound, utils.H{
+			"code":    consts.StatusNotFound,
+			"message": "Not Found",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrInvalidRole), errors.Is(err, finsysutils.ErrInvalidEmail),
+		errors.Is(err, finsysutils.ErrInvalidPassword), errors.Is(err, finsysutils.ErrInvalidUserToken):
+		reqCtx.JSON(consts.StatusBadRequest, utils.H{
+			"code":    consts.StatusBadRequest,
+			"message": "Bad Request",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrWrongPassword):
+		reqCtx.JSON(consts.StatusForbidden, utils.H{
+			"code":    consts.StatusForbidden,
+			"message": "Forbidden",
+			"details": err.Error(),
+		})
+	case errors.Is(err, finsysutils.ErrLastAdmin), errors.Is(err, finsysutils.ErrManageSelf),
+		errors.Is(err, finsysutils.ErrExistedEmail):
+		reqCtx.JSON(consts.StatusConflict, utils.H{
+			"code":    consts.StatusConflict,
+			"message": "Conflict",
+			"details": err.Error(),
+		})
+	default:
+		reqCtx.JSON(consts.StatusInternalServerError, utils.H{
+			"code":    consts.StatusInternalServerError,
+			"message": "Internal Server Error",
+			"details": err.Error(),
+		})
+	}
+}
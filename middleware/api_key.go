@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	finsysutils "github.com/Mitsui515/finsys/utils"
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// APIKeyHeader is an alternative to sending the key as a bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// requestAPIKey returns the API key the request authenticates with, if any.
+func requestAPIKey(c *app.RequestContext, bearer string) (string, bool) {
+	if key := c.Request.Header.Get(APIKeyHeader); key != "" {
+		return key, true
+	}
+	if strings.HasPrefix(bearer, model.APIKeyPrefix) {
+		return bearer, true
+	}
+	return "", false
+}
+
+// authenticateAPIKey checks key and returns it with the user it acts as.
+func authenticateAPIKey(key string) (*model.APIKey, *model.User, error) {
+	prefix, secret, ok := model.ParseAPIKey(key)
+	if !ok {
+		return nil, nil, finsysutils.ErrInvalidAPIKey
+	}
+	keyRepository := repository.NewAPIKeyRepository(config.DB)
+	apiKey, err := keyRepository.FindByPrefix(prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := model.HashAPIKeySecret(secret)
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(apiKey.SecretHash)) != 1 || !apiKey.Active(now) {
+		return nil, nil, finsysutils.ErrInvalidAPIKey
+	}
+	user, err := repository.NewUserRepository(config.DB).FindByID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, finsysutils.ErrInvalidAPIKey
+	}
+	if err := keyRepository.TouchLastUsed(apiKey.ID, now); err != nil {
+		log.Printf("Fail to record use of API key %d: %v", apiKey.ID, err)
+	}
+	return apiKey, user, nil
+}
@@ -2,9 +2,13 @@ package middleware
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	finsysutils "github.com/Mitsui515/finsys/utils"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/utils"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
@@ -12,68 +16,122 @@ import (
 )
 
 type JWTConfig struct {
-	SecretKey     string
-	TokenExpire   time.Duration
-	TokenIssuer   string
-	TokenSubject  string
-	TokenAudience string
+	Algorithm          string
+	SecretKey          string
+	TokenExpire        time.Duration
+	RefreshTokenExpire time.Duration
+	TokenIssuer        string
+	TokenSubject       string
+	TokenAudience      string
 }
 
 func DefaultJWTConfig() *JWTConfig {
+	jwtConfig := config.Current().JWT
 	return &JWTConfig{
-		SecretKey:     "HKU_Project",
-		TokenExpire:   24 * 7 * time.Hour,
-		TokenIssuer:   "finsys",
-		TokenSubject:  "auth",
-		TokenAudience: "user",
+		Algorithm:          jwtConfig.Algorithm,
+		SecretKey:          jwtConfig.Secret,
+		TokenExpire:        jwtConfig.AccessTokenTTL,
+		RefreshTokenExpire: jwtConfig.RefreshTokenTTL,
+		TokenIssuer:        jwtConfig.Issuer,
+		TokenSubject:       "auth",
+		TokenAudience:      jwtConfig.Audience,
 	}
 }
 
 type CustomClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *model.User) (string, error) {
-	config := DefaultJWTConfig()
+// GenerateToken issues a short-lived access token for user, bound to the
+// session it is refreshed through.
+func GenerateToken(user *model.User, sessionID string) (string, error) {
+	jwtConfig := DefaultJWTConfig()
 	claims := CustomClaims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.TokenExpire)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtConfig.TokenExpire)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    config.TokenIssuer,
-			Subject:   config.TokenIssuer,
-			Audience:  jwt.ClaimStrings{config.TokenAudience},
+			Issuer:    jwtConfig.TokenIssuer,
+			Subject:   jwtConfig.TokenIssuer,
+			Audience:  jwt.ClaimStrings{jwtConfig.TokenAudience},
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.SecretKey))
+	if jwtConfig.Algorithm == config.JWTAlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtConfig.SecretKey))
+	}
+	if signingKeys == nil {
+		return "", errSigningKeysNotLoaded
+	}
+	key, err := signingKeys.current(time.Now())
 	if err != nil {
 		return "", err
 	}
-	return tokenString, nil
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(jwtConfig.Algorithm), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.signer)
 }
 
+// ParseToken verifies tokenString and rejects it once its session has been
+// revoked, by logout or otherwise, even if it has not expired yet.
 func ParseToken(tokenString string) (*CustomClaims, error) {
-	config := DefaultJWTConfig()
+	jwtConfig := DefaultJWTConfig()
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(config.SecretKey), nil
-	})
+		if jwtConfig.Algorithm == config.JWTAlgorithmHS256 {
+			return []byte(jwtConfig.SecretKey), nil
+		}
+		if signingKeys == nil {
+			return nil, errSigningKeysNotLoaded
+		}
+		kid, _ := t.Header["kid"].(string)
+		return signingKeys.publicKey(kid)
+	}, jwt.WithValidMethods([]string{jwtConfig.Algorithm}))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	if claims.SessionID == "" {
+		return nil, finsysutils.ErrTokenRevoked
+	}
+	active, err := repository.NewSessionRepository(config.DB).IsActive(claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		return claims, nil
+	if !active {
+		return nil, finsysutils.ErrTokenRevoked
 	}
-	return nil, jwt.ErrSignatureInvalid
+	return claims, nil
 }
 
 func JWTAuth() app.HandlerFunc {
 	return func(ctx context.Context, c *app.RequestContext) {
-		tokenString := c.Request.Header.Get("Authorization")
+		tokenString := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if key, ok := requestAPIKey(c, tokenString); ok {
+			apiKey, user, err := authenticateAPIKey(key)
+			if err != nil {
+				c.JSON(consts.StatusForbidden, utils.H{
+					"code":    consts.StatusForbidden,
+					"message": "Forbidden",
+					"details": "Invalid, expired or revoked API key",
+				})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			c.Set("api_key_id", apiKey.ID)
+			c.Set("api_key_scopes", apiKey.ScopeList())
+			c.Next(ctx)
+			return
+		}
 		if tokenString == "" {
 			c.JSON(consts.StatusUnauthorized, utils.H{
 				"code":    consts.StatusUnauthorized,
@@ -83,9 +141,6 @@ func JWTAuth() app.HandlerFunc {
 			c.Abort()
 			return
 		}
-		if len(tokenString) > 0 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
-		}
 		claims, err := ParseToken(tokenString)
 		if err != nil {
 			c.JSON(consts.StatusForbidden, utils.H{
@@ -98,6 +153,7 @@ func JWTAuth() app.HandlerFunc {
 		}
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
 		c.Next(ctx)
 	}
 }
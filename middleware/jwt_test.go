@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/migration"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// setupJWT configures algorithm and a database holding the session "s1" of
+// the returned user.
+func setupJWT(t *testing.T, algorithm string) *model.User {
+	t.Helper()
+	dir := t.TempDir()
+	appConfig, _, err := config.Load([]string{
+		"-jwt.algorithm", algorithm,
+		"-jwt.secret", "test-secret-that-is-long-enough-for-hs256",
+		"-jwt.key_dir", dir,
+		"-database.path", filepath.Join(dir, "finsys.db"),
+		"-database.log_level", "silent",
+	})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	db, err := config.OpenDB(&appConfig.Database)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if _, err := migration.Up(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	previousDB := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = previousDB })
+	useSigningKeys(t, nil)
+	user := &model.User{Username: "alice", Password: "secret", Email: "alice@example.com", Role: model.RoleAnalyst}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session := &model.Session{ID: "s1", UserID: user.ID, RefreshHash: "x", ExpiresAt: time.Now().Add(time.Hour), LastUsedAt: time.Now()}
+	if err := db.Create(session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return user
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{config.JWTAlgorithmHS256, config.JWTAlgorithmRS256, config.JWTAlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			user := setupJWT(t, algorithm)
+			if algorithm != config.JWTAlgorithmHS256 {
+				keys := newTestKeySet(t, algorithm, config.Current().JWT.KeyDir)
+				if err := keys.refresh(time.Now()); err != nil {
+					t.Fatalf("refresh: %v", err)
+				}
+				useSigningKeys(t, keys)
+			}
+			token, err := GenerateToken(user, "s1")
+			if err != nil {
+				t.Fatalf("GenerateToken: %v", err)
+			}
+			claims, err := ParseToken(token)
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if claims.UserID != user.ID || claims.Username != user.Username || claims.SessionID != "s1" {
+				t.Errorf("token carries %+v", claims)
+			}
+			// Swap in claims for another user under the same signature.
+			parts := strings.Split(token, ".")
+			forged, _ := json.Marshal(map[string]interface{}{"user_id": user.ID + 1, "sid": "s1", "exp": time.Now().Add(time.Minute).Unix()})
+			parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+			if _, err := ParseToken(strings.Join(parts, ".")); err == nil {
+				t.Error("a tampered token was accepted")
+			}
+			if err := repository.NewSessionRepository(config.DB).Revoke("s1"); err != nil {
+				t.Fatalf("Revoke: %v", err)
+			}
+			if _, err := ParseToken(token); !errors.Is(err, utils.ErrTokenRevoked) {
+				t.Errorf("ParseToken after logout returned %v, want ErrTokenRevoked", err)
+			}
+		})
+	}
+}
+
+// TestTokenAcrossRotation checks that tokens signed before a rotation verify
+// until the old key is removed, and that the new key signs once published.
+func TestTokenAcrossRotation(t *testing.T) {
+	user := setupJWT(t, config.JWTAlgorithmEdDSA)
+	keys := newTestKeySet(t, config.JWTAlgorithmEdDSA, config.Current().JWT.KeyDir)
+	created := time.Now().Add(-keys.config.RotationInterval - keyActivationDelay)
+	if err := keys.refresh(created); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	useSigningKeys(t, keys)
+	old, err := GenerateToken(user, "s1")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if err := keys.refresh(time.Now()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	kids := keyIDs(keys)
+	if len(kids) != 2 {
+		t.Fatalf("rotation left %d keys, want 2", len(kids))
+	}
+	if _, err := ParseToken(old); err != nil {
+		t.Errorf("a token signed before the rotation was rejected: %v", err)
+	}
+	fresh, err := GenerateToken(user, "s1")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if kid := tokenKeyID(t, fresh); kid != kids[0] {
+		t.Errorf("a token was signed with %s before the new key was published", kid)
+	}
+
+	// Once the new key is published and the old key's tokens have expired,
+	// only the new key remains.
+	later := time.Now().Add(keyActivationDelay + keys.config.AccessTokenTTL + time.Second)
+	if err := keys.refresh(later); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := ParseToken(old); err == nil {
+		t.Error("a token signed with a removed key was accepted")
+	}
+	current, err := keys.current(later)
+	if err != nil {
+		t.Fatalf("current: %v", err)
+	}
+	if current.kid != kids[1] {
+		t.Errorf("signing with %s after the rotation, want %s", current.kid, kids[1])
+	}
+}
+
+func TestParseTokenRejectsOtherAlgorithms(t *testing.T) {
+	user := setupJWT(t, config.JWTAlgorithmRS256)
+	keys := newTestKeySet(t, config.JWTAlgorithmRS256, config.Current().JWT.KeyDir)
+	if err := keys.refresh(time.Now()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	useSigningKeys(t, keys)
+	claims := CustomClaims{UserID: user.ID, Username: user.Username, SessionID: "s1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+	}{
+		{"HS256 with the configured secret", jwt.SigningMethodHS256, []byte(config.Current().JWT.Secret)},
+		{"none", jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType},
+	}
+	for _, tt := range tests {
+		token := jwt.NewWithClaims(tt.method, claims)
+		token.Header["kid"] = keyIDs(keys)[0]
+		signed, err := token.SignedString(tt.key)
+		if err != nil {
+			t.Fatalf("%s: sign: %v", tt.name, err)
+		}
+		if _, err := ParseToken(signed); err == nil {
+			t.Errorf("%s: an RS256 deployment accepted the token", tt.name)
+		}
+	}
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &CustomClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+)
+
+const (
+	// keyReloadInterval is how often the key directory is re-read, so that
+	// instances sharing it pick up each other's rotations.
+	keyReloadInterval = time.Minute
+	// keyActivationDelay is how long a new key is published before it signs
+	// anything, so verifiers that cache the JWKS have fetched it by then.
+	keyActivationDelay = 10 * time.Minute
+	rsaKeyBits         = 2048
+)
+
+var errSigningKeysNotLoaded = errors.New("signing keys are not loaded")
+
+// JWK is the public half of a signing key, as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type signingKey struct {
+	kid       string
+	path      string
+	createdAt time.Time
+	signer    crypto.Signer
+}
+
+// KeySet holds the private keys in the key directory, oldest first. Each
+// file is named after the Unix time it was created.
+type KeySet struct {
+	mu     sync.RWMutex
+	config config.JWTConfig
+	keys   []*signingKey
+}
+
+var signingKeys *KeySet
+
+// InitSigningKeys loads or creates the signing keys for RS256 and EdDSA and
+// keeps rotating them in the background. HS256 needs no keys.
+func InitSigningKeys(jwtConfig *config.JWTConfig) error {
+	if jwtConfig.Algorithm == config.JWTAlgorithmHS256 {
+		return nil
+	}
+	if err := os.MkdirAll(jwtConfig.KeyDir, 0o700); err != nil {
+		return err
+	}
+	keys := &KeySet{config: *jwtConfig}
+	if err := keys.refresh(time.Now()); err != nil {
+		return err
+	}
+	signingKeys = keys
+	go func() {
+		for now := range time.Tick(keyReloadInterval) {
+			if err := keys.refresh(now); err != nil {
+				log.Printf("Fail to rotate signing keys: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// refresh re-reads the key directory, adds a key once the newest is due for
+// rotation, and deletes keys that no unexpired token can have been signed
+// with.
+func (s *KeySet) refresh(now time.Time) error {
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 || !now.Before(keys[len(keys)-1].createdAt.Add(s.config.RotationInterval)) {
+		key, err := s.generate(now)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	kept := make([]*signingKey, 0, len(keys))
+	for i, key := range keys {
+		if i+1 < len(keys) && now.After(keys[i+1].createdAt.Add(keyActivationDelay+s.config.AccessTokenTTL)) {
+			if err := os.Remove(key.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	s.mu.Lock()
+	s.keys = kept
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *KeySet) load() ([]*signingKey, error) {
+	paths, err := filepath.Glob(filepath.Join(s.config.KeyDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []*signingKey
+	for _, path := range paths {
+		created, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".pem"), 10, 64)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a PEM file", path)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		// Keys left over from another algorithm are ignored, not removed.
+		if !ok || !matchesAlgorithm(signer, s.config.Algorithm) {
+			continue
+		}
+		keys = append(keys, &signingKey{
+			kid:       thumbprint(signer.Public()),
+			path:      path,
+			createdAt: time.Unix(created, 0),
+			signer:    signer,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createdAt.Before(keys[j].createdAt)
+	})
+	return keys, nil
+}
+
+func (s *KeySet) generate(now time.Time) (*signingKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch s.config.Algorithm {
+	case config.JWTAlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case config.JWTAlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", s.config.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	// Write under a temporary name first so another instance never reads a
+	// half-written key.
+	path := filepath.Join(s.config.KeyDir, strconv.FormatInt(now.Unix(), 10)+".pem")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		kid:       thumbprint(signer.Public()),
+		path:      path,
+		createdAt: time.Unix(now.Unix(), 0),
+		signer:    signer,
+	}, nil
+}
+
+// current returns the newest key that has been published for long enough,
+// or the oldest key when none has yet, as on first start.
+func (s *KeySet) current(now time.Time) (*signingKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.keys) == 0 {
+		return nil, errSigningKeysNotLoaded
+	}
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].createdAt.Add(keyActivationDelay).After(now) {
+			return s.keys[i], nil
+		}
+	}
+	return s.keys[0], nil
+}
+
+func (s *KeySet) publicKey(kid string) (crypto.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.kid == kid {
+			return key.signer.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public keys tokens may currently be signed with. It is
+// empty for HS256, whose secret must never be published.
+func JWKS() []JWK {
+	jwks := []JWK{}
+	if signingKeys == nil {
+		return jwks
+	}
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+	for _, key := range signingKeys.keys {
+		jwk := publicJWK(key.signer.Public())
+		jwk.Kid = key.kid
+		jwk.Use = "sig"
+		jwk.Alg = signingKeys.config.Algorithm
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+func matchesAlgorithm(signer crypto.Signer, algorithm string) bool {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return algorithm == config.JWTAlgorithmRS256
+	case ed25519.PrivateKey:
+		return algorithm == config.JWTAlgorithmEdDSA
+	}
+	return false
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: encode(key)}
+	}
+	return JWK{}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint of public, used as its kid.
+func thumbprint(public crypto.PublicKey) string {
+	jwk := publicJWK(public)
+	var members string
+	if jwk.Kty == "RSA" {
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	} else {
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeySet(t *testing.T, algorithm, keyDir string) *KeySet {
+	t.Helper()
+	return &KeySet{config: config.JWTConfig{
+		Algorithm:        algorithm,
+		KeyDir:           keyDir,
+		RotationInterval: 24 * time.Hour,
+		AccessTokenTTL:   15 * time.Minute,
+	}}
+}
+
+// useSigningKeys makes keys the ones tokens are signed with for the rest of
+// the test.
+func useSigningKeys(t *testing.T, keys *KeySet) {
+	previous := signingKeys
+	signingKeys = keys
+	t.Cleanup(func() { signingKeys = previous })
+}
+
+func keyIDs(keys *KeySet) []string {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	var kids []string
+	for _, key := range keys.keys {
+		kids = append(kids, key.kid)
+	}
+	return kids
+}
+
+func TestKeySetRotation(t *testing.T) {
+	for _, algorithm := range []string{config.JWTAlgorithmRS256, config.JWTAlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys := newTestKeySet(t, algorithm, t.TempDir())
+			start := time.Unix(1700000000, 0)
+			if err := keys.refresh(start); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			first := keyIDs(keys)
+			if len(first) != 1 {
+				t.Fatalf("a new key directory holds %d keys, want 1", len(first))
+			}
+			rotated := start.Add(keys.config.RotationInterval)
+			tests := []struct {
+				name     string
+				now      time.Time
+				wantKeys int
+				// wantCurrent is the index into the keys so far of the key
+				// tokens are signed with.
+				wantCurrent int
+			}{
+				{"before rotation", start.Add(time.Hour), 1, 0},
+				{"rotated", rotated, 2, 0},
+				{"new key published", rotated.Add(keyActivationDelay), 2, 1},
+				{"old tokens expired", rotated.Add(keyActivationDelay + keys.config.AccessTokenTTL + time.Second), 1, 1},
+			}
+			var all []string
+			for _, tt := range tests {
+				if err := keys.refresh(tt.now); err != nil {
+					t.Fatalf("%s: refresh: %v", tt.name, err)
+				}
+				kids := keyIDs(keys)
+				for _, kid := range kids {
+					if !slices.Contains(all, kid) {
+						all = append(all, kid)
+					}
+				}
+				if len(kids) != tt.wantKeys {
+					t.Errorf("%s: %d keys are kept, want %d", tt.name, len(kids), tt.wantKeys)
+				}
+				current, err := keys.current(tt.now)
+				if err != nil {
+					t.Fatalf("%s: current: %v", tt.name, err)
+				}
+				if current.kid != all[tt.wantCurrent] {
+					t.Errorf("%s: signing with key %s, want %s", tt.name, current.kid, all[tt.wantCurrent])
+				}
+			}
+			if all[0] != first[0] || len(all) != 2 {
+				t.Fatalf("rotation went through keys %v", all)
+			}
+			if _, err := keys.publicKey(all[0]); err == nil {
+				t.Error("the removed key still verifies tokens")
+			}
+			entries, err := os.ReadDir(keys.config.KeyDir)
+			if err != nil {
+				t.Fatalf("read key directory: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("the key directory holds %d files, want 1", len(entries))
+			}
+		})
+	}
+}
+
+// TestKeySetShared checks that instances sharing a key directory sign with the
+// same keys instead of each adding its own.
+func TestKeySetShared(t *testing.T) {
+	keyDir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+	first := newTestKeySet(t, config.JWTAlgorithmEdDSA, keyDir)
+	second := newTestKeySet(t, config.JWTAlgorithmEdDSA, keyDir)
+	for _, keys := range []*KeySet{first, second} {
+		if err := keys.refresh(now); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+	}
+	a, b := keyIDs(first), keyIDs(second)
+	if len(a) != 1 || len(b) != 1 || a[0] != b[0] {
+		t.Errorf("instances sharing a key directory hold keys %v and %v", a, b)
+	}
+	// Keys of another algorithm are left alone.
+	other := newTestKeySet(t, config.JWTAlgorithmRS256, keyDir)
+	if err := other.refresh(now.Add(time.Second)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if err := first.refresh(now.Add(time.Second)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if kids := keyIDs(first); len(kids) != 1 || kids[0] != a[0] {
+		t.Errorf("an RS256 key changed the EdDSA keys to %v", kids)
+	}
+}
+
+// TestJWKS checks that every published key verifies the tokens signed with it.
+func TestJWKS(t *testing.T) {
+	useSigningKeys(t, nil)
+	if jwks := JWKS(); len(jwks) != 0 {
+		t.Errorf("JWKS without signing keys returned %d keys", len(jwks))
+	}
+	for _, algorithm := range []string{config.JWTAlgorithmRS256, config.JWTAlgorithmEdDSA} {
+		keys := newTestKeySet(t, algorithm, t.TempDir())
+		start := time.Unix(1700000000, 0)
+		if err := keys.refresh(start); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if err := keys.refresh(start.Add(keys.config.RotationInterval)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		useSigningKeys(t, keys)
+		jwks := JWKS()
+		if len(jwks) != 2 {
+			t.Fatalf("%s: JWKS returned %d keys, want both", algorithm, len(jwks))
+		}
+		for i, key := range keys.keys {
+			jwk := jwks[i]
+			if jwk.Kid != key.kid || jwk.Alg != algorithm || jwk.Use != "sig" {
+				t.Errorf("%s: JWK %d is %+v", algorithm, i, jwk)
+			}
+			token := jwt.NewWithClaims(jwt.GetSigningMethod(algorithm), jwt.MapClaims{"sub": "test"})
+			signed, err := token.SignedString(key.signer)
+			if err != nil {
+				t.Fatalf("%s: sign: %v", algorithm, err)
+			}
+			_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+				return jwkPublicKey(t, jwk), nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			if err != nil {
+				t.Errorf("%s: JWK %d does not verify its token: %v", algorithm, i, err)
+			}
+		}
+	}
+}
+
+// jwkPublicKey rebuilds a public key from its JWK, as a verifier would.
+func jwkPublicKey(t *testing.T, jwk JWK) crypto.PublicKey {
+	t.Helper()
+	switch jwk.Kty {
+	case "RSA":
+		e := new(big.Int).SetBytes(mustDecode(t, jwk.E))
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(mustDecode(t, jwk.N)), E: int(e.Int64())}
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			t.Fatalf("JWK curve is %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(mustDecode(t, jwk.X))
+	}
+	t.Fatalf("JWK type is %q", jwk.Kty)
+	return nil
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example key of RFC 7638, section 3.1.
+	n := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	key := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(mustDecode(t, n)),
+		E: 65537,
+	}
+	if got, want := thumbprint(key), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("thumbprint is %s, want %s", got, want)
+	}
+}
+
+func mustDecode(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
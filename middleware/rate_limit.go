@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// rateLimitSweepInterval is how often the memory store forgets buckets that
+// have refilled, which behave the same as a new bucket.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitStore keeps the token buckets. MemoryRateLimitStore only limits
+// the instance it runs in; instances behind a load balancer need a store they
+// share, such as Redis, for the limits to hold across them.
+type RateLimitStore interface {
+	// Take spends a token from the bucket named key. When the bucket is empty
+	// it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit config.Limit, now time.Time) (bool, time.Duration, error)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     config.Limit
+}
+
+// refill adds the tokens earned since the last update, up to the burst.
+func (b *tokenBucket) refill(now time.Time) {
+	perSecond := b.limit.RequestsPerMinute / 60
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*perSecond)
+	b.updatedAt = now
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit config.Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.sweptAt) >= rateLimitSweepInterval {
+		s.sweep(now)
+	}
+	bucket, ok := s.buckets[key]
+	if !ok || bucket.limit != limit {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updatedAt: now, limit: limit}
+		s.buckets[key] = bucket
+	}
+	bucket.refill(now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	wait := (1 - bucket.tokens) / (limit.RequestsPerMinute / 60)
+	return false, time.Duration(wait * float64(time.Second)), nil
+}
+
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.sweptAt = now
+}
+
+// RateLimiter builds the rate limiting middleware for each route group.
+type RateLimiter struct {
+	store   RateLimitStore
+	enabled bool
+}
+
+func NewRateLimiter(store RateLimitStore, rateLimitConfig *config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		store:   store,
+		enabled: rateLimitConfig.Enabled,
+	}
+}
+
+// Limit allows each principal, a user or an API key, limit requests through
+// the group named name, answering 429 with Retry-After beyond that. It must
+// run after JWTAuth. If the store fails the request is let through, so that
+// an outage of a shared store does not take the API down with it.
+func (l *RateLimiter) Limit(name string, limit config.Limit) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !l.enabled || limit.RequestsPerMinute <= 0 {
+			c.Next(ctx)
+			return
+		}
+		key := "ratelimit:" + name + ":" + principal(c)
+		allowed, retryAfter, err := l.store.Take(ctx, key, limit, time.Now())
+		if err != nil {
+			log.Printf("Fail to check rate limit %s: %v", key, err)
+			c.Next(ctx)
+			return
+		}
+		if !allowed {
+			seconds := int64(math.Ceil(retryAfter.Seconds()))
+			c.Response.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+			c.JSON(consts.StatusTooManyRequests, utils.H{
+				"code":    consts.StatusTooManyRequests,
+				"message": "Too Many Requests",
+				"details": fmt.Sprintf("Rate limit exceeded, retry in %d seconds", seconds),
+			})
+			c.Abort()
+			return
+		}
+		c.Next(ctx)
+	}
+}
+
+// principal names who a request counts against. Each API key has its own
+// limit, separate from its user's.
+func principal(c *app.RequestContext) string {
+	if keyID, ok := c.Get("api_key_id"); ok {
+		return fmt.Sprintf("key:%d", keyID)
+	}
+	userID, _ := c.Get("user_id")
+	return fmt.Sprintf("user:%v", userID)
+}
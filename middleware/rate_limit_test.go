@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/cloudwego/hertz/pkg/app"
+	hertzconfig "github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	// One request a second, up to two at once.
+	limit := config.Limit{RequestsPerMinute: 60, Burst: 2}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		after       time.Duration
+		key         string
+		wantAllowed bool
+		wantWait    time.Duration
+	}{
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", false, time.Second},
+		{0, "b", true, 0},
+		{500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+		{time.Second, "a", true, 0},
+		{time.Second, "a", false, time.Second},
+		// The bucket refills no further than the burst.
+		{time.Hour, "a", true, 0},
+		{time.Hour, "a", true, 0},
+		{time.Hour, "a", false, time.Second},
+	}
+	store := NewMemoryRateLimitStore()
+	for i, tt := range tests {
+		allowed, wait, err := store.Take(context.Background(), tt.key, limit, start.Add(tt.after))
+		if err != nil {
+			t.Fatalf("request %d: Take: %v", i, err)
+		}
+		if allowed != tt.wantAllowed || wait != tt.wantWait {
+			t.Errorf("request %d to %s after %v: Take returned %v, %v, want %v, %v",
+				i, tt.key, tt.after, allowed, wait, tt.wantAllowed, tt.wantWait)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreLimitChange(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+	strict := config.Limit{RequestsPerMinute: 1, Burst: 1}
+	if allowed, _, _ := store.Take(context.Background(), "a", strict, now); !allowed {
+		t.Fatal("first request was refused")
+	}
+	if allowed, _, _ := store.Take(context.Background(), "a", strict, now); allowed {
+		t.Fatal("second request was allowed beyond the burst")
+	}
+	// A changed limit starts a new, full bucket.
+	relaxed := config.Limit{RequestsPerMinute: 1, Burst: 5}
+	if allowed, _, _ := store.Take(context.Background(), "a", relaxed, now); !allowed {
+		t.Error("request under a raised limit was refused")
+	}
+}
+
+func TestMemoryRateLimitStoreSweep(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := config.Limit{RequestsPerMinute: 60, Burst: 2}
+	now := time.Now()
+	store.Take(context.Background(), "idle", limit, now)
+	store.Take(context.Background(), "busy", limit, now)
+	later := now.Add(rateLimitSweepInterval)
+	store.Take(context.Background(), "busy", limit, later.Add(-500*time.Millisecond))
+	store.Take(context.Background(), "busy", limit, later.Add(-500*time.Millisecond))
+	store.Take(context.Background(), "other", limit, later)
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("a refilled bucket survived the sweep")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("a bucket that has not refilled was swept")
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, config.Limit, time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("store is down")
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	limit := config.Limit{RequestsPerMinute: 30, Burst: 1}
+	tests := []struct {
+		name       string
+		store      RateLimitStore
+		enabled    bool
+		limit      config.Limit
+		wantStatus []int
+	}{
+		{"limited", NewMemoryRateLimitStore(), true, limit, []int{consts.StatusOK, consts.StatusTooManyRequests}},
+		{"disabled", NewMemoryRateLimitStore(), false, limit, []int{consts.StatusOK, consts.StatusOK}},
+		{"no limit", NewMemoryRateLimitStore(), true, config.Limit{}, []int{consts.StatusOK, consts.StatusOK}},
+		{"store down", failingRateLimitStore{}, true, limit, []int{consts.StatusOK, consts.StatusOK}},
+	}
+	for _, tt := range tests {
+		limiter := NewRateLimiter(tt.store, &config.RateLimitConfig{Enabled: tt.enabled})
+		engine := route.NewEngine(hertzconfig.NewOptions(nil))
+		engine.GET("/", func(ctx context.Context, c *app.RequestContext) {
+			c.Set("user_id", uint(1))
+			c.Next(ctx)
+		}, limiter.Limit("default", tt.limit), func(ctx context.Context, c *app.RequestContext) {
+			c.String(consts.StatusOK, "ok")
+		})
+		for i, want := range tt.wantStatus {
+			response := ut.PerformRequest(engine, consts.MethodGet, "/", nil).Result()
+			if response.StatusCode() != want {
+				t.Errorf("%s: request %d answered %d, want %d", tt.name, i, response.StatusCode(), want)
+			}
+			if want == consts.StatusTooManyRequests {
+				if retryAfter := string(response.Header.Peek("Retry-After")); retryAfter != "2" {
+					t.Errorf("%s: Retry-After is %q, want 2", tt.name, retryAfter)
+				}
+			}
+		}
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string]interface{}
+		want string
+	}{
+		{"user", map[string]interface{}{"user_id": uint(7)}, "user:7"},
+		{"API key", map[string]interface{}{"user_id": uint(7), "api_key_id": uint(3)}, "key:3"},
+	}
+	for _, tt := range tests {
+		c := app.NewContext(0)
+		for key, value := range tt.keys {
+			c.Set(key, value)
+		}
+		if got := principal(c); got != tt.want {
+			t.Errorf("%s: principal is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
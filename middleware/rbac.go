@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// RoutePermissions maps "METHOD /full/route/:param" to the permission the
+// route requires.
+type RoutePermissions map[string]string
+
+// Handle registers a route on group together with the permission it
+// requires.
+func (p RoutePermissions) Handle(group *route.RouterGroup, method, path, permission string, handlers ...app.HandlerFunc) {
+	p[method+" "+group.BasePath()+path] = permission
+	group.Handle(method, path, handlers...)
+}
+
+// Authorize checks the caller's role against the permission registered for
+// the matched route. Routes without a registered permission are denied. It
+// must run after JWTAuth. Requests made with an API key also need the
+// permission among the key's scopes.
+func Authorize(permissions RoutePermissions) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		permission, ok := permissions[string(c.Method())+" "+c.FullPath()]
+		if !ok {
+			forbidden(c, "No permission is defined for this route")
+			return
+		}
+		userID, exists := c.Get("user_id")
+		if !exists {
+			forbidden(c, "Invalid or expired token")
+			return
+		}
+		user, err := repository.NewUserRepository(config.DB).FindByID(userID.(uint))
+		if err != nil {
+			forbidden(c, "User does not exist")
+			return
+		}
+		if user.Disabled {
+			forbidden(c, "User is disabled")
+			return
+		}
+		if !model.HasPermission(user.Role, permission) {
+			forbidden(c, "Permission "+permission+" is required")
+			return
+		}
+		if scopes, ok := c.Get("api_key_scopes"); ok && !slices.Contains(scopes.([]string), permission) {
+			forbidden(c, "API key scope "+permission+" is required")
+			return
+		}
+		c.Set("role", user.Role)
+		c.Next(ctx)
+	}
+}
+
+func forbidden(c *app.RequestContext, details string) {
+	c.JSON(consts.StatusForbidden, utils.H{
+		"code":    consts.StatusForbidden,
+		"message": "Forbidden",
+		"details": details,
+	})
+	c.Abort()
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID takes the request ID from the X-Request-ID header, or generates
+// one, stores it as "request_id" and echoes it in the response.
+func RequestID() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		requestID := string(c.Request.Header.Peek(RequestIDHeader))
+		if requestID == "" || len(requestID) > 64 {
+			buf := make([]byte, 16)
+			_, _ = rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+		c.Set("request_id", requestID)
+		c.Response.Header.Set(RequestIDHeader, requestID)
+		c.Next(ctx)
+	}
+}
@@ -0,0 +1,141 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The baseline captures the schema as AutoMigrate left it. The tables are
+// declared here rather than taken from package model, so later model changes
+// do not alter what this migration creates. It uses AutoMigrate itself so that
+// databases created before migrations existed are adopted as they are.
+
+type baselineTransaction struct {
+	ID               uint      `gorm:"primary_key;index:idx_transactions_created_at_id,priority:2"`
+	Type             string    `gorm:"size:50;not null;index"`
+	Amount           float64   `gorm:"not null"`
+	NameOrig         string    `gorm:"size:50;not null;index"`
+	OldBalanceOrig   float64   `gorm:"not null"`
+	NewBalanceOrig   float64   `gorm:"not null"`
+	NameDest         string    `gorm:"size:50;not null;index"`
+	OldBalanceDest   float64   `gorm:"not null"`
+	NewBalanceDest   float64   `gorm:"not null"`
+	IsFraud          bool      `gorm:"default:false"`
+	FraudProbability float64   `gorm:"default:0"`
+	IsDeleted        bool      `gorm:"default:false"`
+	CreatedAt        time.Time `gorm:"index:idx_transactions_created_at_id,priority:1"`
+	UpdatedAt        time.Time
+	DeletedAt        time.Time `gorm:"index"`
+}
+
+func (baselineTransaction) TableName() string {
+	return "transactions"
+}
+
+type baselineUser struct {
+	ID        uint   `gorm:"primary_key"`
+	Username  string `gorm:"size:20;not null;uniqueIndex"`
+	Password  string `gorm:"size:100;not null"`
+	Email     string `gorm:"size:100;not null;uniqueIndex"`
+	IsAdmin   bool   `gorm:"default:false"`
+	IsDeleted bool   `gorm:"default:false"`
+	CreatedAt int64
+	UpdatedAt int64
+	DeletedAt int64 `gorm:"index"`
+}
+
+func (baselineUser) TableName() string {
+	return "users"
+}
+
+type baselineFraudReport struct {
+	ID            uint                `gorm:"primaryKey;index:idx_fraud_reports_generated_at_id,priority:2"`
+	TransactionID uint                `gorm:"index;not null"`
+	Transaction   baselineTransaction `gorm:"foreignKey:TransactionID"`
+	Report        string              `gorm:"type:text;not null"`
+	GeneratedAt   time.Time           `gorm:"index:idx_fraud_reports_generated_at_id,priority:1"`
+	UpdatedAt     time.Time
+	DeletedAt     time.Time
+}
+
+func (baselineFraudReport) TableName() string {
+	return "fraud_reports"
+}
+
+type baselineImportJob struct {
+	ID           uint   `gorm:"primaryKey"`
+	Filename     string `gorm:"size:255"`
+	SpoolPath    string `gorm:"size:500"`
+	Format       string `gorm:"size:20"`
+	ProfileID    uint   `gorm:"index"`
+	Mapping      string `gorm:"type:text"`
+	Status       string `gorm:"size:20;not null;index"`
+	DryRun       bool   `gorm:"default:false"`
+	TotalRows    int    `gorm:"default:0"`
+	AcceptedRows int    `gorm:"default:0"`
+	RejectedRows int    `gorm:"default:0"`
+	Checkpoint   int    `gorm:"default:0"`
+	BytesTotal   int64  `gorm:"default:0"`
+	BytesRead    int64  `gorm:"default:0"`
+	Errors       string `gorm:"type:text"`
+	Message      string `gorm:"type:text"`
+	CreatedBy    uint   `gorm:"index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+func (baselineImportJob) TableName() string {
+	return "import_jobs"
+}
+
+type baselineImportProfile struct {
+	ID                 uint   `gorm:"primaryKey"`
+	Name               string `gorm:"size:100;not null;uniqueIndex"`
+	Description        string `gorm:"size:500"`
+	Columns            string `gorm:"type:text"`
+	TypeValues         string `gorm:"type:text"`
+	TimestampColumn    string `gorm:"size:100"`
+	TimestampFormat    string `gorm:"size:100"`
+	Timezone           string `gorm:"size:100"`
+	DecimalSeparator   string `gorm:"size:1"`
+	ThousandsSeparator string `gorm:"size:1"`
+	CreatedBy          uint   `gorm:"index"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (baselineImportProfile) TableName() string {
+	return "import_profiles"
+}
+
+func baselineTables() []interface{} {
+	return []interface{}{
+		&baselineTransaction{},
+		&baselineUser{},
+		&baselineFraudReport{},
+		&baselineImportJob{},
+		&baselineImportProfile{},
+	}
+}
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baselineTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := baselineTables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
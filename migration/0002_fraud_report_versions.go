@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type fraudReportVersion struct {
+	ID            uint   `gorm:"primaryKey"`
+	FraudReportID uint   `gorm:"not null;uniqueIndex:idx_fraud_report_versions_report_version,priority:1"`
+	Version       int    `gorm:"not null;uniqueIndex:idx_fraud_report_versions_report_version,priority:2"`
+	Generator     string `gorm:"size:100"`
+	InputSnapshot string `gorm:"type:text"`
+	Content       string `gorm:"type:text;not null"`
+	AuthorID      uint   `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+func (fraudReportVersion) TableName() string {
+	return "fraud_report_versions"
+}
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "fraud_report_versions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&fraudReportVersion{}); err != nil {
+				return err
+			}
+			// Existing reports become version 1. Reports whose body lives in
+			// MongoDB have an empty report column and already have versions
+			// there.
+			return tx.Exec(`INSERT INTO fraud_report_versions (fraud_report_id, version, generator, input_snapshot, content, author_id, created_at)
+				SELECT id, 1, 'legacy', '', report, 0, updated_at FROM fraud_reports WHERE report <> ''`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&fraudReportVersion{})
+		},
+	})
+}
@@ -0,0 +1,39 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	ActorID   uint      `gorm:"index"`
+	Action    string    `gorm:"size:20;not null;index"`
+	Entity    string    `gorm:"size:50;not null;index:idx_audit_logs_entity,priority:1"`
+	EntityID  uint      `gorm:"index:idx_audit_logs_entity,priority:2"`
+	Before    string    `gorm:"type:text"`
+	After     string    `gorm:"type:text"`
+	RequestID string    `gorm:"size:64"`
+	IP        string    `gorm:"size:64"`
+	CreatedAt time.Time `gorm:"index"`
+	PrevHash  string    `gorm:"size:64"`
+	Hash      string    `gorm:"size:64;not null;uniqueIndex"`
+}
+
+func (auditLog) TableName() string {
+	return "audit_logs"
+}
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "audit_logs",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&auditLog{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditLog{})
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package migration
+
+import "gorm.io/gorm"
+
+type userRole struct {
+	Role string `gorm:"size:20;not null;default:viewer;index"`
+}
+
+func (userRole) TableName() string {
+	return "users"
+}
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "user_roles",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&userRole{}, "Role"); err != nil {
+				return err
+			}
+			// Administrators keep full access. Everyone else could already
+			// create and edit records, so they start as analysts rather than
+			// read-only viewers. is_admin is no longer read but stays, since
+			// SQLite drops a column by rebuilding the table without its
+			// indexes.
+			if err := tx.Exec(`UPDATE users SET role = CASE WHEN is_admin THEN 'admin' ELSE 'analyst' END`).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&userRole{}, "Role")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec(`UPDATE users SET is_admin = (role = 'admin')`).Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&userRole{}, "Role"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&userRole{}, "Role"); err != nil {
+				return err
+			}
+			for _, index := range []string{"Username", "Email", "DeletedAt"} {
+				if !tx.Migrator().HasIndex(&baselineUser{}, index) {
+					if err := tx.Migrator().CreateIndex(&baselineUser{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type session struct {
+	ID          string `gorm:"primaryKey;size:32"`
+	UserID      uint   `gorm:"not null;index"`
+	RefreshHash string `gorm:"size:64;not null"`
+	IP          string `gorm:"size:64"`
+	UserAgent   string `gorm:"size:255"`
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+	RevokedAt   *time.Time
+}
+
+func (session) TableName() string {
+	return "sessions"
+}
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&session{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&session{})
+		},
+	})
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userIdentity struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null;index"`
+	Issuer      string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject,priority:1"`
+	Subject     string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject,priority:2"`
+	Email       string `gorm:"size:100"`
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+func (userIdentity) TableName() string {
+	return "user_identities"
+}
+
+type oidcLogin struct {
+	State        string `gorm:"primaryKey;size:64"`
+	Nonce        string `gorm:"size:64;not null"`
+	CodeVerifier string `gorm:"size:128;not null"`
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+func (oidcLogin) TableName() string {
+	return "oidc_logins"
+}
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "oidc",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&userIdentity{}, &oidcLogin{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&userIdentity{}, &oidcLogin{})
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userTOTP struct {
+	UserID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Secret      string `gorm:"size:64;not null"`
+	ConfirmedAt *time.Time
+	LastStep    int64 `gorm:"not null;default:0"`
+	CreatedAt   time.Time
+}
+
+func (userTOTP) TableName() string {
+	return "user_totp"
+}
+
+type recoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (recoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+type mfaChallenge struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	UserID    uint   `gorm:"not null;index"`
+	IP        string `gorm:"size:64"`
+	UserAgent string `gorm:"size:255"`
+	Attempts  int    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (mfaChallenge) TableName() string {
+	return "mfa_challenges"
+}
+
+type rolePolicy struct {
+	Role        string `gorm:"primaryKey;size:20"`
+	RequireTOTP bool   `gorm:"not null;default:false"`
+	UpdatedAt   time.Time
+}
+
+func (rolePolicy) TableName() string {
+	return "role_policies"
+}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "totp",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&userTOTP{}, &recoveryCode{}, &mfaChallenge{}, &rolePolicy{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&userTOTP{}, &recoveryCode{}, &mfaChallenge{}, &rolePolicy{})
+		},
+	})
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type loginThrottle struct {
+	Target        string `gorm:"primaryKey;size:150"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+func (loginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+type securityEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	Type      string `gorm:"size:50;not null;index"`
+	Username  string `gorm:"size:100"`
+	UserID    uint   `gorm:"index"`
+	IP        string `gorm:"size:64"`
+	ActorID   uint
+	Details   string    `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (securityEvent) TableName() string {
+	return "security_events"
+}
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "login_security",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&loginThrottle{}, &securityEvent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&loginThrottle{}, &securityEvent{})
+		},
+	})
+}
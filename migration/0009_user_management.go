@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userAccountState struct {
+	Disabled      bool `gorm:"not null;default:false"`
+	EmailVerified bool `gorm:"not null;default:false"`
+}
+
+func (userAccountState) TableName() string {
+	return "users"
+}
+
+type userToken struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	UserID    uint   `gorm:"not null;index"`
+	Purpose   string `gorm:"size:30;not null"`
+	Email     string `gorm:"size:100"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+}
+
+func (userToken) TableName() string {
+	return "user_tokens"
+}
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "user_management",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"Disabled", "EmailVerified"} {
+				if err := tx.Migrator().AddColumn(&userAccountState{}, column); err != nil {
+					return err
+				}
+			}
+			// Existing users signed up before addresses were verified and
+			// keep being able to log in.
+			if err := tx.Exec(`UPDATE users SET email_verified = ?`, true).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&userToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&userToken{}); err != nil {
+				return err
+			}
+			for _, column := range []string{"Disabled", "EmailVerified"} {
+				if err := tx.Migrator().DropColumn(&userAccountState{}, column); err != nil {
+					return err
+				}
+			}
+			if err := restoreIndexes(tx, &baselineUser{}, "Username", "Email", "DeletedAt"); err != nil {
+				return err
+			}
+			return restoreIndexes(tx, &userRole{}, "Role")
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type apiKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"size:100;not null"`
+	Prefix     string `gorm:"size:20;not null;uniqueIndex"`
+	SecretHash string `gorm:"size:64;not null"`
+	UserID     uint   `gorm:"not null;index"`
+	Scopes     string `gorm:"size:1000;not null"`
+	CreatedBy  uint
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (apiKey) TableName() string {
+	return "api_keys"
+}
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "api_keys",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&apiKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&apiKey{})
+		},
+	})
+}
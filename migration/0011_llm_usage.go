@@ -0,0 +1,47 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type llmUsage struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserID           uint   `gorm:"not null;index:idx_llm_usage_user_created"`
+	Model            string `gorm:"size:50;not null"`
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	LatencyMs        int64
+	Cost             float64
+	CreatedAt        time.Time `gorm:"index:idx_llm_usage_user_created;index"`
+}
+
+func (llmUsage) TableName() string {
+	return "llm_usage"
+}
+
+type llmBudget struct {
+	Subject       string `gorm:"primaryKey;size:100"`
+	DailyTokens   int64  `gorm:"not null;default:0"`
+	MonthlyTokens int64  `gorm:"not null;default:0"`
+	UpdatedAt     time.Time
+}
+
+func (llmBudget) TableName() string {
+	return "llm_budgets"
+}
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "llm_usage",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&llmUsage{}, &llmBudget{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&llmUsage{}, &llmBudget{})
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+type sessionPreviousRefresh struct {
+	PreviousRefreshHash string `gorm:"size:64;not null;default:''"`
+}
+
+func (sessionPreviousRefresh) TableName() string {
+	return "sessions"
+}
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "session_refresh_reuse",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&sessionPreviousRefresh{}, "PreviousRefreshHash")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&sessionPreviousRefresh{}, "PreviousRefreshHash"); err != nil {
+				return err
+			}
+			return restoreIndexes(tx, &session{}, "UserID", "ExpiresAt")
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+type oidcLoginBinder struct {
+	BinderHash string `gorm:"size:64;not null;default:''"`
+}
+
+func (oidcLoginBinder) TableName() string {
+	return "oidc_logins"
+}
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "oidc_login_binder",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&oidcLoginBinder{}, "BinderHash")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&oidcLoginBinder{}, "BinderHash"); err != nil {
+				return err
+			}
+			return restoreIndexes(tx, &oidcLogin{}, "ExpiresAt")
+		},
+	})
+}
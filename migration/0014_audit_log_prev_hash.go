@@ -0,0 +1,26 @@
+package migration
+
+import "gorm.io/gorm"
+
+type auditLogPrevHash struct {
+	PrevHash string `gorm:"size:64;uniqueIndex"`
+}
+
+func (auditLogPrevHash) TableName() string {
+	return "audit_logs"
+}
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "audit_log_prev_hash",
+		// Only one entry may follow each entry, so appends racing from two
+		// processes cannot fork the chain.
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateIndex(&auditLogPrevHash{}, "PrevHash")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&auditLogPrevHash{}, "PrevHash")
+		},
+	})
+}
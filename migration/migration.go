@@ -0,0 +1,166 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered schema change. Up applies it and Down reverts
+// it; both run inside a database transaction where the database allows DDL
+// in one.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table.
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is the state of one known migration.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var migrations []Migration
+
+func register(m Migration) {
+	for _, existing := range migrations {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migration %d is registered twice", m.Version))
+		}
+	}
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+}
+
+// restoreIndexes recreates any of the named indexes of model that are
+// missing. SQLite drops a column by rebuilding the table without its indexes,
+// so a Down that drops columns puts back the ones the other migrations made.
+func restoreIndexes(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasIndex(model, field) {
+			continue
+		}
+		if err := tx.Migrator().CreateIndex(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrations returns every known migration in version order.
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// Up applies the pending migrations in order and returns the ones it ran.
+func Up(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones it reverted.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// Statuses reports whether each known migration has been applied.
+func Statuses(db *gorm.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		row, ok := done[m.Version]
+		statuses[i] = Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: row.AppliedAt}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func Pending(db *gorm.DB) ([]Migration, error) {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for i, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, migrations[i])
+		}
+	}
+	return pending, nil
+}
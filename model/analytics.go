@@ -0,0 +1,38 @@
+package model
+
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// VolumeBucket is the number and total amount of transactions of one type in
+// one time bucket. Bucket is the start of the UTC bucket, formatted as
+// "2006-01-02 15:00" for hours and "2006-01-02" for days and weeks.
+type VolumeBucket struct {
+	Bucket string  `json:"bucket"`
+	Type   string  `json:"type"`
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+type FraudRateBucket struct {
+	Bucket string  `json:"bucket"`
+	Total  int64   `json:"total"`
+	Fraud  int64   `json:"fraud"`
+	Rate   float64 `json:"rate" gorm:"-"`
+}
+
+// HistogramBin counts the transactions whose fraud probability lies in
+// [Lower, Upper); the last bin also includes Upper.
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int64   `json:"count"`
+}
+
+type AccountTotal struct {
+	Name   string  `json:"name"`
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+}
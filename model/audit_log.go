@@ -0,0 +1,82 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+
+	AuditEntityTransaction   = "transaction"
+	AuditEntityFraudReport   = "fraud_report"
+	AuditEntityImportProfile = "import_profile"
+	AuditEntityUser          = "user"
+	AuditEntityRolePolicy    = "role_policy"
+	AuditEntityAPIKey        = "api_key"
+	AuditEntityLLMBudget     = "llm_budget"
+)
+
+// AuditLog records one change to an entity. Each entry carries the hash of
+// the entry before it, so editing or removing a stored entry breaks the chain
+// from that point on. PrevHash is unique, so the chain cannot fork.
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ActorID   uint      `json:"actorId" gorm:"index"`
+	Action    string    `json:"action" gorm:"size:20;not null;index"`
+	Entity    string    `json:"entity" gorm:"size:50;not null;index:idx_audit_logs_entity,priority:1"`
+	EntityID  uint      `json:"entityId" gorm:"index:idx_audit_logs_entity,priority:2"`
+	Before    string    `json:"-" gorm:"type:text"`
+	After     string    `json:"-" gorm:"type:text"`
+	RequestID string    `json:"requestId" gorm:"size:64"`
+	IP        string    `json:"ip" gorm:"size:64"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+	PrevHash  string    `json:"prevHash" gorm:"size:64;uniqueIndex"`
+	Hash      string    `json:"hash" gorm:"size:64;not null;uniqueIndex"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// ComputeHash returns the SHA-256 of the entry's content and PrevHash. The
+// timestamp is hashed in UTC at millisecond precision, which every supported
+// database stores exactly.
+func (l *AuditLog) ComputeHash() string {
+	content, _ := json.Marshal([]interface{}{
+		l.PrevHash,
+		l.ActorID,
+		l.Action,
+		l.Entity,
+		l.EntityID,
+		l.Before,
+		l.After,
+		l.RequestID,
+		l.IP,
+		l.CreatedAt.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Actor identifies who made a change and from which request. Role is set on
+// routes that require a permission.
+type Actor struct {
+	UserID    uint
+	Role      string
+	RequestID string
+	IP        string
+}
+
+type AuditFilter struct {
+	ActorID   *uint
+	Action    string
+	Entity    string
+	EntityID  *uint
+	StartTime *time.Time
+	EndTime   *time.Time
+}
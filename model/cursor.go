@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// PageCursor is the position of the last row of a page in keyset pagination.
+// The next page starts strictly after it in (time, id) order.
+type PageCursor struct {
+	Time time.Time
+	ID   uint
+}
@@ -3,11 +3,11 @@ package model
 import "time"
 
 type FraudReport struct {
-	ID            uint        `json:"id" gorm:"primaryKey"`
+	ID            uint        `json:"id" gorm:"primaryKey;index:idx_fraud_reports_generated_at_id,priority:2"`
 	TransactionID uint        `json:"transaction_id" gorm:"index;not null"`
 	Transaction   Transaction `json:"-" gorm:"foreignKey:TransactionID"`
 	Report        string      `json:"report" gorm:"type:text;not null"`
-	GeneratedAt   time.Time   `json:"generated_at"`
+	GeneratedAt   time.Time   `json:"generated_at" gorm:"index:idx_fraud_reports_generated_at_id,priority:1"`
 	UpdatedAt     time.Time   `json:"updated_at"`
 	DeletedAt     time.Time   `json:"deleted_at"`
 }
@@ -15,3 +15,20 @@ type FraudReport struct {
 func (FraudReport) TableName() string {
 	return "fraud_reports"
 }
+
+// FraudReportVersion is one generation of a report. The report row holds the
+// latest content; every generation, including the first, is kept here.
+type FraudReportVersion struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	FraudReportID uint      `json:"fraud_report_id" gorm:"not null;uniqueIndex:idx_fraud_report_versions_report_version,priority:1"`
+	Version       int       `json:"version" gorm:"not null;uniqueIndex:idx_fraud_report_versions_report_version,priority:2"`
+	Generator     string    `json:"generator" gorm:"size:100"`
+	InputSnapshot string    `json:"input_snapshot" gorm:"type:text"`
+	Content       string    `json:"content" gorm:"type:text;not null"`
+	AuthorID      uint      `json:"author_id" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (FraudReportVersion) TableName() string {
+	return "fraud_report_versions"
+}
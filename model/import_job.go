@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+const (
+	ImportStatusQueued    = "queued"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+	ImportStatusCancelled = "cancelled"
+)
+
+type ImportJob struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Filename     string    `json:"filename" gorm:"size:255"`
+	SpoolPath    string    `json:"-" gorm:"size:500"`
+	Format       string    `json:"format" gorm:"size:20"`
+	ProfileID    uint      `json:"profileId" gorm:"index"`
+	Mapping      string    `json:"-" gorm:"type:text"`
+	Status       string    `json:"status" gorm:"size:20;not null;index"`
+	DryRun       bool      `json:"dryRun" gorm:"default:false"`
+	TotalRows    int       `json:"totalRows" gorm:"default:0"`
+	AcceptedRows int       `json:"acceptedRows" gorm:"default:0"`
+	RejectedRows int       `json:"rejectedRows" gorm:"default:0"`
+	Checkpoint   int       `json:"checkpoint" gorm:"default:0"`
+	BytesTotal   int64     `json:"bytesTotal" gorm:"default:0"`
+	BytesRead    int64     `json:"bytesRead" gorm:"default:0"`
+	Errors       string    `json:"-" gorm:"type:text"`
+	Message      string    `json:"message" gorm:"type:text"`
+	CreatedBy    uint      `json:"createdBy" gorm:"index"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	StartedAt    time.Time `json:"startedAt"`
+	FinishedAt   time.Time `json:"finishedAt"`
+}
+
+func (ImportJob) TableName() string {
+	return "import_jobs"
+}
+
+func (j *ImportJob) IsActive() bool {
+	return j.Status == ImportStatusQueued || j.Status == ImportStatusRunning
+}
+
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type ImportProfile struct {
+	ID                 uint              `json:"id" gorm:"primaryKey"`
+	Name               string            `json:"name" gorm:"size:100;not null;uniqueIndex"`
+	Description        string            `json:"description" gorm:"size:500"`
+	Columns            map[string]string `json:"columns" gorm:"type:text;serializer:json"`
+	TypeValues         map[string]string `json:"typeValues" gorm:"type:text;serializer:json"`
+	TimestampColumn    string            `json:"timestampColumn" gorm:"size:100"`
+	TimestampFormat    string            `json:"timestampFormat" gorm:"size:100"`
+	Timezone           string            `json:"timezone" gorm:"size:100"`
+	DecimalSeparator   string            `json:"decimalSeparator" gorm:"size:1"`
+	ThousandsSeparator string            `json:"thousandsSeparator" gorm:"size:1"`
+	CreatedBy          uint              `json:"createdBy" gorm:"index"`
+	CreatedAt          time.Time         `json:"createdAt"`
+	UpdatedAt          time.Time         `json:"updatedAt"`
+}
+
+func (ImportProfile) TableName() string {
+	return "import_profiles"
+}
@@ -18,11 +18,22 @@ type LLMMessage struct {
 	Content string `json:"content"`
 }
 
+// LLMChatRequest asks for a reply to Messages. MaxTokens caps the reply's
+// tokens when set.
 type LLMChatRequest struct {
-	Model    Model        `json:"model"`
-	Messages []LLMMessage `json:"messages"`
+	Model     Model        `json:"model"`
+	Messages  []LLMMessage `json:"messages"`
+	MaxTokens int64        `json:"max_tokens,omitempty"`
+}
+
+// LLMTokenUsage is what the provider reports a request used.
+type LLMTokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
 }
 
 type LLMChatResponse struct {
-	Content string `json:"content"`
+	Content string        `json:"content"`
+	Usage   LLMTokenUsage `json:"usage"`
 }
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+const (
+	LLMBudgetUserPrefix = "user:"
+	LLMBudgetRolePrefix = "role:"
+)
+
+// LLMUsage records the tokens one chat request used and what they are
+// estimated to have cost.
+type LLMUsage struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	UserID           uint      `json:"userId" gorm:"not null;index:idx_llm_usage_user_created"`
+	Model            Model     `json:"model" gorm:"size:50;not null"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+	TotalTokens      int64     `json:"totalTokens"`
+	LatencyMs        int64     `json:"latencyMs"`
+	Cost             float64   `json:"cost"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"index:idx_llm_usage_user_created;index"`
+}
+
+func (LLMUsage) TableName() string {
+	return "llm_usage"
+}
+
+// LLMBudget caps the tokens a user, or each user with a role, may use per
+// UTC day and month. Subject is "user:<id>" or "role:<role>"; a user's own
+// budget takes precedence over their role's. Zero means no limit.
+type LLMBudget struct {
+	Subject       string    `json:"subject" gorm:"primaryKey;size:100"`
+	DailyTokens   int64     `json:"dailyTokens" gorm:"not null;default:0"`
+	MonthlyTokens int64     `json:"monthlyTokens" gorm:"not null;default:0"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func (LLMBudget) TableName() string {
+	return "llm_budgets"
+}
+
+// LLMUsageSummary totals usage for one group of a usage report.
+type LLMUsageSummary struct {
+	Group            string  `json:"group" gorm:"column:group_key"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+const (
+	LLMUsageByUser  = "user"
+	LLMUsageByModel = "model"
+	LLMUsageByDay   = "day"
+)
+
+// LLMUsageFilter narrows a usage report. Zero values leave a field
+// unfiltered.
+type LLMUsageFilter struct {
+	UserID uint
+	From   time.Time
+	To     time.Time
+}
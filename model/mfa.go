@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// UserTOTP is a user's authenticator app secret. It is pending until the
+// user proves the app works by entering a code, and only then required at
+// login. LastStep is the time step of the last accepted code, which cannot
+// be used again.
+type UserTOTP struct {
+	UserID      uint       `json:"userId" gorm:"primaryKey;autoIncrement:false"`
+	Secret      string     `json:"-" gorm:"size:64;not null"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+	LastStep    int64      `json:"-" gorm:"not null;default:0"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// Enabled reports whether the secret has been confirmed.
+func (t *UserTOTP) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// RecoveryCode is a one-time code that stands in for an authenticator code
+// when the device is lost. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// MFAChallenge is a login that passed the password check and waits for a
+// second factor. ID is the hash of the challenge token handed to the client.
+type MFAChallenge struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	UserID    uint   `gorm:"not null;index"`
+	IP        string `gorm:"size:64"`
+	UserAgent string `gorm:"size:255"`
+	Attempts  int    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
+
+// RolePolicy holds the security settings administrators choose per role.
+// Roles without a row use the zero value.
+type RolePolicy struct {
+	Role        string    `json:"role" gorm:"primaryKey;size:20"`
+	RequireTOTP bool      `json:"requireTotp" gorm:"not null;default:false"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (RolePolicy) TableName() string {
+	return "role_policies"
+}
@@ -0,0 +1,96 @@
+package model
+
+const (
+	RoleViewer     = "viewer"
+	RoleAnalyst    = "analyst"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+const (
+	PermissionProfileRead        = "profile:read"
+	PermissionProfileWrite       = "profile:write"
+	PermissionSessionsManage     = "sessions:manage"
+	PermissionMFAManage          = "mfa:manage"
+	PermissionTransactionsRead   = "transactions:read"
+	PermissionTransactionsWrite  = "transactions:write"
+	PermissionTransactionsDelete = "transactions:delete"
+	PermissionTransactionsExport = "transactions:export"
+	PermissionTransactionsImport = "transactions:import"
+	PermissionImportProfilesRead = "import_profiles:read"
+	PermissionImportProfilesEdit = "import_profiles:write"
+	PermissionReportsRead        = "reports:read"
+	PermissionReportsWrite       = "reports:write"
+	PermissionReportsDelete      = "reports:delete"
+	PermissionReportsExport      = "reports:export"
+	PermissionAnalyticsRead      = "analytics:read"
+	PermissionChatUse            = "chat:use"
+	PermissionAuditRead          = "audit:read"
+	PermissionUsersManage        = "users:manage"
+)
+
+// Roles lists the roles from least to most privileged. Each role holds every
+// permission of the roles before it.
+var Roles = []string{RoleViewer, RoleAnalyst, RoleSupervisor, RoleAdmin}
+
+var rolePermissions = map[string][]string{
+	RoleViewer: {
+		PermissionProfileRead,
+		PermissionProfileWrite,
+		PermissionSessionsManage,
+		PermissionMFAManage,
+		PermissionTransactionsRead,
+		PermissionReportsRead,
+		PermissionAnalyticsRead,
+	},
+	RoleAnalyst: {
+		PermissionTransactionsWrite,
+		PermissionTransactionsExport,
+		PermissionTransactionsImport,
+		PermissionImportProfilesRead,
+		PermissionImportProfilesEdit,
+		PermissionReportsWrite,
+		PermissionReportsExport,
+		PermissionChatUse,
+	},
+	RoleSupervisor: {
+		PermissionTransactionsDelete,
+		PermissionReportsDelete,
+		PermissionAuditRead,
+	},
+	RoleAdmin: {
+		PermissionUsersManage,
+	},
+}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions returns every permission granted to role, including those
+// inherited from lower roles. Unknown roles have none.
+func RolePermissions(role string) []string {
+	if !ValidRole(role) {
+		return nil
+	}
+	var permissions []string
+	for _, r := range Roles {
+		permissions = append(permissions, rolePermissions[r]...)
+		if r == role {
+			break
+		}
+	}
+	return permissions
+}
+
+// HasPermission reports whether role grants permission.
+func HasPermission(role, permission string) bool {
+	for _, p := range RolePermissions(role) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+const (
+	SecurityEventAccountLocked = "account_locked"
+	SecurityEventIPLocked      = "ip_locked"
+	SecurityEventUnlocked      = "unlocked"
+)
+
+// LoginThrottle counts recent failed logins for one username or client IP.
+// Target is "user:" or "ip:" followed by the username or address. Usernames are
+// tracked whether or not the user exists, so locking does not reveal which
+// usernames are taken.
+type LoginThrottle struct {
+	Target        string     `json:"target" gorm:"primaryKey;size:150"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" gorm:"index"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// SecurityEvent is an entry in the security log: an account or IP being
+// locked out, or an administrator lifting a lock. UserID is zero when the
+// username does not belong to a user.
+type SecurityEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"size:50;not null;index"`
+	Username  string    `json:"username,omitempty" gorm:"size:100"`
+	UserID    uint      `json:"userId,omitempty" gorm:"index"`
+	IP        string    `json:"ip,omitempty" gorm:"size:64"`
+	ActorID   uint      `json:"actorId,omitempty"`
+	Details   string    `json:"details,omitempty" gorm:"size:255"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Session is one login. It holds the hash of the current refresh token, which
+// is replaced on every refresh, and of the token it replaced, so that replaying
+// an exchanged token can be told apart from a wrong one. Access tokens name the
+// session they were issued for so revoking it also cuts them off.
+type Session struct {
+	ID                  string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID              uint       `json:"userId" gorm:"not null;index"`
+	RefreshHash         string     `json:"-" gorm:"size:64;not null"`
+	PreviousRefreshHash string     `json:"-" gorm:"size:64;not null;default:''"`
+	IP                  string     `json:"ip" gorm:"size:64"`
+	UserAgent           string     `json:"userAgent" gorm:"size:255"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	LastUsedAt          time.Time  `json:"lastUsedAt"`
+	ExpiresAt           time.Time  `json:"expiresAt" gorm:"index"`
+	RevokedAt           *time.Time `json:"revokedAt,omitempty"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -3,7 +3,7 @@ package model
 import "time"
 
 type Transaction struct {
-	ID               uint      `json:"id" gorm:"primary_key"`
+	ID               uint      `json:"id" gorm:"primary_key;index:idx_transactions_created_at_id,priority:2"`
 	Type             string    `json:"type" gorm:"size:50;not null;index"`
 	Amount           float64   `json:"amount" gorm:"not null"`
 	NameOrig         string    `json:"nameOrig" gorm:"size:50;not null;index"`
@@ -15,7 +15,7 @@ type Transaction struct {
 	IsFraud          bool      `json:"isFraud" gorm:"default:false"`
 	FraudProbability float64   `json:"fraudProbability" gorm:"default:0"`
 	IsDeleted        bool      `json:"isDeleted" gorm:"default:false"`
-	CreatedAt        time.Time `json:"createdAt"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"index:idx_transactions_created_at_id,priority:1"`
 	UpdatedAt        time.Time `json:"updatedAt"`
 	DeletedAt        time.Time `json:"deletedAt" gorm:"index"`
 }
@@ -23,3 +23,23 @@ type Transaction struct {
 func (t *Transaction) TableName() string {
 	return "transactions"
 }
+
+type TransactionFilter struct {
+	Type           string
+	StartTime      *time.Time
+	EndTime        *time.Time
+	IsFraud        *bool
+	MinAmount      *float64
+	MaxAmount      *float64
+	NameOrig       string
+	NameOrigPrefix string
+	NameDest       string
+	NameDestPrefix string
+	MinProbability *float64
+	MaxProbability *float64
+	// Query is an expression in the filter language parsed by
+	// repository.ParseTransactionQuery, combined with the other fields by AND.
+	Query     string
+	SortBy    string
+	SortOrder string
+}
@@ -6,19 +6,31 @@ import (
 )
 
 type User struct {
-	ID        uint   `json:"id" gorm:"primary_key"`
-	Username  string `json:"username" gorm:"size:20;not null;uniqueIndex"`
-	Password  string `json:"password" gorm:"size:100;not null"`
-	Email     string `json:"email" gorm:"size:100;not null;uniqueIndex"`
-	IsAdmin   bool   `json:"isAdmin" gorm:"default:false"`
-	IsDeleted bool   `json:"isDeleted" gorm:"default:false"`
-	CreatedAt int64  `json:"createdAt"`
-	UpdatedAt int64  `json:"updatedAt"`
-	DeletedAt int64  `json:"deletedAt" gorm:"index"`
+	ID            uint   `json:"id" gorm:"primary_key"`
+	Username      string `json:"username" gorm:"size:20;not null;uniqueIndex"`
+	Password      string `json:"password" gorm:"size:100;not null"`
+	Email         string `json:"email" gorm:"size:100;not null;uniqueIndex"`
+	Role          string `json:"role" gorm:"size:20;not null;default:viewer;index"`
+	Disabled      bool   `json:"disabled" gorm:"not null;default:false"`
+	EmailVerified bool   `json:"emailVerified" gorm:"not null;default:false"`
+	IsDeleted     bool   `json:"isDeleted" gorm:"default:false"`
+	CreatedAt     int64  `json:"createdAt"`
+	UpdatedAt     int64  `json:"updatedAt"`
+	DeletedAt     int64  `json:"deletedAt" gorm:"index"`
 }
 
+// UserFilter narrows a user listing. Query matches part of the username or
+// email.
+type UserFilter struct {
+	Query    string
+	Role     string
+	Disabled *bool
+}
+
+// BeforeSave hashes a plain-text password. Saving a loaded user leaves its
+// hash as it is.
 func (u *User) BeforeSave(tx *gorm.DB) (err error) {
-	if len(u.Password) > 60 {
+	if _, err := bcrypt.Cost([]byte(u.Password)); err == nil {
 		return nil
 	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an OpenID Connect provider,
+// identified by the provider's issuer and its subject for that account.
+type UserIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;index"`
+	Issuer      string    `json:"issuer" gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject,priority:1"`
+	Subject     string    `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject,priority:2"`
+	Email       string    `json:"email" gorm:"size:100"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCLogin is a login started at the provider and not yet completed. It is
+// looked up by the state parameter when the provider redirects back, and only
+// completes in the browser holding the binder whose hash it keeps.
+type OIDCLogin struct {
+	State        string `gorm:"primaryKey;size:64"`
+	Nonce        string `gorm:"size:64;not null"`
+	CodeVerifier string `gorm:"size:128;not null"`
+	BinderHash   string `gorm:"size:64;not null;default:''"`
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+func (OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
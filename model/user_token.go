@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	UserTokenEmailVerification = "email_verification"
+	UserTokenPasswordReset     = "password_reset"
+)
+
+// UserToken is a one-time token sent to a user by email. ID is the hash of
+// the token in the link. For email verification Email is the address being
+// verified, which becomes the user's email once it is.
+type UserToken struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	UserID    uint   `gorm:"not null;index"`
+	Purpose   string `gorm:"size:30;not null"`
+	Email     string `gorm:"size:100"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+}
+
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
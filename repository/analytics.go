@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"github.com/Mitsui515/finsys/model"
+)
+
+type AnalyticsRepository interface {
+	VolumeByType(bucket string, filter *model.TransactionFilter) ([]*model.VolumeBucket, error)
+	FraudRate(bucket string, filter *model.TransactionFilter) ([]*model.FraudRateBucket, error)
+	ProbabilityHistogram(bins int, filter *model.TransactionFilter) ([]int64, error)
+	TopAccounts(column string, limit int, filter *model.TransactionFilter) ([]*model.AccountTotal, error)
+}
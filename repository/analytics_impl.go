@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"strconv"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type AnalyticsRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAnalyticsRepository(db *gorm.DB) AnalyticsRepository {
+	return &AnalyticsRepositoryImpl{db: db}
+}
+
+func (r *AnalyticsRepositoryImpl) VolumeByType(bucket string, filter *model.TransactionFilter) ([]*model.VolumeBucket, error) {
+	expr, err := bucketExpression(r.db.Dialector.Name(), bucket)
+	if err != nil {
+		return nil, err
+	}
+	db, err := filterTransactions(r.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []*model.VolumeBucket
+	err = db.Select(expr + " AS bucket, type, COUNT(*) AS count, SUM(amount) AS amount").
+		Group("bucket, type").
+		Order("bucket, type").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (r *AnalyticsRepositoryImpl) FraudRate(bucket string, filter *model.TransactionFilter) ([]*model.FraudRateBucket, error) {
+	expr, err := bucketExpression(r.db.Dialector.Name(), bucket)
+	if err != nil {
+		return nil, err
+	}
+	db, err := filterTransactions(r.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []*model.FraudRateBucket
+	err = db.Select(expr + " AS bucket, COUNT(*) AS total, SUM(CASE WHEN is_fraud THEN 1 ELSE 0 END) AS fraud").
+		Group("bucket").
+		Order("bucket").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// ProbabilityHistogram counts the matching transactions in each of bins equal
+// width fraud probability bins over [0, 1].
+func (r *AnalyticsRepositoryImpl) ProbabilityHistogram(bins int, filter *model.TransactionFilter) ([]int64, error) {
+	db, err := filterTransactions(r.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	scaled := "fraud_probability * " + strconv.Itoa(bins)
+	switch r.db.Dialector.Name() {
+	case "sqlite":
+		// Probabilities are never negative, so truncation is the floor.
+		scaled = "CAST(" + scaled + " AS INTEGER)"
+	case "mysql":
+		scaled = "CAST(FLOOR(" + scaled + ") AS SIGNED)"
+	default:
+		scaled = "CAST(FLOOR(" + scaled + ") AS INTEGER)"
+	}
+	binExpr := "CASE WHEN fraud_probability >= 1 THEN " + strconv.Itoa(bins-1) + " ELSE " + scaled + " END"
+	var rows []struct {
+		Bin   int
+		Count int64
+	}
+	err = db.Select(binExpr+" AS bin, COUNT(*) AS count").
+		Where("fraud_probability >= ?", 0).
+		Group("bin").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int64, bins)
+	for _, row := range rows {
+		if row.Bin >= 0 && row.Bin < bins {
+			counts[row.Bin] = row.Count
+		}
+	}
+	return counts, nil
+}
+
+// TopAccounts returns the accounts in column, name_orig or name_dest, with
+// the largest total amount.
+func (r *AnalyticsRepositoryImpl) TopAccounts(column string, limit int, filter *model.TransactionFilter) ([]*model.AccountTotal, error) {
+	if column != "name_orig" && column != "name_dest" {
+		return nil, utils.ErrInvalidAccountSide
+	}
+	db, err := filterTransactions(r.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*model.AccountTotal
+	err = db.Select(column + " AS name, COUNT(*) AS count, SUM(amount) AS amount").
+		Group(column).
+		Order("amount DESC").
+		Limit(limit).
+		Scan(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// bucketExpression truncates created_at to the start of its bucket as text,
+// so that every dialect returns the same labels. Weeks start on Monday.
+func bucketExpression(dialect, bucket string) (string, error) {
+	formats := map[string]map[string]string{
+		"sqlite": {
+			model.BucketHour: "strftime('%Y-%m-%d %H:00', created_at)",
+			model.BucketDay:  "strftime('%Y-%m-%d', created_at)",
+			model.BucketWeek: "date(created_at, 'weekday 0', '-6 days')",
+		},
+		"mysql": {
+			model.BucketHour: "DATE_FORMAT(created_at, '%Y-%m-%d %H:00')",
+			model.BucketDay:  "DATE_FORMAT(created_at, '%Y-%m-%d')",
+			model.BucketWeek: "DATE_FORMAT(DATE_SUB(created_at, INTERVAL WEEKDAY(created_at) DAY), '%Y-%m-%d')",
+		},
+		"postgres": {
+			model.BucketHour: "to_char(date_trunc('hour', created_at), 'YYYY-MM-DD HH24:00')",
+			model.BucketDay:  "to_char(date_trunc('day', created_at), 'YYYY-MM-DD')",
+			model.BucketWeek: "to_char(date_trunc('week', created_at), 'YYYY-MM-DD')",
+		},
+	}
+	expr, ok := formats[dialect][bucket]
+	if !ok {
+		return "", utils.ErrInvalidAnalyticsBucket
+	}
+	return expr, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+func TestAnalyticsRepositoryBuckets(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		// 2024-01-01 is a Monday, so the 7th ends the first week.
+		fraud := newTestTransaction("C1", 10, testTime(1, 10))
+		fraud.IsFraud = true
+		createTestTransactions(t, db,
+			newTestTransaction("C1", 1, testTime(1, 9)),
+			fraud,
+			newTestTransaction("C1", 100, testTime(7, 23)),
+			newTestTransaction("C1", 1000, testTime(8, 0)),
+		)
+		repo := NewAnalyticsRepository(db)
+		for bucket, want := range map[string][]string{
+			model.BucketHour: {"2024-01-01 09:00", "2024-01-01 10:00", "2024-01-07 23:00", "2024-01-08 00:00"},
+			model.BucketDay:  {"2024-01-01", "2024-01-07", "2024-01-08"},
+			model.BucketWeek: {"2024-01-01", "2024-01-08"},
+		} {
+			buckets, err := repo.VolumeByType(bucket, nil)
+			if err != nil {
+				t.Fatalf("VolumeByType(%s): %v", bucket, err)
+			}
+			var got []string
+			for _, b := range buckets {
+				got = append(got, b.Bucket)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s buckets are %q, want %q", bucket, got, want)
+			}
+		}
+		rates, err := repo.FraudRate(model.BucketWeek, nil)
+		if err != nil {
+			t.Fatalf("FraudRate: %v", err)
+		}
+		if len(rates) != 2 || rates[0].Total != 3 || rates[0].Fraud != 1 || rates[1].Total != 1 || rates[1].Fraud != 0 {
+			t.Errorf("FraudRate returned %+v %+v", rates[0], rates[len(rates)-1])
+		}
+	})
+}
+
+func TestAnalyticsRepositoryProbabilityHistogram(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		var batch []model.Transaction
+		for _, probability := range []float64{0, 0.25, 0.5, 0.999, 1} {
+			transaction := newTestTransaction("C1", 1, testTime(1, 0))
+			transaction.FraudProbability = probability
+			batch = append(batch, transaction)
+		}
+		createTestTransactions(t, db, batch...)
+		counts, err := NewAnalyticsRepository(db).ProbabilityHistogram(4, nil)
+		if err != nil {
+			t.Fatalf("ProbabilityHistogram: %v", err)
+		}
+		if want := []int64{1, 1, 1, 2}; !reflect.DeepEqual(counts, want) {
+			t.Errorf("histogram is %v, want %v", counts, want)
+		}
+	})
+}
+
+func TestAnalyticsRepositoryTopAccounts(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		createTestTransactions(t, db,
+			newTestTransaction("C1", 5, testTime(1, 0)),
+			newTestTransaction("C2", 3, testTime(1, 0)),
+			newTestTransaction("C2", 4, testTime(1, 0)),
+		)
+		accounts, err := NewAnalyticsRepository(db).TopAccounts("name_orig", 1, nil)
+		if err != nil {
+			t.Fatalf("TopAccounts: %v", err)
+		}
+		if len(accounts) != 1 || accounts[0].Name != "C2" || accounts[0].Count != 2 || accounts[0].Amount != 7 {
+			t.Errorf("TopAccounts returned %+v", accounts)
+		}
+	})
+}
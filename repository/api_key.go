@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	FindByID(id uint) (*model.APIKey, error)
+	FindByPrefix(prefix string) (*model.APIKey, error)
+	List(page, size int, userID *uint) ([]*model.APIKey, int64, error)
+	Revoke(id uint, at time.Time) error
+	TouchLastUsed(id uint, at time.Time) error
+	WithTx(tx *gorm.DB) APIKeyRepository
+}
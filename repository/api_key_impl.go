@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+// lastUsedResolution is how stale LastUsedAt may get, so that a busy key does
+// not write on every request.
+const lastUsedResolution = time.Minute
+
+type APIKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &APIKeyRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *APIKeyRepositoryImpl) WithTx(tx *gorm.DB) APIKeyRepository {
+	return &APIKeyRepositoryImpl{db: tx}
+}
+
+func (r *APIKeyRepositoryImpl) Create(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *APIKeyRepositoryImpl) FindByID(id uint) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.Where("id = ?", id).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrAPIKeyNotExists
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepositoryImpl) FindByPrefix(prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepositoryImpl) List(page, size int, userID *uint) ([]*model.APIKey, int64, error) {
+	var keys []*model.APIKey
+	var total int64
+	db := r.db.Model(&model.APIKey{})
+	if userID != nil {
+		db = db.Where("user_id = ?", *userID)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * size
+	if err := db.Order("id DESC").Offset(offset).Limit(size).Find(&keys).Error; err != nil {
+		return nil, 0, err
+	}
+	return keys, total, nil
+}
+
+func (r *APIKeyRepositoryImpl) Revoke(id uint, at time.Time) error {
+	return r.db.Model(&model.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *APIKeyRepositoryImpl) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&model.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at.Add(-lastUsedResolution)).
+		Update("last_used_at", at).Error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type AuditLogRepository interface {
+	Append(entry *model.AuditLog) error
+	List(page, size int, filter *model.AuditFilter) ([]*model.AuditLog, int64, error)
+	FindByID(id uint) (*model.AuditLog, error)
+	Each(batchSize int, fn func(entries []*model.AuditLog) error) error
+	WithTx(tx *gorm.DB) AuditLogRepository
+}
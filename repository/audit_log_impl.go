@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditAppendMu serialises appends within the process. Across processes the
+// unique index on prev_hash lets only one entry follow the head, and an
+// append that loses the race retries on the new head. SQLite transactions
+// take the write lock when they begin, so there appends simply wait.
+var auditAppendMu sync.Mutex
+
+// maxAuditAppendAttempts bounds the retries of an append that keeps losing
+// the race for the head of the chain.
+const maxAuditAppendAttempts = 5
+
+type AuditLogRepositoryImpl struct {
+	db *gorm.DB
+	// inTx is set for repositories returned by WithTx, whose transaction
+	// already holds auditAppendMu.
+	inTx bool
+}
+
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &AuditLogRepositoryImpl{db: db}
+}
+
+// AuditedTransaction runs fn in a Transaction that may append audit entries
+// through WithTx(tx). It holds the append lock until the transaction ends, so
+// the entries are chained in commit order.
+func AuditedTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	auditAppendMu.Lock()
+	defer auditAppendMu.Unlock()
+	return Transaction(db, fn)
+}
+
+// WithTx returns a repository that appends in tx. tx must have been started
+// by AuditedTransaction.
+func (r *AuditLogRepositoryImpl) WithTx(tx *gorm.DB) AuditLogRepository {
+	return &AuditLogRepositoryImpl{db: tx, inTx: true}
+}
+
+// Append links entry to the newest entry and stores it.
+func (r *AuditLogRepositoryImpl) Append(entry *model.AuditLog) error {
+	if r.inTx {
+		return appendAuditLog(r.db, entry)
+	}
+	return AuditedTransaction(r.db, func(tx *gorm.DB) error {
+		return appendAuditLog(tx, entry)
+	})
+}
+
+// appendAuditLog links entry to the head of the chain in tx. Each attempt runs
+// in a savepoint, so that a conflict on prev_hash leaves tx usable for the
+// next one. The head is read with a locking read, which on MySQL also sees
+// entries committed after tx began.
+func appendAuditLog(tx *gorm.DB, entry *model.AuditLog) error {
+	for attempt := 1; ; attempt++ {
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			var last model.AuditLog
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id DESC").Limit(1).Find(&last).Error
+			if err != nil {
+				return err
+			}
+			entry.ID = 0
+			entry.PrevHash = last.Hash
+			entry.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+			entry.Hash = entry.ComputeHash()
+			return tx.Create(entry).Error
+		})
+		if err == nil || attempt == maxAuditAppendAttempts || !isDuplicateKey(tx, err) {
+			return err
+		}
+	}
+}
+
+func (r *AuditLogRepositoryImpl) List(page, size int, filter *model.AuditFilter) ([]*model.AuditLog, int64, error) {
+	var entries []*model.AuditLog
+	var total int64
+	db := r.db.Model(&model.AuditLog{})
+	if filter != nil {
+		if filter.ActorID != nil {
+			db = db.Where("actor_id = ?", *filter.ActorID)
+		}
+		if filter.Action != "" {
+			db = db.Where("action = ?", filter.Action)
+		}
+		if filter.Entity != "" {
+			db = db.Where("entity = ?", filter.Entity)
+		}
+		if filter.EntityID != nil {
+			db = db.Where("entity_id = ?", *filter.EntityID)
+		}
+		if filter.StartTime != nil {
+			db = db.Where("created_at >= ?", filter.StartTime)
+		}
+		if filter.EndTime != nil {
+			db = db.Where("created_at <= ?", filter.EndTime)
+		}
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * size
+	if err := db.Order("id DESC").Offset(offset).Limit(size).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+func (r *AuditLogRepositoryImpl) FindByID(id uint) (*model.AuditLog, error) {
+	var entry model.AuditLog
+	err := r.db.Where("id = ?", id).First(&entry).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrAuditLogNotExists
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Each streams the whole log to fn in batches, oldest first.
+func (r *AuditLogRepositoryImpl) Each(batchSize int, fn func(entries []*model.AuditLog) error) error {
+	var entries []*model.AuditLog
+	return r.db.FindInBatches(&entries, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(entries)
+	}).Error
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+func TestAuditLogRepositoryChainsConcurrentAppends(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewAuditLogRepository(db)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				entry := &model.AuditLog{Action: model.AuditActionCreate, Entity: "transaction", EntityID: uint(i + 1)}
+				if err := repo.Append(entry); err != nil {
+					t.Errorf("Append: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		verifyAuditChain(t, repo, 20)
+	})
+}
+
+// verifyAuditChain checks that the log holds want entries, each linked to
+// the one before it.
+func verifyAuditChain(t *testing.T, repo AuditLogRepository, want int) {
+	t.Helper()
+	var previous string
+	var count int
+	err := repo.Each(7, func(entries []*model.AuditLog) error {
+		for _, entry := range entries {
+			if entry.PrevHash != previous {
+				t.Errorf("entry %d follows %q, want %q", entry.ID, entry.PrevHash, previous)
+			}
+			if entry.Hash != entry.ComputeHash() {
+				t.Errorf("entry %d does not match its hash", entry.ID)
+			}
+			previous = entry.Hash
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	if count != want {
+		t.Errorf("log holds %d entries, want %d", count, want)
+	}
+}
+
+// TestAuditLogRepositoryChainsAppendsFromTwoHandles appends through two
+// connection pools, bypassing the in-process lock, as two servers would.
+func TestAuditLogRepositoryChainsAppendsFromTwoHandles(t *testing.T) {
+	forEachDatabaseConfig(t, func(t *testing.T, dbConfig *config.DatabaseConfig, db *gorm.DB) {
+		handles := []*gorm.DB{db, openTestHandle(t, dbConfig)}
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				entry := &model.AuditLog{Action: model.AuditActionCreate, Entity: "transaction", EntityID: uint(i + 1)}
+				err := handles[i%2].Transaction(func(tx *gorm.DB) error {
+					return appendAuditLog(tx, entry)
+				})
+				if err != nil {
+					t.Errorf("append: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		verifyAuditChain(t, NewAuditLogRepository(db), 20)
+		fork := &model.AuditLog{Action: model.AuditActionCreate, Entity: "transaction", PrevHash: "", Hash: "fork"}
+		if err := db.Create(fork).Error; err == nil {
+			t.Error("a second entry following the empty head was stored despite the unique index")
+		}
+	})
+}
+
+func TestAuditedTransactionRollsBackEntries(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewAuditLogRepository(db)
+		failure := errors.New("rolled back")
+		err := AuditedTransaction(db, func(tx *gorm.DB) error {
+			entry := &model.AuditLog{Action: model.AuditActionCreate, Entity: "transaction", EntityID: 1}
+			if err := repo.WithTx(tx).Append(entry); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("AuditedTransaction returned %v", err)
+		}
+		_, total, err := repo.List(1, 10, nil)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if total != 0 {
+			t.Errorf("%d entries survived the rollback", total)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm/clause"
+)
+
+// keysetAfter selects the rows that come after cursor when ordering by
+// (timeColumn, id). It is written out as OR/AND rather than a row value
+// comparison so that every supported database can use the index on it.
+func keysetAfter(timeColumn string, cursor *model.PageCursor, desc bool) clause.Expression {
+	column := clause.Column{Name: timeColumn}
+	id := clause.Column{Name: "id"}
+	if desc {
+		return clause.Or(
+			clause.Lt{Column: column, Value: cursor.Time},
+			clause.And(clause.Eq{Column: column, Value: cursor.Time}, clause.Lt{Column: id, Value: cursor.ID}),
+		)
+	}
+	return clause.Or(
+		clause.Gt{Column: column, Value: cursor.Time},
+		clause.And(clause.Eq{Column: column, Value: cursor.Time}, clause.Gt{Column: id, Value: cursor.ID}),
+	)
+}
+
+func keysetOrder(timeColumn string, desc bool) clause.OrderBy {
+	return clause.OrderBy{Columns: []clause.OrderByColumn{
+		{Column: clause.Column{Name: timeColumn}, Desc: desc},
+		{Column: clause.Column{Name: "id"}, Desc: desc},
+	}}
+}
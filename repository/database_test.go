@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/migration"
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+// The suite always runs against SQLite. Setting these variables to the DSN of
+// a disposable database runs it against Postgres or MySQL as well; every test
+// migrates that database down to nothing and back up.
+const (
+	testPostgresDSNEnv = "FINSYS_TEST_POSTGRES_DSN"
+	testMySQLDSNEnv    = "FINSYS_TEST_MYSQL_DSN"
+)
+
+func testDatabases(t *testing.T) []config.DatabaseConfig {
+	sqlite := *config.DefaultDBConfig()
+	sqlite.Path = filepath.Join(t.TempDir(), "finsys.db")
+	databases := []config.DatabaseConfig{sqlite}
+	for dbType, env := range map[string]string{"postgres": testPostgresDSNEnv, "mysql": testMySQLDSNEnv} {
+		if dsn := os.Getenv(env); dsn != "" {
+			database := *config.DefaultDBConfig()
+			database.Type = dbType
+			database.DSN = dsn
+			databases = append(databases, database)
+		}
+	}
+	return databases
+}
+
+// forEachDatabase runs fn as a subtest against each test database, migrated
+// from scratch.
+func forEachDatabase(t *testing.T, fn func(t *testing.T, db *gorm.DB)) {
+	forEachDatabaseConfig(t, func(t *testing.T, _ *config.DatabaseConfig, db *gorm.DB) {
+		fn(t, db)
+	})
+}
+
+// forEachDatabaseConfig is forEachDatabase for tests that open further
+// handles on the database with openTestHandle.
+func forEachDatabaseConfig(t *testing.T, fn func(t *testing.T, dbConfig *config.DatabaseConfig, db *gorm.DB)) {
+	for _, dbConfig := range testDatabases(t) {
+		dbConfig := dbConfig
+		t.Run(dbConfig.Type, func(t *testing.T) {
+			fn(t, &dbConfig, openTestDB(t, &dbConfig))
+		})
+	}
+}
+
+// openTestHandle opens a connection pool of its own on the database, as
+// another process would.
+func openTestHandle(t *testing.T, dbConfig *config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	dbConfig.LogLevel = "silent"
+	db, err := config.OpenDB(dbConfig)
+	if err != nil {
+		t.Fatalf("open %s: %v", dbConfig.Type, err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// openTestDB empties the database and applies every migration.
+func openTestDB(t *testing.T, dbConfig *config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db := openTestHandle(t, dbConfig)
+	if _, err := migration.Down(db, len(migration.Migrations())); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if _, err := migration.Up(db); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return db
+}
+
+// testTime is a fixed instant, truncated to what every database stores.
+func testTime(day, hour int) time.Time {
+	return time.Date(2024, time.January, day, hour, 30, 0, 0, time.UTC)
+}
+
+func newTestTransaction(nameOrig string, amount float64, createdAt time.Time) model.Transaction {
+	return model.Transaction{
+		Type:      "TRANSFER",
+		Amount:    amount,
+		NameOrig:  nameOrig,
+		NameDest:  "M100",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
+
+func createTestTransactions(t *testing.T, db *gorm.DB, transactions ...model.Transaction) []model.Transaction {
+	t.Helper()
+	if err := NewTransactionRepository(db).CreateBatch(transactions); err != nil {
+		t.Fatalf("create transactions: %v", err)
+	}
+	return transactions
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// errUntrackedTransaction is returned by repositories that write outside the
+// database when given a transaction not started by Transaction, since they
+// could not revert those writes if it rolled back.
+var errUntrackedTransaction = errors.New("transaction was not started by repository.Transaction")
+
+// isDuplicateKey reports whether err is a unique constraint violation, as
+// translated by the dialect of db.
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	translator, ok := db.Dialector.(gorm.ErrorTranslator)
+	return ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+}
@@ -2,13 +2,23 @@ package repository
 
 import (
 	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
 )
 
 type FraudReportRepository interface {
-	Create(report *model.FraudReport) error
-	Update(report *model.FraudReport) error
+	// Create and Update record the report content as a new version. A nil
+	// version stores the report alone, without history.
+	Create(report *model.FraudReport, version *model.FraudReportVersion) error
+	Update(report *model.FraudReport, version *model.FraudReportVersion) error
 	Delete(id uint) error
 	FindByID(id uint) (*model.FraudReport, error)
 	FindByTransactionID(transactionID uint) (*model.FraudReport, error)
 	List(page, size int) ([]*model.FraudReport, int64, error)
+	ListAfter(cursor *model.PageCursor, size int) ([]*model.FraudReport, error)
+	Count() (int64, error)
+	Each(batchSize int, fn func(reports []*model.FraudReport) error) error
+	ListVersions(reportID uint) ([]*model.FraudReportVersion, error)
+	FindVersion(reportID uint, version int) (*model.FraudReportVersion, error)
+	// WithTx returns a repository whose SQL queries run in tx.
+	WithTx(tx *gorm.DB) FraudReportRepository
 }
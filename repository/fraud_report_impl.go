@@ -6,7 +6,6 @@ import (
 
 	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/utils"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gorm.io/gorm"
 )
 
@@ -14,53 +13,65 @@ type FraudReportRepositoryImpl struct {
 	db *gorm.DB
 }
 
-type MongoReport struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty"`
-	FraudReportID uint               `bson:"fraud_report_id"`
-	Content       string             `bson:"content"`
-	CreatedAt     time.Time          `bson:"created_at"`
-	UpdatedAt     time.Time          `bson:"updated_at"`
-}
-
 func NewFraudReportRepository(db *gorm.DB) FraudReportRepository {
 	return &FraudReportRepositoryImpl{
 		db: db,
 	}
 }
 
-func (r *FraudReportRepositoryImpl) Create(report *model.FraudReport) error {
-	tx := r.db.Begin()
-	report.GeneratedAt = time.Now()
-	report.UpdatedAt = time.Now()
-	if err := tx.Create(report).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit().Error
+func (r *FraudReportRepositoryImpl) WithTx(tx *gorm.DB) FraudReportRepository {
+	return &FraudReportRepositoryImpl{db: tx}
 }
 
-func (r *FraudReportRepositoryImpl) Update(report *model.FraudReport) error {
+func (r *FraudReportRepositoryImpl) Create(report *model.FraudReport, version *model.FraudReportVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		report.GeneratedAt = time.Now()
+		report.UpdatedAt = time.Now()
+		if err := tx.Create(report).Error; err != nil {
+			return err
+		}
+		if version != nil {
+			return createVersion(tx, report, version, 1)
+		}
+		return nil
+	})
+}
+
+func (r *FraudReportRepositoryImpl) Update(report *model.FraudReport, version *model.FraudReportVersion) error {
 	_, err := r.FindByID(report.ID)
 	if err != nil {
 		return err
 	}
-	tx := r.db.Begin()
-	report.UpdatedAt = time.Now()
-	if err := tx.Save(report).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit().Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		report.UpdatedAt = time.Now()
+		if err := tx.Save(report).Error; err != nil {
+			return err
+		}
+		if version == nil {
+			return nil
+		}
+		var latest int
+		err := tx.Model(&model.FraudReportVersion{}).
+			Where("fraud_report_id = ?", report.ID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&latest).Error
+		if err != nil {
+			return err
+		}
+		return createVersion(tx, report, version, latest+1)
+	})
+}
+
+func createVersion(tx *gorm.DB, report *model.FraudReport, version *model.FraudReportVersion, number int) error {
+	version.FraudReportID = report.ID
+	version.Version = number
+	version.Content = report.Report
+	version.CreatedAt = report.UpdatedAt
+	return tx.Create(version).Error
 }
 
 func (r *FraudReportRepositoryImpl) Delete(id uint) error {
-	tx := r.db.Begin()
-	now := time.Now()
-	if err := tx.Model(&model.FraudReport{}).Where("id = ?", id).Update("deleted_at", now).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit().Error
+	return r.db.Model(&model.FraudReport{}).Where("id = ?", id).Update("deleted_at", time.Now()).Error
 }
 
 func (r *FraudReportRepositoryImpl) FindByID(id uint) (*model.FraudReport, error) {
@@ -101,3 +112,51 @@ func (r *FraudReportRepositoryImpl) List(page, size int) ([]*model.FraudReport,
 	}
 	return reports, count, nil
 }
+
+// ListAfter returns up to size reports following cursor, newest first by
+// (generated_at, id), or the first page when cursor is nil.
+func (r *FraudReportRepositoryImpl) ListAfter(cursor *model.PageCursor, size int) ([]*model.FraudReport, error) {
+	var reports []*model.FraudReport
+	db := r.db.Where("deleted_at = ?", time.Time{})
+	if cursor != nil {
+		db = db.Where(keysetAfter("generated_at", cursor, true))
+	}
+	if err := db.Order(keysetOrder("generated_at", true)).Limit(size).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *FraudReportRepositoryImpl) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.FraudReport{}).Where("deleted_at = ?", time.Time{}).Count(&count).Error
+	return count, err
+}
+
+// Each streams all fraud reports to fn in batches ordered by ID.
+func (r *FraudReportRepositoryImpl) Each(batchSize int, fn func(reports []*model.FraudReport) error) error {
+	var reports []*model.FraudReport
+	return r.db.Where("deleted_at = ?", time.Time{}).FindInBatches(&reports, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(reports)
+	}).Error
+}
+
+func (r *FraudReportRepositoryImpl) ListVersions(reportID uint) ([]*model.FraudReportVersion, error) {
+	var versions []*model.FraudReportVersion
+	if err := r.db.Where("fraud_report_id = ?", reportID).Order("version ASC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *FraudReportRepositoryImpl) FindVersion(reportID uint, version int) (*model.FraudReportVersion, error) {
+	var found model.FraudReportVersion
+	err := r.db.Where("fraud_report_id = ? AND version = ?", reportID, version).First(&found).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrReportVersionNotExists
+		}
+		return nil, err
+	}
+	return &found, nil
+}
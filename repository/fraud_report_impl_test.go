@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+func TestFraudReportRepositoryVersions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		transaction := createTestTransactions(t, db, newTestTransaction("C1", 1, testTime(1, 0)))[0]
+		repo := NewFraudReportRepository(db)
+		report := &model.FraudReport{TransactionID: transaction.ID, Report: "first"}
+		if err := repo.Create(report, &model.FraudReportVersion{Generator: "test"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		report.Report = "second"
+		if err := repo.Update(report, &model.FraudReportVersion{Generator: "test"}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		found, err := repo.FindByTransactionID(transaction.ID)
+		if err != nil {
+			t.Fatalf("FindByTransactionID: %v", err)
+		}
+		if found.ID != report.ID || found.Report != "second" {
+			t.Fatalf("FindByTransactionID returned %+v", found)
+		}
+		versions, err := repo.ListVersions(report.ID)
+		if err != nil {
+			t.Fatalf("ListVersions: %v", err)
+		}
+		if len(versions) != 2 {
+			t.Fatalf("ListVersions returned %d versions, want 2", len(versions))
+		}
+		first, err := repo.FindVersion(report.ID, 1)
+		if err != nil {
+			t.Fatalf("FindVersion: %v", err)
+		}
+		if first.Content != "first" {
+			t.Errorf("version 1 holds %q, want %q", first.Content, "first")
+		}
+		duplicate := &model.FraudReportVersion{FraudReportID: report.ID, Version: 2, Content: "again"}
+		if err := db.Create(duplicate).Error; err == nil {
+			t.Error("a second version 2 was stored despite the unique index")
+		}
+	})
+}
+
+func TestFraudReportRepositoryRollsBackInTx(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		transaction := createTestTransactions(t, db, newTestTransaction("C1", 1, testTime(1, 0)))[0]
+		failure := errors.New("rolled back")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			report := &model.FraudReport{TransactionID: transaction.ID, Report: "first"}
+			if err := NewFraudReportRepository(db).WithTx(tx).Create(report, &model.FraudReportVersion{}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Transaction returned %v", err)
+		}
+		if _, err := NewFraudReportRepository(db).FindByTransactionID(transaction.ID); !errors.Is(err, utils.ErrFraudReportNotExists) {
+			t.Fatalf("report survived the rollback: %v", err)
+		}
+		var versions int64
+		if err := db.Model(&model.FraudReportVersion{}).Count(&versions).Error; err != nil {
+			t.Fatalf("count versions: %v", err)
+		}
+		if versions != 0 {
+			t.Errorf("%d versions survived the rollback", versions)
+		}
+	})
+}
+
+func TestFraudReportRepositoryListAfter(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewFraudReportRepository(db)
+		transactions := createTestTransactions(t, db,
+			newTestTransaction("C1", 1, testTime(1, 0)),
+			newTestTransaction("C2", 1, testTime(1, 0)),
+			newTestTransaction("C3", 1, testTime(1, 0)),
+		)
+		for _, transaction := range transactions {
+			if err := repo.Create(&model.FraudReport{TransactionID: transaction.ID, Report: "r"}, nil); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		seen := make(map[uint]bool)
+		var cursor *model.PageCursor
+		for {
+			page, err := repo.ListAfter(cursor, 2)
+			if err != nil {
+				t.Fatalf("ListAfter: %v", err)
+			}
+			for _, report := range page {
+				if seen[report.ID] {
+					t.Fatalf("report %d was listed twice", report.ID)
+				}
+				seen[report.ID] = true
+			}
+			if len(page) < 2 {
+				break
+			}
+			last := page[len(page)-1]
+			cursor = &model.PageCursor{Time: last.GeneratedAt, ID: last.ID}
+		}
+		if len(seen) != 3 {
+			t.Errorf("cursor pages listed %d reports, want 3", len(seen))
+		}
+	})
+}
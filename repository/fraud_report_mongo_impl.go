@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+const (
+	mongoReportCollection = "fraud_reports"
+	mongoReportTimeout    = 10 * time.Second
+	// maxVersionInsertAttempts bounds the retries of a version insert that
+	// lost a race for its version number.
+	maxVersionInsertAttempts = 5
+)
+
+// MongoReport is one version of a report body. Every update inserts a new
+// document, so earlier versions stay available.
+type MongoReport struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	FraudReportID uint               `bson:"fraud_report_id"`
+	Version       int                `bson:"version"`
+	Generator     string             `bson:"generator,omitempty"`
+	InputSnapshot string             `bson:"input_snapshot,omitempty"`
+	AuthorID      uint               `bson:"author_id,omitempty"`
+	Content       string             `bson:"content"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+}
+
+func (d *MongoReport) toVersion() *model.FraudReportVersion {
+	return &model.FraudReportVersion{
+		FraudReportID: d.FraudReportID,
+		Version:       d.Version,
+		Generator:     d.Generator,
+		InputSnapshot: d.InputSnapshot,
+		Content:       d.Content,
+		AuthorID:      d.AuthorID,
+		CreatedAt:     d.CreatedAt,
+	}
+}
+
+// MongoFraudReportRepositoryImpl keeps report metadata in the SQL
+// fraud_reports table, with an empty report column, and the report bodies in
+// MongoDB.
+type MongoFraudReportRepositoryImpl struct {
+	sql      *FraudReportRepositoryImpl
+	contents *mongo.Collection
+	// inTx is set for repositories returned by WithTx, and undo is where they
+	// register the removal of bodies written for a transaction that may still
+	// roll back.
+	inTx bool
+	undo *txUndo
+}
+
+func NewMongoFraudReportRepository(db *gorm.DB, mongoDB *mongo.Database) FraudReportRepository {
+	return &MongoFraudReportRepositoryImpl{
+		sql:      &FraudReportRepositoryImpl{db: db},
+		contents: mongoDB.Collection(mongoReportCollection),
+	}
+}
+
+// EnsureMongoReportIndexes creates the index used to find the latest version
+// of a report. It is safe to call on every start.
+func EnsureMongoReportIndexes(mongoDB *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	_, err := mongoDB.Collection(mongoReportCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "fraud_report_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// WithTx returns a repository whose report metadata is written in tx. Report
+// bodies are written to MongoDB straight away and removed again if tx rolls
+// back, so tx must have been started by Transaction.
+func (r *MongoFraudReportRepositoryImpl) WithTx(tx *gorm.DB) FraudReportRepository {
+	return &MongoFraudReportRepositoryImpl{
+		sql:      &FraudReportRepositoryImpl{db: tx},
+		contents: r.contents,
+		inTx:     true,
+		undo:     txUndoOf(tx),
+	}
+}
+
+// inTransaction runs fn with a repository bound to a transaction, starting
+// one unless r already is.
+func (r *MongoFraudReportRepositoryImpl) inTransaction(fn func(r *MongoFraudReportRepositoryImpl) error) error {
+	if !r.inTx {
+		return Transaction(r.sql.db, func(tx *gorm.DB) error {
+			return fn(r.WithTx(tx).(*MongoFraudReportRepositoryImpl))
+		})
+	}
+	if r.undo == nil {
+		return errUntrackedTransaction
+	}
+	return fn(r)
+}
+
+func (r *MongoFraudReportRepositoryImpl) Create(report *model.FraudReport, version *model.FraudReportVersion) error {
+	return r.inTransaction(func(r *MongoFraudReportRepositoryImpl) error {
+		content := report.Report
+		report.Report = ""
+		err := r.sql.Create(report, nil)
+		report.Report = content
+		if err != nil {
+			return err
+		}
+		// The ID of a report whose creation was rolled back can be handed out
+		// again, so clear any body that failed to be removed with it.
+		if err := r.deleteBodies(report.ID); err != nil {
+			return err
+		}
+		return r.insertVersion(report, version, 1)
+	})
+}
+
+func (r *MongoFraudReportRepositoryImpl) Update(report *model.FraudReport, version *model.FraudReportVersion) error {
+	return r.inTransaction(func(r *MongoFraudReportRepositoryImpl) error {
+		content := report.Report
+		report.Report = ""
+		err := r.sql.Update(report, nil)
+		report.Report = content
+		if err != nil {
+			return err
+		}
+		return r.insertNextVersion(report, version)
+	})
+}
+
+// insertNextVersion stores the report body under the next version number.
+// Concurrent updates can read the same latest version; the unique index on
+// (fraud_report_id, version) rejects all but one insert, and the others retry
+// with the following number.
+func (r *MongoFraudReportRepositoryImpl) insertNextVersion(report *model.FraudReport, version *model.FraudReportVersion) error {
+	for attempt := 1; ; attempt++ {
+		latest, err := r.latestVersion(report.ID)
+		if err != nil {
+			return err
+		}
+		err = r.insertVersion(report, version, latest+1)
+		if !mongo.IsDuplicateKeyError(err) || attempt == maxVersionInsertAttempts {
+			return err
+		}
+	}
+}
+
+func (r *MongoFraudReportRepositoryImpl) Delete(id uint) error {
+	return r.sql.Delete(id)
+}
+
+func (r *MongoFraudReportRepositoryImpl) FindByID(id uint) (*model.FraudReport, error) {
+	report, err := r.sql.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return report, r.attachContents([]*model.FraudReport{report})
+}
+
+func (r *MongoFraudReportRepositoryImpl) FindByTransactionID(transactionID uint) (*model.FraudReport, error) {
+	report, err := r.sql.FindByTransactionID(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return report, r.attachContents([]*model.FraudReport{report})
+}
+
+func (r *MongoFraudReportRepositoryImpl) List(page, size int) ([]*model.FraudReport, int64, error) {
+	reports, count, err := r.sql.List(page, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reports, count, r.attachContents(reports)
+}
+
+func (r *MongoFraudReportRepositoryImpl) ListAfter(cursor *model.PageCursor, size int) ([]*model.FraudReport, error) {
+	reports, err := r.sql.ListAfter(cursor, size)
+	if err != nil {
+		return nil, err
+	}
+	return reports, r.attachContents(reports)
+}
+
+func (r *MongoFraudReportRepositoryImpl) Count() (int64, error) {
+	return r.sql.Count()
+}
+
+func (r *MongoFraudReportRepositoryImpl) Each(batchSize int, fn func(reports []*model.FraudReport) error) error {
+	return r.sql.Each(batchSize, func(reports []*model.FraudReport) error {
+		if err := r.attachContents(reports); err != nil {
+			return err
+		}
+		return fn(reports)
+	})
+}
+
+// insertVersion stores the report body as a new document, to be removed if
+// the transaction rolls back. The body is kept even when version is nil, since
+// MongoDB is the only place it lives.
+func (r *MongoFraudReportRepositoryImpl) insertVersion(report *model.FraudReport, version *model.FraudReportVersion, number int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	doc := MongoReport{
+		FraudReportID: report.ID,
+		Version:       number,
+		Content:       report.Report,
+		CreatedAt:     report.UpdatedAt,
+		UpdatedAt:     report.UpdatedAt,
+	}
+	if version != nil {
+		doc.Generator = version.Generator
+		doc.InputSnapshot = version.InputSnapshot
+		doc.AuthorID = version.AuthorID
+	}
+	result, err := r.contents.InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+	r.undo.add(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+		defer cancel()
+		_, err := r.contents.DeleteOne(ctx, bson.M{"_id": result.InsertedID})
+		return err
+	})
+	if version != nil {
+		*version = *doc.toVersion()
+	}
+	return nil
+}
+
+func (r *MongoFraudReportRepositoryImpl) deleteBodies(reportID uint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	_, err := r.contents.DeleteMany(ctx, bson.M{"fraud_report_id": reportID})
+	return err
+}
+
+func (r *MongoFraudReportRepositoryImpl) ListVersions(reportID uint) ([]*model.FraudReportVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	cursor, err := r.contents.Find(ctx,
+		bson.M{"fraud_report_id": reportID},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []MongoReport
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	versions := make([]*model.FraudReportVersion, len(docs))
+	for i := range docs {
+		versions[i] = docs[i].toVersion()
+	}
+	return versions, nil
+}
+
+func (r *MongoFraudReportRepositoryImpl) FindVersion(reportID uint, version int) (*model.FraudReportVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	var doc MongoReport
+	err := r.contents.FindOne(ctx, bson.M{"fraud_report_id": reportID, "version": version}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, utils.ErrReportVersionNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.toVersion(), nil
+}
+
+func (r *MongoFraudReportRepositoryImpl) latestVersion(id uint) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	var latest MongoReport
+	err := r.contents.FindOne(ctx,
+		bson.M{"fraud_report_id": id},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&latest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return latest.Version, nil
+}
+
+// attachContents fills in the latest body of each report with one query.
+func (r *MongoFraudReportRepositoryImpl) attachContents(reports []*model.FraudReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(reports))
+	for i, report := range reports {
+		ids[i] = report.ID
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mongoReportTimeout)
+	defer cancel()
+	cursor, err := r.contents.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"fraud_report_id": bson.M{"$in": ids}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "fraud_report_id", Value: 1}, {Key: "version", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$fraud_report_id", "content": bson.M{"$first": "$content"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var latest []struct {
+		FraudReportID uint   `bson:"_id"`
+		Content       string `bson:"content"`
+	}
+	if err := cursor.All(ctx, &latest); err != nil {
+		return err
+	}
+	contents := make(map[uint]string, len(latest))
+	for _, doc := range latest {
+		contents[doc.FraudReportID] = doc.Content
+	}
+	for _, report := range reports {
+		report.Report = contents[report.ID]
+	}
+	return nil
+}
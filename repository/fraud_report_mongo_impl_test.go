@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// testMongoURIEnv points the MongoDB report store tests at a mongod. They are
+// skipped without it; each test uses a database of its own and drops it.
+const testMongoURIEnv = "FINSYS_TEST_MONGO_URI"
+
+func openTestMongo(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv(testMongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", testMongoURIEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to mongodb: %v", err)
+	}
+	mongoDB := client.Database(fmt.Sprintf("finsys_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		mongoDB.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	if err := EnsureMongoReportIndexes(mongoDB); err != nil {
+		t.Fatalf("create mongodb indexes: %v", err)
+	}
+	return mongoDB
+}
+
+func countMongoBodies(t *testing.T, mongoDB *mongo.Database) int64 {
+	t.Helper()
+	count, err := mongoDB.Collection(mongoReportCollection).CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("count report bodies: %v", err)
+	}
+	return count
+}
+
+func TestMongoFraudReportRepositoryVersions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		mongoDB := openTestMongo(t)
+		transaction := createTestTransactions(t, db, newTestTransaction("C1", 1, testTime(1, 0)))[0]
+		repo := NewMongoFraudReportRepository(db, mongoDB)
+		report := &model.FraudReport{TransactionID: transaction.ID, Report: "first"}
+		if err := repo.Create(report, &model.FraudReportVersion{Generator: "test"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		report.Report = "second"
+		if err := repo.Update(report, &model.FraudReportVersion{Generator: "test"}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		found, err := repo.FindByTransactionID(transaction.ID)
+		if err != nil {
+			t.Fatalf("FindByTransactionID: %v", err)
+		}
+		if found.Report != "second" {
+			t.Errorf("FindByTransactionID returned %q, want %q", found.Report, "second")
+		}
+		versions, err := repo.ListVersions(report.ID)
+		if err != nil {
+			t.Fatalf("ListVersions: %v", err)
+		}
+		if len(versions) != 2 || versions[0].Content != "first" || versions[1].Version != 2 {
+			t.Errorf("ListVersions returned %d versions, want first and 2", len(versions))
+		}
+	})
+}
+
+// TestMongoFraudReportRepositoryRollsBackInTx checks that bodies written in a
+// transaction that rolls back are removed, including for a report ID that
+// SQLite hands out again afterwards.
+func TestMongoFraudReportRepositoryRollsBackInTx(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		mongoDB := openTestMongo(t)
+		transaction := createTestTransactions(t, db, newTestTransaction("C1", 1, testTime(1, 0)))[0]
+		repo := NewMongoFraudReportRepository(db, mongoDB)
+		failure := errors.New("rolled back")
+		err := Transaction(db, func(tx *gorm.DB) error {
+			report := &model.FraudReport{TransactionID: transaction.ID, Report: "discarded"}
+			if err := repo.WithTx(tx).Create(report, &model.FraudReportVersion{}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Transaction returned %v", err)
+		}
+		if _, err := repo.FindByTransactionID(transaction.ID); !errors.Is(err, utils.ErrFraudReportNotExists) {
+			t.Fatalf("report survived the rollback: %v", err)
+		}
+		if count := countMongoBodies(t, mongoDB); count != 0 {
+			t.Fatalf("%d bodies survived the rollback", count)
+		}
+
+		report := &model.FraudReport{TransactionID: transaction.ID, Report: "first"}
+		if err := repo.Create(report, nil); err != nil {
+			t.Fatalf("Create after the rollback: %v", err)
+		}
+		err = Transaction(db, func(tx *gorm.DB) error {
+			report.Report = "discarded"
+			if err := repo.WithTx(tx).Update(report, nil); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Transaction returned %v", err)
+		}
+		found, err := repo.FindByID(report.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.Report != "first" {
+			t.Errorf("report reads %q after a rolled back update, want %q", found.Report, "first")
+		}
+		if count := countMongoBodies(t, mongoDB); count != 1 {
+			t.Errorf("%d bodies are stored, want 1", count)
+		}
+	})
+}
+
+func TestMongoFraudReportRepositoryNeedsTrackedTx(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		mongoDB := openTestMongo(t)
+		transaction := createTestTransactions(t, db, newTestTransaction("C1", 1, testTime(1, 0)))[0]
+		repo := NewMongoFraudReportRepository(db, mongoDB)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return repo.WithTx(tx).Create(&model.FraudReport{TransactionID: transaction.ID, Report: "r"}, nil)
+		})
+		if !errors.Is(err, errUntrackedTransaction) {
+			t.Errorf("Create in a plain transaction returned %v, want errUntrackedTransaction", err)
+		}
+	})
+}
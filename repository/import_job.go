@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type ImportJobRepository interface {
+	Create(job *model.ImportJob) error
+	Update(job *model.ImportJob) error
+	FindByID(id uint) (*model.ImportJob, error)
+	FindByStatus(statuses ...string) ([]*model.ImportJob, error)
+	FindFinishedBefore(before time.Time, statuses ...string) ([]*model.ImportJob, error)
+	Requeue(id uint, statuses ...string) (bool, error)
+	ReleaseSpool(id uint, statuses ...string) (bool, error)
+	WithTx(tx *gorm.DB) ImportJobRepository
+}
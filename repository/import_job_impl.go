@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type ImportJobRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) ImportJobRepository {
+	return &ImportJobRepositoryImpl{db: db}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *ImportJobRepositoryImpl) WithTx(tx *gorm.DB) ImportJobRepository {
+	return &ImportJobRepositoryImpl{db: tx}
+}
+
+func (r *ImportJobRepositoryImpl) Create(job *model.ImportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *ImportJobRepositoryImpl) Update(job *model.ImportJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *ImportJobRepositoryImpl) FindByID(id uint) (*model.ImportJob, error) {
+	var job model.ImportJob
+	err := r.db.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrImportJobNotExists
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *ImportJobRepositoryImpl) FindByStatus(statuses ...string) ([]*model.ImportJob, error) {
+	var jobs []*model.ImportJob
+	err := r.db.Where("status IN ?", statuses).Order("id ASC").Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// FindFinishedBefore returns the jobs in one of statuses that finished before
+// the given time and still have a spooled upload.
+func (r *ImportJobRepositoryImpl) FindFinishedBefore(before time.Time, statuses ...string) ([]*model.ImportJob, error) {
+	var jobs []*model.ImportJob
+	err := r.db.Where("status IN ? AND finished_at < ? AND spool_path <> ''", statuses, before).
+		Order("id ASC").Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Requeue moves a job back to queued only if it is still in one of statuses
+// and keeps its spooled upload. It reports whether the job was requeued, so
+// concurrent callers cannot both restart the same job.
+func (r *ImportJobRepositoryImpl) Requeue(id uint, statuses ...string) (bool, error) {
+	result := r.db.Model(&model.ImportJob{}).
+		Where("id = ? AND status IN ? AND dry_run = ? AND spool_path <> ''", id, statuses, false).
+		Updates(map[string]interface{}{
+			"status":      model.ImportStatusQueued,
+			"message":     "",
+			"finished_at": time.Time{},
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseSpool clears the spool path of a job that is still in one of
+// statuses. It reports whether the path was cleared, in which case the caller
+// owns the spooled file and may delete it.
+func (r *ImportJobRepositoryImpl) ReleaseSpool(id uint, statuses ...string) (bool, error) {
+	result := r.db.Model(&model.ImportJob{}).
+		Where("id = ? AND status IN ? AND spool_path <> ''", id, statuses).
+		Update("spool_path", "")
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
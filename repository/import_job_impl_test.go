@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+func createTestImportJob(t *testing.T, db *gorm.DB, job *model.ImportJob) *model.ImportJob {
+	t.Helper()
+	if err := NewImportJobRepository(db).Create(job); err != nil {
+		t.Fatalf("create import job: %v", err)
+	}
+	return job
+}
+
+func TestImportJobRepositoryRequeueOnce(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewImportJobRepository(db)
+		job := createTestImportJob(t, db, &model.ImportJob{
+			Status:     model.ImportStatusFailed,
+			SpoolPath:  "/spool/1",
+			Message:    "failed",
+			FinishedAt: testTime(1, 0),
+		})
+		var requeued int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := repo.Requeue(job.ID, model.ImportStatusFailed, model.ImportStatusCancelled)
+				if err != nil {
+					t.Errorf("Requeue: %v", err)
+				}
+				if ok {
+					atomic.AddInt32(&requeued, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if requeued != 1 {
+			t.Fatalf("%d concurrent Requeue calls succeeded, want 1", requeued)
+		}
+		found, err := repo.FindByID(job.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.Status != model.ImportStatusQueued || found.Message != "" || !found.FinishedAt.IsZero() {
+			t.Errorf("requeued job is %s with message %q, finished at %v", found.Status, found.Message, found.FinishedAt)
+		}
+	})
+}
+
+func TestImportJobRepositoryRequeueNeedsSpool(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewImportJobRepository(db)
+		for _, job := range []*model.ImportJob{
+			{Status: model.ImportStatusFailed},
+			{Status: model.ImportStatusFailed, SpoolPath: "/spool/2", DryRun: true},
+			{Status: model.ImportStatusCompleted, SpoolPath: "/spool/3"},
+		} {
+			createTestImportJob(t, db, job)
+			ok, err := repo.Requeue(job.ID, model.ImportStatusFailed)
+			if err != nil {
+				t.Fatalf("Requeue: %v", err)
+			}
+			if ok {
+				t.Errorf("requeued a %s job with spool %q and dry run %v", job.Status, job.SpoolPath, job.DryRun)
+			}
+		}
+	})
+}
+
+func TestImportJobRepositorySpoolSweep(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewImportJobRepository(db)
+		old := createTestImportJob(t, db, &model.ImportJob{Status: model.ImportStatusFailed, SpoolPath: "/spool/old", FinishedAt: testTime(1, 0)})
+		createTestImportJob(t, db, &model.ImportJob{Status: model.ImportStatusFailed, SpoolPath: "/spool/new", FinishedAt: testTime(9, 0)})
+		createTestImportJob(t, db, &model.ImportJob{Status: model.ImportStatusFailed, FinishedAt: testTime(1, 0)})
+		createTestImportJob(t, db, &model.ImportJob{Status: model.ImportStatusRunning, SpoolPath: "/spool/running"})
+		jobs, err := repo.FindFinishedBefore(testTime(5, 0), model.ImportStatusFailed, model.ImportStatusCancelled)
+		if err != nil {
+			t.Fatalf("FindFinishedBefore: %v", err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != old.ID {
+			t.Fatalf("FindFinishedBefore returned %d jobs, want only job %d", len(jobs), old.ID)
+		}
+		if ok, err := repo.ReleaseSpool(old.ID, model.ImportStatusFailed); err != nil || !ok {
+			t.Fatalf("ReleaseSpool returned %v, %v", ok, err)
+		}
+		if ok, err := repo.ReleaseSpool(old.ID, model.ImportStatusFailed); err != nil || ok {
+			t.Fatalf("second ReleaseSpool returned %v, %v", ok, err)
+		}
+		jobs, err = repo.FindFinishedBefore(time.Now(), model.ImportStatusFailed)
+		if err != nil {
+			t.Fatalf("FindFinishedBefore: %v", err)
+		}
+		if len(jobs) != 1 || jobs[0].SpoolPath != "/spool/new" {
+			t.Errorf("FindFinishedBefore returned %d jobs after the release, want the new one", len(jobs))
+		}
+	})
+}
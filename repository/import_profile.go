@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type ImportProfileRepository interface {
+	Create(profile *model.ImportProfile) error
+	Update(profile *model.ImportProfile) error
+	Delete(id uint) error
+	FindByID(id uint) (*model.ImportProfile, error)
+	FindByName(name string) (*model.ImportProfile, error)
+	List() ([]*model.ImportProfile, error)
+	WithTx(tx *gorm.DB) ImportProfileRepository
+}
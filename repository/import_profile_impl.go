@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type ImportProfileRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewImportProfileRepository(db *gorm.DB) ImportProfileRepository {
+	return &ImportProfileRepositoryImpl{db: db}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *ImportProfileRepositoryImpl) WithTx(tx *gorm.DB) ImportProfileRepository {
+	return &ImportProfileRepositoryImpl{db: tx}
+}
+
+func (r *ImportProfileRepositoryImpl) Create(profile *model.ImportProfile) error {
+	return r.db.Create(profile).Error
+}
+
+func (r *ImportProfileRepositoryImpl) Update(profile *model.ImportProfile) error {
+	return r.db.Save(profile).Error
+}
+
+func (r *ImportProfileRepositoryImpl) Delete(id uint) error {
+	return r.db.Delete(&model.ImportProfile{}, id).Error
+}
+
+func (r *ImportProfileRepositoryImpl) FindByID(id uint) (*model.ImportProfile, error) {
+	var profile model.ImportProfile
+	err := r.db.Where("id = ?", id).First(&profile).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrImportProfileNotExists
+		}
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *ImportProfileRepositoryImpl) FindByName(name string) (*model.ImportProfile, error) {
+	var profile model.ImportProfile
+	err := r.db.Where("name = ?", name).First(&profile).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrImportProfileNotExists
+		}
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *ImportProfileRepositoryImpl) List() ([]*model.ImportProfile, error) {
+	var profiles []*model.ImportProfile
+	if err := r.db.Order("name ASC").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
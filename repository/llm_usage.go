@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type LLMUsageRepository interface {
+	Create(usage *model.LLMUsage) error
+	Reserve(usage *model.LLMUsage, check func(LLMUsageRepository) error) error
+	Update(usage *model.LLMUsage) error
+	Delete(id uint) error
+	SumTokens(userID uint, since time.Time) (int64, error)
+	Summarize(groupBy string, filter *model.LLMUsageFilter) ([]*model.LLMUsageSummary, error)
+	FindBudget(subject string) (*model.LLMBudget, error)
+	ListBudgets() ([]*model.LLMBudget, error)
+	SaveBudget(budget *model.LLMBudget) error
+	DeleteBudget(subject string) error
+	WithTx(tx *gorm.DB) LLMUsageRepository
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// llmReserveMu serialises reservations within the process. The lock taken on
+// the user's row in Reserve does the same across processes on databases that
+// support it.
+var llmReserveMu sync.Mutex
+
+type LLMUsageRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLLMUsageRepository(db *gorm.DB) LLMUsageRepository {
+	return &LLMUsageRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *LLMUsageRepositoryImpl) WithTx(tx *gorm.DB) LLMUsageRepository {
+	return &LLMUsageRepositoryImpl{db: tx}
+}
+
+func (r *LLMUsageRepositoryImpl) Create(usage *model.LLMUsage) error {
+	return r.db.Create(usage).Error
+}
+
+// Reserve stores usage if check, run against the same transaction, passes.
+// Reservations for one user are serialised, so check sees every reservation
+// made before it.
+func (r *LLMUsageRepositoryImpl) Reserve(usage *model.LLMUsage, check func(LLMUsageRepository) error) error {
+	llmReserveMu.Lock()
+	defer llmReserveMu.Unlock()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", usage.UserID).Find(&model.User{}).Error
+		if err != nil {
+			return err
+		}
+		if err := check(&LLMUsageRepositoryImpl{db: tx}); err != nil {
+			return err
+		}
+		return tx.Create(usage).Error
+	})
+}
+
+func (r *LLMUsageRepositoryImpl) Update(usage *model.LLMUsage) error {
+	return r.db.Save(usage).Error
+}
+
+func (r *LLMUsageRepositoryImpl) Delete(id uint) error {
+	return r.db.Delete(&model.LLMUsage{}, id).Error
+}
+
+func (r *LLMUsageRepositoryImpl) SumTokens(userID uint, since time.Time) (int64, error) {
+	var total int64
+	err := r.db.Model(&model.LLMUsage{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Select("COALESCE(SUM(total_tokens), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// Summarize totals the matching usage by user, model or UTC day.
+func (r *LLMUsageRepositoryImpl) Summarize(groupBy string, filter *model.LLMUsageFilter) ([]*model.LLMUsageSummary, error) {
+	var expr string
+	order := "total_tokens DESC"
+	switch groupBy {
+	case model.LLMUsageByUser:
+		expr = "user_id"
+	case model.LLMUsageByModel:
+		expr = "model"
+	case model.LLMUsageByDay:
+		day, err := bucketExpression(r.db.Dialector.Name(), model.BucketDay)
+		if err != nil {
+			return nil, err
+		}
+		expr = day
+		order = "group_key"
+	default:
+		return nil, utils.ErrInvalidUsageGroup
+	}
+	db := r.db.Model(&model.LLMUsage{})
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		db = db.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		db = db.Where("created_at < ?", filter.To)
+	}
+	var summaries []*model.LLMUsageSummary
+	err := db.Select(expr + " AS group_key, COUNT(*) AS requests, SUM(prompt_tokens) AS prompt_tokens, " +
+		"SUM(completion_tokens) AS completion_tokens, SUM(total_tokens) AS total_tokens, SUM(cost) AS cost").
+		Group(expr).
+		Order(order).
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// FindBudget returns the budget for subject, or nil when none is set.
+func (r *LLMUsageRepositoryImpl) FindBudget(subject string) (*model.LLMBudget, error) {
+	var budget model.LLMBudget
+	err := r.db.Where("subject = ?", subject).First(&budget).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func (r *LLMUsageRepositoryImpl) ListBudgets() ([]*model.LLMBudget, error) {
+	var budgets []*model.LLMBudget
+	err := r.db.Order("subject").Find(&budgets).Error
+	return budgets, err
+}
+
+func (r *LLMUsageRepositoryImpl) SaveBudget(budget *model.LLMBudget) error {
+	return r.db.Save(budget).Error
+}
+
+func (r *LLMUsageRepositoryImpl) DeleteBudget(subject string) error {
+	return r.db.Where("subject = ?", subject).Delete(&model.LLMBudget{}).Error
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type MFARepository interface {
+	FindTOTP(userID uint) (*model.UserTOTP, error)
+	SaveTOTP(totp *model.UserTOTP) error
+	ConfirmTOTP(userID uint, step int64, at time.Time) error
+	UseTOTPStep(userID uint, step int64) (bool, error)
+	DeleteTOTP(userID uint) error
+	ReplaceRecoveryCodes(userID uint, hashes []string, now time.Time) error
+	UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error)
+	CountRecoveryCodes(userID uint) (int64, error)
+	CreateChallenge(challenge *model.MFAChallenge) error
+	FindChallenge(id string, now time.Time) (*model.MFAChallenge, error)
+	FailChallenge(id string, maxAttempts int) error
+	ConsumeChallenge(id string) (bool, error)
+	WithTx(tx *gorm.DB) MFARepository
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type MFARepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &MFARepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *MFARepositoryImpl) WithTx(tx *gorm.DB) MFARepository {
+	return &MFARepositoryImpl{db: tx}
+}
+
+func (r *MFARepositoryImpl) FindTOTP(userID uint) (*model.UserTOTP, error) {
+	var totp model.UserTOTP
+	err := r.db.Where("user_id = ?", userID).First(&totp).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrTOTPNotEnrolled
+		}
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (r *MFARepositoryImpl) SaveTOTP(totp *model.UserTOTP) error {
+	return r.db.Save(totp).Error
+}
+
+func (r *MFARepositoryImpl) ConfirmTOTP(userID uint, step int64, at time.Time) error {
+	return r.db.Model(&model.UserTOTP{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"confirmed_at": at, "last_step": step}).Error
+}
+
+// UseTOTPStep records step as the last accepted one, unless a code from the
+// same or a later step got there first.
+func (r *MFARepositoryImpl) UseTOTPStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&model.UserTOTP{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteTOTP removes the secret together with the recovery codes.
+func (r *MFARepositoryImpl) DeleteTOTP(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserTOTP{}).Error
+	})
+}
+
+func (r *MFARepositoryImpl) ReplaceRecoveryCodes(userID uint, hashes []string, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = model.RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks the matching unused code as used, so each code works
+// once.
+func (r *MFARepositoryImpl) UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error) {
+	result := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MFARepositoryImpl) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateChallenge stores a pending challenge, clearing out abandoned ones
+// first.
+func (r *MFARepositoryImpl) CreateChallenge(challenge *model.MFAChallenge) error {
+	if err := r.db.Where("expires_at < ?", challenge.CreatedAt).Delete(&model.MFAChallenge{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(challenge).Error
+}
+
+func (r *MFARepositoryImpl) FindChallenge(id string, now time.Time) (*model.MFAChallenge, error) {
+	var challenge model.MFAChallenge
+	err := r.db.Where("id = ? AND expires_at > ?", id, now).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// FailChallenge counts a wrong code and deletes the challenge once it has
+// used up its attempts, so a code cannot be guessed within one login.
+func (r *MFARepositoryImpl) FailChallenge(id string, maxAttempts int) error {
+	err := r.db.Model(&model.MFAChallenge{}).Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		return err
+	}
+	return r.db.Where("id = ? AND attempts >= ?", id, maxAttempts).Delete(&model.MFAChallenge{}).Error
+}
+
+// ConsumeChallenge deletes the challenge and reports whether it was still
+// there, so each challenge completes at most one login.
+func (r *MFARepositoryImpl) ConsumeChallenge(id string) (bool, error) {
+	result := r.db.Where("id = ?", id).Delete(&model.MFAChallenge{})
+	return result.RowsAffected == 1, result.Error
+}
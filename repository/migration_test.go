@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/Mitsui515/finsys/migration"
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+// TestUserRolesMigration moves is_admin into roles with migration 0004 and
+// back, on a schema taken down to just before it. The columns are read with
+// plain SQL, since the model no longer has is_admin.
+func TestUserRolesMigration(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		var later int
+		for _, m := range migration.Migrations() {
+			if m.Version > 3 {
+				later++
+			}
+		}
+		if _, err := migration.Down(db, later); err != nil {
+			t.Fatalf("migrate down to 3: %v", err)
+		}
+		for name, isAdmin := range map[string]bool{"root": true, "alice": false} {
+			err := db.Exec("INSERT INTO users (username, password, email, is_admin) VALUES (?, ?, ?, ?)",
+				name, "x", name+"@example.com", isAdmin).Error
+			if err != nil {
+				t.Fatalf("insert user: %v", err)
+			}
+		}
+		if _, err := migration.Up(db); err != nil {
+			t.Fatalf("migrate up: %v", err)
+		}
+		for name, want := range map[string]string{"root": model.RoleAdmin, "alice": model.RoleAnalyst} {
+			var role string
+			if err := db.Table("users").Select("role").Where("username = ?", name).Row().Scan(&role); err != nil {
+				t.Fatalf("read role: %v", err)
+			}
+			if role != want {
+				t.Errorf("migration 0004 made %s %s, want %s", name, role, want)
+			}
+		}
+
+		if err := db.Exec("UPDATE users SET role = ? WHERE username = ?", model.RoleAdmin, "alice").Error; err != nil {
+			t.Fatalf("promote alice: %v", err)
+		}
+		if _, err := migration.Down(db, later); err != nil {
+			t.Fatalf("migrate down to 3: %v", err)
+		}
+		if db.Migrator().HasColumn("users", "role") {
+			t.Error("users.role survived migration 0004's Down")
+		}
+		for _, name := range []string{"root", "alice"} {
+			var isAdmin bool
+			if err := db.Table("users").Select("is_admin").Where("username = ?", name).Row().Scan(&isAdmin); err != nil {
+				t.Fatalf("read is_admin: %v", err)
+			}
+			if !isAdmin {
+				t.Errorf("%s is no longer an administrator after Down", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type RolePolicyRepository interface {
+	Find(role string) (*model.RolePolicy, error)
+	List() ([]*model.RolePolicy, error)
+	Save(policy *model.RolePolicy) error
+	WithTx(tx *gorm.DB) RolePolicyRepository
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type RolePolicyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRolePolicyRepository(db *gorm.DB) RolePolicyRepository {
+	return &RolePolicyRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *RolePolicyRepositoryImpl) WithTx(tx *gorm.DB) RolePolicyRepository {
+	return &RolePolicyRepositoryImpl{db: tx}
+}
+
+// Find returns the policy for role, or the default policy when none has been
+// saved.
+func (r *RolePolicyRepositoryImpl) Find(role string) (*model.RolePolicy, error) {
+	var policy model.RolePolicy
+	err := r.db.Where("role = ?", role).First(&policy).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &model.RolePolicy{Role: role}, nil
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *RolePolicyRepositoryImpl) List() ([]*model.RolePolicy, error) {
+	var policies []*model.RolePolicy
+	err := r.db.Find(&policies).Error
+	return policies, err
+}
+
+func (r *RolePolicyRepositoryImpl) Save(policy *model.RolePolicy) error {
+	return r.db.Save(policy).Error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+)
+
+type SecurityRepository interface {
+	FindThrottle(target string) (*model.LoginThrottle, error)
+	AddFailure(target string, now, windowStart time.Time) error
+	LockThrottle(target string, maxFailures int, until time.Time) (bool, error)
+	DeleteThrottle(target string) (bool, error)
+	ListLocked(now time.Time) ([]*model.LoginThrottle, error)
+	CreateEvent(event *model.SecurityEvent) error
+	ListEvents(page, size int, eventType string) ([]*model.SecurityEvent, int64, error)
+}
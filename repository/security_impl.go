@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SecurityRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewSecurityRepository(db *gorm.DB) SecurityRepository {
+	return &SecurityRepositoryImpl{
+		db: db,
+	}
+}
+
+// FindThrottle returns the failure count for target, or an empty one when there
+// have been no failures.
+func (r *SecurityRepositoryImpl) FindThrottle(target string) (*model.LoginThrottle, error) {
+	var throttle model.LoginThrottle
+	err := r.db.Where("target = ?", target).First(&throttle).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &model.LoginThrottle{Target: target}, nil
+		}
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// AddFailure counts a failure against target in a single statement, so
+// concurrent failures are never lost. The count starts over when the last
+// failure was before windowStart or a lock on target has expired. Every SET
+// expression reads only columns assigned after it, which keeps the statement
+// correct on MySQL too, where assignments see the columns already updated.
+func (r *SecurityRepositoryImpl) AddFailure(target string, now, windowStart time.Time) error {
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LoginThrottle{Target: target}).Error
+	if err != nil {
+		return err
+	}
+	restart := "(locked_until IS NOT NULL AND locked_until <= ?) OR last_failure_at < ?"
+	return r.db.Model(&model.LoginThrottle{}).Where("target = ?", target).Updates(map[string]interface{}{
+		"failures":        gorm.Expr("CASE WHEN "+restart+" THEN 1 ELSE failures + 1 END", now, windowStart),
+		"locked_until":    gorm.Expr("CASE WHEN "+restart+" THEN NULL ELSE locked_until END", now, windowStart),
+		"last_failure_at": now,
+	}).Error
+}
+
+// LockThrottle locks target until the given time once it has maxFailures
+// failures. It reports whether this call took the lock, so that only one of
+// several concurrent failures records it.
+func (r *SecurityRepositoryImpl) LockThrottle(target string, maxFailures int, until time.Time) (bool, error) {
+	result := r.db.Model(&model.LoginThrottle{}).
+		Where("target = ? AND locked_until IS NULL AND failures >= ?", target, maxFailures).
+		Update("locked_until", until)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *SecurityRepositoryImpl) DeleteThrottle(target string) (bool, error) {
+	result := r.db.Where("target = ?", target).Delete(&model.LoginThrottle{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *SecurityRepositoryImpl) ListLocked(now time.Time) ([]*model.LoginThrottle, error) {
+	var throttles []*model.LoginThrottle
+	err := r.db.Where("locked_until > ?", now).Order("locked_until DESC").Find(&throttles).Error
+	return throttles, err
+}
+
+func (r *SecurityRepositoryImpl) CreateEvent(event *model.SecurityEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *SecurityRepositoryImpl) ListEvents(page, size int, eventType string) ([]*model.SecurityEvent, int64, error) {
+	var events []*model.SecurityEvent
+	var total int64
+	db := r.db.Model(&model.SecurityEvent{})
+	if eventType != "" {
+		db = db.Where("type = ?", eventType)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * size
+	if err := db.Order("id DESC").Offset(offset).Limit(size).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestSecurityRepositoryCountsConcurrentFailures(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewSecurityRepository(db)
+		now := time.Now()
+		var locks int32
+		var wg sync.WaitGroup
+		for i := 0; i < 12; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := repo.AddFailure("user:alice", now, now.Add(-time.Hour)); err != nil {
+					t.Errorf("AddFailure: %v", err)
+					return
+				}
+				locked, err := repo.LockThrottle("user:alice", 5, now.Add(time.Hour))
+				if err != nil {
+					t.Errorf("LockThrottle: %v", err)
+				}
+				if locked {
+					atomic.AddInt32(&locks, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		throttle, err := repo.FindThrottle("user:alice")
+		if err != nil {
+			t.Fatalf("FindThrottle: %v", err)
+		}
+		if throttle.Failures != 12 || throttle.LockedUntil == nil {
+			t.Errorf("throttle has %d failures and lock %v, want 12 and a lock", throttle.Failures, throttle.LockedUntil)
+		}
+		if locks != 1 {
+			t.Errorf("%d failures took the lock, want 1", locks)
+		}
+	})
+}
+
+func TestSecurityRepositoryRestartsCount(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewSecurityRepository(db)
+		start := time.Now().Add(-2 * time.Hour)
+		for i := 0; i < 3; i++ {
+			if err := repo.AddFailure("ip:10.0.0.1", start, start.Add(-time.Hour)); err != nil {
+				t.Fatalf("AddFailure: %v", err)
+			}
+		}
+		if locked, err := repo.LockThrottle("ip:10.0.0.1", 3, start.Add(time.Hour)); err != nil || !locked {
+			t.Fatalf("LockThrottle returned %v, %v", locked, err)
+		}
+		// The lock has expired by now, so the next failure starts over.
+		now := time.Now()
+		if err := repo.AddFailure("ip:10.0.0.1", now, now.Add(-24*time.Hour)); err != nil {
+			t.Fatalf("AddFailure: %v", err)
+		}
+		throttle, err := repo.FindThrottle("ip:10.0.0.1")
+		if err != nil {
+			t.Fatalf("FindThrottle: %v", err)
+		}
+		if throttle.Failures != 1 || throttle.LockedUntil != nil {
+			t.Errorf("throttle has %d failures and lock %v after its lock expired, want 1 and none", throttle.Failures, throttle.LockedUntil)
+		}
+		// A failure outside the window starts over too.
+		if err := repo.AddFailure("ip:10.0.0.1", now.Add(2*time.Hour), now.Add(time.Hour)); err != nil {
+			t.Fatalf("AddFailure: %v", err)
+		}
+		if throttle, err = repo.FindThrottle("ip:10.0.0.1"); err != nil || throttle.Failures != 1 {
+			t.Errorf("throttle has %d failures after the window passed, want 1", throttle.Failures)
+		}
+	})
+}
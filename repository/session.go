@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(session *model.Session) error
+	FindByID(id string) (*model.Session, error)
+	Rotate(id, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	Revoke(id string) error
+	RevokeByUser(userID uint) (int64, error)
+	RevokeOthers(userID uint, keepID string) (int64, error)
+	IsActive(id string) (bool, error)
+	WithTx(tx *gorm.DB) SessionRepository
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type SessionRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &SessionRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *SessionRepositoryImpl) WithTx(tx *gorm.DB) SessionRepository {
+	return &SessionRepositoryImpl{db: tx}
+}
+
+func (r *SessionRepositoryImpl) Create(session *model.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *SessionRepositoryImpl) FindByID(id string) (*model.Session, error) {
+	var session model.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Rotate replaces the refresh token hash only if it still equals oldHash, so
+// of two concurrent refreshes with the same token only one succeeds. oldHash
+// is kept as the previous hash.
+func (r *SessionRepositoryImpl) Rotate(id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	result := r.db.Model(&model.Session{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_hash":          newHash,
+			"previous_refresh_hash": oldHash,
+			"last_used_at":          time.Now(),
+			"expires_at":            expiresAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *SessionRepositoryImpl) Revoke(id string) error {
+	return r.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *SessionRepositoryImpl) RevokeByUser(userID uint) (int64, error) {
+	result := r.db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RevokeOthers revokes every session of the user except keepID.
+func (r *SessionRepositoryImpl) RevokeOthers(userID uint, keepID string) (int64, error) {
+	result := r.db.Model(&model.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *SessionRepositoryImpl) IsActive(id string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
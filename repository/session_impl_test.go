@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+func createTestUser(t *testing.T, db *gorm.DB, username string) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Password: "password", Email: username + "@example.com", Role: model.RoleViewer}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func createTestSession(t *testing.T, db *gorm.DB, id string, userID uint) *model.Session {
+	t.Helper()
+	session := &model.Session{ID: id, UserID: userID, RefreshHash: "hash-0", LastUsedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := NewSessionRepository(db).Create(session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return session
+}
+
+func TestSessionRepositoryRotate(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewSessionRepository(db)
+		user := createTestUser(t, db, "alice")
+		session := createTestSession(t, db, "s1", user.ID)
+		if ok, err := repo.Rotate(session.ID, "hash-0", "hash-1", time.Now().Add(time.Hour)); err != nil || !ok {
+			t.Fatalf("Rotate returned %v, %v", ok, err)
+		}
+		if ok, err := repo.Rotate(session.ID, "hash-0", "hash-2", time.Now().Add(time.Hour)); err != nil || ok {
+			t.Fatalf("Rotate with a spent hash returned %v, %v", ok, err)
+		}
+		found, err := repo.FindByID(session.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.RefreshHash != "hash-1" || found.PreviousRefreshHash != "hash-0" {
+			t.Errorf("session holds hash %q after %q", found.RefreshHash, found.PreviousRefreshHash)
+		}
+		if err := repo.Revoke(session.ID); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if active, err := repo.IsActive(session.ID); err != nil || active {
+			t.Fatalf("IsActive of a revoked session returned %v, %v", active, err)
+		}
+		if ok, err := repo.Rotate(session.ID, "hash-1", "hash-2", time.Now().Add(time.Hour)); err != nil || ok {
+			t.Fatalf("Rotate of a revoked session returned %v, %v", ok, err)
+		}
+	})
+}
+
+func TestSessionRepositoryRevokeOthers(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewSessionRepository(db)
+		alice := createTestUser(t, db, "alice")
+		bob := createTestUser(t, db, "bob")
+		for _, id := range []string{"a1", "a2", "a3"} {
+			createTestSession(t, db, id, alice.ID)
+		}
+		createTestSession(t, db, "b1", bob.ID)
+		revoked, err := repo.RevokeOthers(alice.ID, "a1")
+		if err != nil {
+			t.Fatalf("RevokeOthers: %v", err)
+		}
+		if revoked != 2 {
+			t.Errorf("RevokeOthers revoked %d sessions, want 2", revoked)
+		}
+		for id, want := range map[string]bool{"a1": true, "a2": false, "a3": false, "b1": true} {
+			if active, err := repo.IsActive(id); err != nil || active != want {
+				t.Errorf("IsActive(%s) returned %v, %v, want %v", id, active, err, want)
+			}
+		}
+		if revoked, err := repo.RevokeByUser(alice.ID); err != nil || revoked != 1 {
+			t.Errorf("RevokeByUser returned %d, %v, want 1", revoked, err)
+		}
+	})
+}
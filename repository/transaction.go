@@ -1,15 +1,19 @@
 package repository
 
 import (
-	"time"
-
 	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
 )
 
 type TransactionRepository interface {
 	Create(transaction *model.Transaction) error
+	CreateBatch(transactions []model.Transaction) error
 	Update(transaction *model.Transaction) error
 	Delete(id uint) error
 	FindByID(id uint) (*model.Transaction, error)
-	List(page, size int, transactionType string, startTime, endTime *time.Time) ([]*model.Transaction, int64, error)
+	List(page, size int, filter *model.TransactionFilter) ([]*model.Transaction, int64, error)
+	ListAfter(cursor *model.PageCursor, size int, filter *model.TransactionFilter) ([]*model.Transaction, error)
+	Count(filter *model.TransactionFilter) (int64, error)
+	Each(filter *model.TransactionFilter, batchSize int, fn func(transactions []*model.Transaction) error) error
+	WithTx(tx *gorm.DB) TransactionRepository
 }
@@ -2,11 +2,12 @@ package repository
 
 import (
 	"errors"
-	"time"
+	"strings"
 
 	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TransactionRepositoryImpl struct {
@@ -17,10 +18,24 @@ func NewTransactionRepository(db *gorm.DB) TransactionRepository {
 	return &TransactionRepositoryImpl{db: db}
 }
 
+// WithTx returns a repository that runs its queries in tx.
+func (r *TransactionRepositoryImpl) WithTx(tx *gorm.DB) TransactionRepository {
+	return &TransactionRepositoryImpl{db: tx}
+}
+
 func (r *TransactionRepositoryImpl) Create(transaction *model.Transaction) error {
 	return r.db.Create(transaction).Error
 }
 
+func (r *TransactionRepositoryImpl) CreateBatch(transactions []model.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(transactions, len(transactions)).Error
+	})
+}
+
 func (r *TransactionRepositoryImpl) Update(transaction *model.Transaction) error {
 	return r.db.Save(transaction).Error
 }
@@ -41,25 +56,179 @@ func (r *TransactionRepositoryImpl) FindByID(id uint) (*model.Transaction, error
 	return &transaction, nil
 }
 
-func (r *TransactionRepositoryImpl) List(page, size int, transactionType string, startTime, endTime *time.Time) ([]*model.Transaction, int64, error) {
+func (r *TransactionRepositoryImpl) List(page, size int, filter *model.TransactionFilter) ([]*model.Transaction, int64, error) {
 	var transactions []*model.Transaction
 	var total int64
-	db := r.db.Model(&model.Transaction{}).Where("is_deleted = ?", false)
-	if transactionType != "" {
-		db = db.Where("type = ?", transactionType)
-	}
-	if startTime != nil {
-		db = db.Where("created_at >= ?", startTime)
+	db, err := r.filtered(filter)
+	if err != nil {
+		return nil, 0, err
 	}
-	if endTime != nil {
-		db = db.Where("created_at <= ?", endTime)
+	order, err := transactionOrder(filter)
+	if err != nil {
+		return nil, 0, err
 	}
 	if err := db.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 	offset := (page - 1) * size
-	if err := db.Offset(offset).Limit(size).Order("created_at DESC").Find(&transactions).Error; err != nil {
+	if err := db.Offset(offset).Limit(size).Order(order).Find(&transactions).Error; err != nil {
 		return nil, 0, err
 	}
 	return transactions, total, nil
 }
+
+// ListAfter returns up to size transactions following cursor in
+// (created_at, id) order, or the first page when cursor is nil. Unlike List it
+// neither skips rows with OFFSET nor counts the matches.
+func (r *TransactionRepositoryImpl) ListAfter(cursor *model.PageCursor, size int, filter *model.TransactionFilter) ([]*model.Transaction, error) {
+	var transactions []*model.Transaction
+	db, err := r.filtered(filter)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := cursorDirection(filter)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		db = db.Where(keysetAfter("created_at", cursor, desc))
+	}
+	if err := db.Order(keysetOrder("created_at", desc)).Limit(size).Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (r *TransactionRepositoryImpl) Count(filter *model.TransactionFilter) (int64, error) {
+	var total int64
+	db, err := r.filtered(filter)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Each streams the transactions matching filter to fn in batches ordered by
+// ID, without loading the whole result set into memory.
+func (r *TransactionRepositoryImpl) Each(filter *model.TransactionFilter, batchSize int, fn func(transactions []*model.Transaction) error) error {
+	db, err := r.filtered(filter)
+	if err != nil {
+		return err
+	}
+	var transactions []*model.Transaction
+	return db.FindInBatches(&transactions, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(transactions)
+	}).Error
+}
+
+func (r *TransactionRepositoryImpl) filtered(filter *model.TransactionFilter) (*gorm.DB, error) {
+	return filterTransactions(r.db, filter)
+}
+
+// filterTransactions scopes db to the live transactions matching filter. It is
+// shared by the list, export and analytics queries.
+func filterTransactions(db *gorm.DB, filter *model.TransactionFilter) (*gorm.DB, error) {
+	db = db.Model(&model.Transaction{}).Where("is_deleted = ?", false)
+	if filter == nil {
+		return db, nil
+	}
+	if filter.Type != "" {
+		db = db.Where("type = ?", filter.Type)
+	}
+	if filter.StartTime != nil {
+		db = db.Where("created_at >= ?", filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		db = db.Where("created_at <= ?", filter.EndTime)
+	}
+	if filter.IsFraud != nil {
+		db = db.Where("is_fraud = ?", *filter.IsFraud)
+	}
+	if filter.MinAmount != nil {
+		db = db.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		db = db.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.NameOrig != "" {
+		db = db.Where("name_orig = ?", filter.NameOrig)
+	}
+	if filter.NameOrigPrefix != "" {
+		db = db.Where(prefixCondition("name_orig", filter.NameOrigPrefix))
+	}
+	if filter.NameDest != "" {
+		db = db.Where("name_dest = ?", filter.NameDest)
+	}
+	if filter.NameDestPrefix != "" {
+		db = db.Where(prefixCondition("name_dest", filter.NameDestPrefix))
+	}
+	if filter.MinProbability != nil {
+		db = db.Where("fraud_probability >= ?", *filter.MinProbability)
+	}
+	if filter.MaxProbability != nil {
+		db = db.Where("fraud_probability <= ?", *filter.MaxProbability)
+	}
+	if filter.Query != "" {
+		expr, err := ParseTransactionQuery(filter.Query)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(expr)
+	}
+	return db, nil
+}
+
+// cursorDirection reports whether a cursor listing runs newest first. Keyset
+// pagination walks the (created_at, id) index, so no other sort is allowed.
+func cursorDirection(filter *model.TransactionFilter) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+	if filter.SortBy != "" {
+		column, ok := lookupTransactionColumn(filter.SortBy)
+		if !ok {
+			return false, utils.ErrInvalidSortField
+		}
+		if column.name != "created_at" {
+			return false, utils.ErrCursorSortField
+		}
+	}
+	switch strings.ToLower(filter.SortOrder) {
+	case "", "desc":
+		return true, nil
+	case "asc":
+		return false, nil
+	}
+	return false, utils.ErrInvalidSortField
+}
+
+// transactionOrder sorts by the requested column, newest first by default,
+// with the ID as tie-breaker so that pages are stable.
+func transactionOrder(filter *model.TransactionFilter) (clause.OrderBy, error) {
+	sortBy, desc := "created_at", true
+	if filter != nil && filter.SortBy != "" {
+		column, ok := lookupTransactionColumn(filter.SortBy)
+		if !ok {
+			return clause.OrderBy{}, utils.ErrInvalidSortField
+		}
+		sortBy = column.name
+	}
+	if filter != nil && filter.SortOrder != "" {
+		switch strings.ToLower(filter.SortOrder) {
+		case "asc":
+			desc = false
+		case "desc":
+			desc = true
+		default:
+			return clause.OrderBy{}, utils.ErrInvalidSortField
+		}
+	}
+	columns := []clause.OrderByColumn{{Column: clause.Column{Name: sortBy}, Desc: desc}}
+	if sortBy != "id" {
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: desc})
+	}
+	return clause.OrderBy{Columns: columns}, nil
+}
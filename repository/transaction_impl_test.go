@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+func TestTransactionRepositoryCRUD(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewTransactionRepository(db)
+		created := createTestTransactions(t, db,
+			newTestTransaction("C1", 10, testTime(1, 0)),
+			newTestTransaction("C2", 20, testTime(2, 0)),
+		)
+		found, err := repo.FindByID(created[1].ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.NameOrig != "C2" || found.Amount != 20 || !found.CreatedAt.Equal(testTime(2, 0)) {
+			t.Fatalf("FindByID returned %+v", found)
+		}
+		found.Amount = 25
+		if err := repo.Update(found); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if err := repo.Delete(created[0].ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.FindByID(created[0].ID); !errors.Is(err, utils.ErrTransactionNotExists) {
+			t.Fatalf("FindByID of a deleted transaction returned %v", err)
+		}
+		transactions, total, err := repo.List(1, 10, nil)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if total != 1 || len(transactions) != 1 || transactions[0].Amount != 25 {
+			t.Fatalf("List returned %d of %d, want the updated transaction", len(transactions), total)
+		}
+	})
+}
+
+func TestTransactionRepositoryCreateBatchInTx(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		failure := errors.New("rolled back")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			batch := []model.Transaction{newTestTransaction("C1", 10, testTime(1, 0))}
+			if err := NewTransactionRepository(db).WithTx(tx).CreateBatch(batch); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Transaction returned %v", err)
+		}
+		count, err := NewTransactionRepository(db).Count(nil)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		if count != 0 {
+			t.Fatalf("batch survived the rollback: %d transactions", count)
+		}
+	})
+}
+
+func TestTransactionRepositoryPrefixEscapesWildcards(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		createTestTransactions(t, db,
+			newTestTransaction("C1_00", 1, testTime(1, 0)),
+			newTestTransaction("C1X00", 1, testTime(1, 0)),
+			newTestTransaction("C1%00", 1, testTime(1, 0)),
+			newTestTransaction("C1!00", 1, testTime(1, 0)),
+			newTestTransaction("C1!X00", 1, testTime(1, 0)),
+		)
+		repo := NewTransactionRepository(db)
+		for prefix, want := range map[string]string{"C1_": "C1_00", "C1%": "C1%00", "C1!0": "C1!00"} {
+			transactions, total, err := repo.List(1, 10, &model.TransactionFilter{NameOrigPrefix: prefix})
+			if err != nil {
+				t.Fatalf("List with prefix %q: %v", prefix, err)
+			}
+			if total != 1 || transactions[0].NameOrig != want {
+				t.Errorf("prefix %q matched %d transactions, want only %s", prefix, total, want)
+			}
+		}
+		total, err := repo.Count(&model.TransactionFilter{NameOrigPrefix: "C1"})
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		if total != 5 {
+			t.Errorf("prefix C1 matched %d transactions, want 5", total)
+		}
+	})
+}
+
+func TestTransactionRepositoryListAfter(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		// Two transactions share each timestamp, so pages have to break ties
+		// by ID.
+		var batch []model.Transaction
+		for i := 0; i < 6; i++ {
+			batch = append(batch, newTestTransaction("C1", float64(i), testTime(1+i/2, 0)))
+		}
+		createTestTransactions(t, db, batch...)
+		repo := NewTransactionRepository(db)
+		for _, order := range []string{"desc", "asc"} {
+			filter := &model.TransactionFilter{SortOrder: order}
+			want, _, err := repo.List(1, 10, filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []*model.Transaction
+			var cursor *model.PageCursor
+			for {
+				page, err := repo.ListAfter(cursor, 4, filter)
+				if err != nil {
+					t.Fatalf("ListAfter: %v", err)
+				}
+				got = append(got, page...)
+				if len(page) < 4 {
+					break
+				}
+				last := page[len(page)-1]
+				cursor = &model.PageCursor{Time: last.CreatedAt, ID: last.ID}
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%s: cursor pages returned %d transactions, want %d", order, len(got), len(want))
+			}
+			for i := range want {
+				if got[i].ID != want[i].ID {
+					t.Fatalf("%s: cursor pages returned ID %d at %d, want %d", order, got[i].ID, i, want[i].ID)
+				}
+			}
+		}
+	})
+}
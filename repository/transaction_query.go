@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm/clause"
+)
+
+type transactionColumnKind int
+
+const (
+	stringColumn transactionColumnKind = iota
+	numberColumn
+	boolColumn
+	timeColumn
+)
+
+type transactionColumn struct {
+	name string
+	kind transactionColumnKind
+}
+
+// transactionColumns lists the columns that may be filtered and sorted on,
+// keyed by their JSON name. Anything else is rejected, so user input never
+// reaches the SQL text.
+var transactionColumns = map[string]transactionColumn{
+	"id":               {"id", numberColumn},
+	"type":             {"type", stringColumn},
+	"amount":           {"amount", numberColumn},
+	"nameOrig":         {"name_orig", stringColumn},
+	"oldBalanceOrig":   {"old_balance_orig", numberColumn},
+	"newBalanceOrig":   {"new_balance_orig", numberColumn},
+	"nameDest":         {"name_dest", stringColumn},
+	"oldBalanceDest":   {"old_balance_dest", numberColumn},
+	"newBalanceDest":   {"new_balance_dest", numberColumn},
+	"isFraud":          {"is_fraud", boolColumn},
+	"fraudProbability": {"fraud_probability", numberColumn},
+	"createdAt":        {"created_at", timeColumn},
+	"updatedAt":        {"updated_at", timeColumn},
+}
+
+func lookupTransactionColumn(name string) (transactionColumn, bool) {
+	if column, ok := transactionColumns[name]; ok {
+		return column, true
+	}
+	for _, column := range transactionColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return transactionColumn{}, false
+}
+
+// ValidateTransactionFilter checks the query expression and sort options of
+// filter without running it.
+func ValidateTransactionFilter(filter *model.TransactionFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.Query != "" {
+		if _, err := ParseTransactionQuery(filter.Query); err != nil {
+			return err
+		}
+	}
+	_, err := transactionOrder(filter)
+	return err
+}
+
+// ParseTransactionQuery parses a filter expression such as
+//
+//	amount>50000 AND (type=TRANSFER OR type=CASH_OUT) AND NOT nameDest=M*
+//
+// into a GORM condition. Comparisons are field op value with the operators
+// =, !=, >, >=, < and <=; a string value ending in * matches by prefix.
+// Values may be quoted with single or double quotes. AND binds tighter than OR.
+func ParseTransactionQuery(query string) (clause.Expression, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, queryError("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+type queryTokenKind int
+
+const (
+	wordToken queryTokenKind = iota
+	stringToken
+	operatorToken
+	openToken
+	closeToken
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: openToken, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: closeToken, text: ")"})
+			i++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, queryError("unexpected %q", op)
+			}
+			tokens = append(tokens, queryToken{kind: operatorToken, text: op})
+			i += len(op)
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, queryError("unterminated string")
+			}
+			tokens = append(tokens, queryToken{kind: stringToken, text: string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()=!<>\"'", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: wordToken, text: string(runes[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peekKeyword(keyword string) bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	token := p.tokens[p.pos]
+	return token.kind == wordToken && strings.EqualFold(token.text, keyword)
+}
+
+func (p *queryParser) parseOr() (clause.Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []clause.Expression{left}
+	for p.peekKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, right)
+	}
+	if len(exprs) == 1 {
+		return left, nil
+	}
+	return clause.Or(exprs...), nil
+}
+
+func (p *queryParser) parseAnd() (clause.Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []clause.Expression{left}
+	for p.peekKeyword("AND") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, right)
+	}
+	if len(exprs) == 1 {
+		return left, nil
+	}
+	return clause.And(exprs...), nil
+}
+
+func (p *queryParser) parseUnary() (clause.Expression, error) {
+	if p.peekKeyword("NOT") {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition(expr), nil
+	}
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == openToken {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != closeToken {
+			return nil, queryError("missing closing parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (clause.Expression, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, queryError("unexpected end of query")
+	}
+	if p.pos+2 >= len(p.tokens) {
+		return nil, queryError("incomplete comparison near %q", p.tokens[p.pos].text)
+	}
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.kind != wordToken {
+		return nil, queryError("expected a field name, got %q", field.text)
+	}
+	if op.kind != operatorToken {
+		return nil, queryError("expected an operator after %q", field.text)
+	}
+	if value.kind != wordToken && value.kind != stringToken {
+		return nil, queryError("expected a value after %q", field.text+op.text)
+	}
+	p.pos += 3
+	column, ok := lookupTransactionColumn(field.text)
+	if !ok {
+		return nil, queryError("unknown field %q", field.text)
+	}
+	if column.kind == stringColumn && value.kind == wordToken && strings.HasSuffix(value.text, "*") {
+		prefix := strings.TrimSuffix(value.text, "*")
+		switch op.text {
+		case "=":
+			return prefixCondition(column.name, prefix), nil
+		case "!=":
+			return notCondition(prefixCondition(column.name, prefix)), nil
+		}
+		return nil, queryError("prefix match only supports = and !=")
+	}
+	parsed, err := parseQueryValue(column, value.text)
+	if err != nil {
+		return nil, err
+	}
+	if column.kind == boolColumn && op.text != "=" && op.text != "!=" {
+		return nil, queryError("field %q only supports = and !=", field.text)
+	}
+	return compareColumn(column.name, op.text, parsed), nil
+}
+
+func parseQueryValue(column transactionColumn, raw string) (interface{}, error) {
+	switch column.kind {
+	case numberColumn:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, queryError("invalid number %q", raw)
+		}
+		return value, nil
+	case boolColumn:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, queryError("invalid boolean %q", raw)
+		}
+		return value, nil
+	case timeColumn:
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, queryError("invalid time %q, expected RFC 3339", raw)
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+func compareColumn(name, op string, value interface{}) clause.Expression {
+	column := clause.Column{Name: name}
+	switch op {
+	case "!=":
+		return clause.Neq{Column: column, Value: value}
+	case ">":
+		return clause.Gt{Column: column, Value: value}
+	case ">=":
+		return clause.Gte{Column: column, Value: value}
+	case "<":
+		return clause.Lt{Column: column, Value: value}
+	case "<=":
+		return clause.Lte{Column: column, Value: value}
+	}
+	return clause.Eq{Column: column, Value: value}
+}
+
+// notCondition negates expr as a whole. clause.Not negates each condition of
+// an AND separately, which turns NOT (a AND b) into NOT a AND NOT b.
+func notCondition(expr clause.Expression) clause.Expression {
+	return clause.Expr{SQL: "NOT (?)", Vars: []interface{}{expr}}
+}
+
+// prefixCondition matches rows whose column starts with prefix, escaping the
+// LIKE wildcards in prefix. The escape character is "!" rather than a
+// backslash, which MySQL would read as escaping the closing quote.
+func prefixCondition(name, prefix string) clause.Expression {
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix)
+	return clause.Expr{
+		SQL:  "? LIKE ? ESCAPE '!'",
+		Vars: []interface{}{clause.Column{Name: name}, escaped + "%"},
+	}
+}
+
+func queryError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", utils.ErrInvalidTransactionQuery, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+func TestParseTransactionQueryMatches(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		seed := []struct {
+			nameOrig, nameDest, txType string
+			amount                     float64
+		}{
+			{"C1", "M1", "TRANSFER", 10},
+			{"C2", "M2", "TRANSFER", 1},
+			{"C3", "C9", "CASH_OUT", 10},
+			{"C4", "M3", "PAYMENT", 10},
+			{"C5", "C8", "PAYMENT", 1},
+		}
+		var batch []model.Transaction
+		for _, row := range seed {
+			transaction := newTestTransaction(row.nameOrig, row.amount, testTime(1, 0))
+			transaction.NameDest = row.nameDest
+			transaction.Type = row.txType
+			batch = append(batch, transaction)
+		}
+		createTestTransactions(t, db, batch...)
+		repo := NewTransactionRepository(db)
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"amount>5", []string{"C1", "C3", "C4"}},
+			{"amount>5 AND type=TRANSFER", []string{"C1"}},
+			{"NOT (amount>5 AND type=TRANSFER)", []string{"C2", "C3", "C4", "C5"}},
+			{"NOT (type=TRANSFER OR type=PAYMENT)", []string{"C3"}},
+			{"NOT (nameDest=M* AND amount>3)", []string{"C2", "C3", "C5"}},
+			{"nameDest!=M*", []string{"C3", "C5"}},
+			{"NOT nameDest=M* AND amount>3", []string{"C3"}},
+			{"NOT NOT type=CASH_OUT", []string{"C3"}},
+			{"amount>5 AND NOT (type=PAYMENT OR (nameDest=C* AND amount<100))", []string{"C1"}},
+			// AND binds tighter than OR.
+			{"type=CASH_OUT OR type=TRANSFER AND amount<5", []string{"C2", "C3"}},
+			{"(type=CASH_OUT OR type=TRANSFER) AND amount<5", []string{"C2"}},
+			{"type='PAYMENT' and nameDest=\"M3\"", []string{"C4"}},
+		}
+		for _, tt := range tests {
+			transactions, _, err := repo.List(1, 10, &model.TransactionFilter{Query: tt.query})
+			if err != nil {
+				t.Errorf("%s: %v", tt.query, err)
+				continue
+			}
+			got := []string{}
+			for _, transaction := range transactions {
+				got = append(got, transaction.NameOrig)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s matched %v, want %v", tt.query, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestParseTransactionQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"amount",
+		"amount>",
+		"amount>>5",
+		"amount!5",
+		"balance>5",
+		"amount>five",
+		"isFraud>true",
+		"createdAt>yesterday",
+		"type>T*",
+		"(amount>5",
+		"amount>5)",
+		"amount>5 AND",
+		"NOT",
+		"type='TRANSFER",
+		"amount>5 type=TRANSFER",
+	} {
+		if _, err := ParseTransactionQuery(query); !errors.Is(err, utils.ErrInvalidTransactionQuery) {
+			t.Errorf("%q returned %v, want ErrInvalidTransactionQuery", query, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type txUndoKey struct{}
+
+// txUndo collects the writes made outside the database during a transaction,
+// as functions that revert them.
+type txUndo struct {
+	mu    sync.Mutex
+	funcs []func() error
+}
+
+func (u *txUndo) add(fn func() error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.funcs = append(u.funcs, fn)
+}
+
+func (u *txUndo) run() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var errs []error
+	for i := len(u.funcs) - 1; i >= 0; i-- {
+		errs = append(errs, u.funcs[i]())
+	}
+	return errors.Join(errs...)
+}
+
+// Transaction runs fn in a transaction. Repositories that write outside the
+// database, such as the MongoDB report store, register how to revert those
+// writes on tx, and Transaction reverts them if the transaction rolls back or
+// fails to commit.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	undo := &txUndo{}
+	err := db.WithContext(context.WithValue(ctx, txUndoKey{}, undo)).Transaction(fn)
+	if err != nil {
+		if undoErr := undo.run(); undoErr != nil {
+			return errors.Join(err, undoErr)
+		}
+	}
+	return err
+}
+
+// txUndoOf returns where writes outside the database are registered for tx,
+// or nil if tx was not started by Transaction.
+func txUndoOf(tx *gorm.DB) *txUndo {
+	if tx.Statement.Context == nil {
+		return nil
+	}
+	undo, _ := tx.Statement.Context.Value(txUndoKey{}).(*txUndo)
+	return undo
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestTransactionUndoesOnRollback(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		failure := errors.New("rolled back")
+		undoFailure := errors.New("undo failed")
+		tests := []struct {
+			name    string
+			err     error
+			undoErr error
+			undone  []string
+		}{
+			{"commit", nil, nil, nil},
+			{"rollback", failure, nil, []string{"second", "first"}},
+			{"failed undo", failure, undoFailure, []string{"second", "first"}},
+		}
+		for _, tt := range tests {
+			var undone []string
+			err := Transaction(db, func(tx *gorm.DB) error {
+				txUndoOf(tx).add(func() error {
+					undone = append(undone, "first")
+					return nil
+				})
+				// Savepoints share the transaction's undo list.
+				return tx.Transaction(func(tx *gorm.DB) error {
+					txUndoOf(tx).add(func() error {
+						undone = append(undone, "second")
+						return tt.undoErr
+					})
+					return tt.err
+				})
+			})
+			if !errors.Is(err, tt.err) || (tt.undoErr != nil && !errors.Is(err, tt.undoErr)) {
+				t.Errorf("%s: Transaction returned %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(undone, tt.undone) {
+				t.Errorf("%s: undid %v, want %v", tt.name, undone, tt.undone)
+			}
+		}
+		if txUndoOf(db) != nil {
+			t.Error("a handle outside Transaction has an undo list")
+		}
+	})
+}
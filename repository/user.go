@@ -2,14 +2,17 @@ package repository
 
 import (
 	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
 )
 
 type UserRepository interface {
 	Create(user *model.User) error
 	Update(user *model.User) error
-	Delete(id string) error
+	Delete(id uint) error
 	FindByID(id uint) (*model.User, error)
 	FindByUsername(username string) (*model.User, error)
 	FindByEmail(email string) (*model.User, error)
-	List(page, size int) ([]*model.User, int64, error)
+	List(page, size int, filter *model.UserFilter) ([]*model.User, int64, error)
+	CountByRole(role string) (int64, error)
+	WithTx(tx *gorm.DB) UserRepository
 }
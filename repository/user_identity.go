@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepository interface {
+	Create(identity *model.UserIdentity) error
+	FindByIssuerSubject(issuer, subject string) (*model.UserIdentity, error)
+	TouchLogin(id uint, at time.Time) error
+	CreateLogin(login *model.OIDCLogin) error
+	ConsumeLogin(state string, now time.Time) (*model.OIDCLogin, error)
+	WithTx(tx *gorm.DB) UserIdentityRepository
+}
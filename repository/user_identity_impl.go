@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) UserIdentityRepository {
+	return &UserIdentityRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *UserIdentityRepositoryImpl) WithTx(tx *gorm.DB) UserIdentityRepository {
+	return &UserIdentityRepositoryImpl{db: tx}
+}
+
+func (r *UserIdentityRepositoryImpl) Create(identity *model.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *UserIdentityRepositoryImpl) FindByIssuerSubject(issuer, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrIdentityNotLinked
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *UserIdentityRepositoryImpl) TouchLogin(id uint, at time.Time) error {
+	return r.db.Model(&model.UserIdentity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
+
+// CreateLogin stores a pending login, clearing out abandoned ones first.
+func (r *UserIdentityRepositoryImpl) CreateLogin(login *model.OIDCLogin) error {
+	if err := r.db.Where("expires_at < ?", login.CreatedAt).Delete(&model.OIDCLogin{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(login).Error
+}
+
+// ConsumeLogin removes and returns the pending login for state, so each state
+// can complete at most one login.
+func (r *UserIdentityRepositoryImpl) ConsumeLogin(state string, now time.Time) (*model.OIDCLogin, error) {
+	var login model.OIDCLogin
+	if err := r.db.Where("state = ?", state).First(&login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	result := r.db.Where("state = ?", state).Delete(&model.OIDCLogin{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || now.After(login.ExpiresAt) {
+		return nil, utils.ErrInvalidOIDCState
+	}
+	return &login, nil
+}
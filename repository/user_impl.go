@@ -2,6 +2,8 @@ package repository
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -16,6 +18,11 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &UserRepositoryImpl{db: db}
 }
 
+// WithTx returns a repository that runs its queries in tx.
+func (r *UserRepositoryImpl) WithTx(tx *gorm.DB) UserRepository {
+	return &UserRepositoryImpl{db: tx}
+}
+
 func (r *UserRepositoryImpl) Create(user *model.User) error {
 	return r.db.Create(user).Error
 }
@@ -24,8 +31,11 @@ func (r *UserRepositoryImpl) Update(user *model.User) error {
 	return r.db.Save(user).Error
 }
 
-func (r *UserRepositoryImpl) Delete(id string) error {
-	return r.db.Model(&model.User{}).Where("id = ?", id).Update("is_deleted", true).Error
+func (r *UserRepositoryImpl) Delete(id uint) error {
+	return r.db.Model(&model.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"is_deleted": true,
+		"deleted_at": time.Now().Unix(),
+	}).Error
 }
 
 func (r *UserRepositoryImpl) FindByID(id uint) (*model.User, error) {
@@ -64,29 +74,37 @@ func (r *UserRepositoryImpl) FindByEmail(email string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepositoryImpl) FindByGitHubID(githubID string) (*model.User, error) {
-	var user model.User
-	err := r.db.Where("github_id = ? AND is_deleted = ?", githubID, false).First(&user).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
-		}
-		return nil, err
-	}
-	return &user, nil
-}
-
-func (r *UserRepositoryImpl) List(page, size int) ([]*model.User, int64, error) {
+func (r *UserRepositoryImpl) List(page, size int, filter *model.UserFilter) ([]*model.User, int64, error) {
 	var users []*model.User
 	var count int64
 	offset := (page - 1) * size
-	err := r.db.Model(&model.User{}).Where("is_deleted = ?", false).Count(&count).Error
+	db := r.db.Model(&model.User{}).Where("is_deleted = ?", false)
+	if filter != nil {
+		if filter.Query != "" {
+			pattern := "%" + strings.ToLower(filter.Query) + "%"
+			db = db.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+		}
+		if filter.Role != "" {
+			db = db.Where("role = ?", filter.Role)
+		}
+		if filter.Disabled != nil {
+			db = db.Where("disabled = ?", *filter.Disabled)
+		}
+	}
+	err := db.Count(&count).Error
 	if err != nil {
 		return nil, 0, err
 	}
-	err = r.db.Where("is_deleted = ?", false).Offset(offset).Limit(size).Find(&users).Error
+	err = db.Order("id ASC").Offset(offset).Limit(size).Find(&users).Error
 	if err != nil {
 		return nil, 0, err
 	}
 	return users, count, nil
 }
+
+// CountByRole counts the users with role who can still log in.
+func (r *UserRepositoryImpl) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Where("role = ? AND is_deleted = ? AND disabled = ?", role, false, false).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository interface {
+	Create(token *model.UserToken) error
+	Consume(id, purpose string, now time.Time) (*model.UserToken, error)
+	WithTx(tx *gorm.DB) UserTokenRepository
+}
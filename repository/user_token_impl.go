@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &UserTokenRepositoryImpl{
+		db: db,
+	}
+}
+
+// WithTx returns a repository that runs its queries in tx.
+func (r *UserTokenRepositoryImpl) WithTx(tx *gorm.DB) UserTokenRepository {
+	return &UserTokenRepositoryImpl{db: tx}
+}
+
+// Create stores a token after removing the user's earlier tokens for the same
+// purpose, so only the latest link works, and any expired tokens.
+func (r *UserTokenRepositoryImpl) Create(token *model.UserToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("(user_id = ? AND purpose = ?) OR expires_at < ?", token.UserID, token.Purpose, token.CreatedAt).
+			Delete(&model.UserToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// Consume marks the token used and returns it, so each token works once.
+func (r *UserTokenRepositoryImpl) Consume(id, purpose string, now time.Time) (*model.UserToken, error) {
+	var token model.UserToken
+	if err := r.db.Where("id = ? AND purpose = ?", id, purpose).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidUserToken
+		}
+		return nil, err
+	}
+	result := r.db.Model(&model.UserToken{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || now.After(token.ExpiresAt) {
+		return nil, utils.ErrInvalidUserToken
+	}
+	return &token, nil
+}
@@ -3,8 +3,10 @@ package router
 import (
 	"context"
 
+	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/controller"
 	"github.com/Mitsui515/finsys/middleware"
+	"github.com/Mitsui515/finsys/model"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/utils"
@@ -15,42 +17,140 @@ func RegisterRoutes(h *server.Hertz) {
 	h.GET("/ping", func(ctx context.Context, c *app.RequestContext) {
 		c.JSON(consts.StatusOK, utils.H{"message": "pong"})
 	})
+	h.GET("/.well-known/jwks.json", controller.JWKSHandler)
 	transactionController := controller.NewTransactionController()
 	userController := controller.NewUserController()
 	fraudReportController := controller.NewFraudReportController()
 	chatController := controller.NewChatController()
+	importController := controller.NewImportController()
+	importProfileController := controller.NewImportProfileController()
+	analyticsController := controller.NewAnalyticsController()
+	auditController := controller.NewAuditController()
+	oidcController := controller.NewOIDCController()
+	securityController := controller.NewSecurityController()
+	apiKeyController := controller.NewAPIKeyController()
+	llmUsageController := controller.NewLLMUsageController()
+	// Every authenticated group runs Authorize, which denies any route not
+	// registered through perms.Handle with a permission.
+	perms := middleware.RoutePermissions{}
+	authorize := middleware.Authorize(perms)
+	// Limits apply after Authorize, so refused requests do not use them up.
+	rateLimit := config.Current().RateLimit
+	limiter := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore(), &rateLimit)
+	defaultLimit := limiter.Limit("default", rateLimit.Default)
 	api := h.Group("/api")
 	{
 		auth := api.Group("/auth")
 		{
 			auth.POST("/register", userController.Register)
 			auth.POST("/login", userController.Login)
+			auth.POST("/refresh", userController.Refresh)
+			auth.POST("/2fa/verify", userController.VerifyMFAHandler)
+			auth.POST("/2fa/enroll", userController.EnrollWithChallengeHandler)
+			auth.POST("/verify-email", userController.VerifyEmailHandler)
+			auth.POST("/verify-email/resend", userController.ResendVerificationHandler)
+			auth.POST("/password/forgot", userController.ForgotPasswordHandler)
+			auth.POST("/password/reset", userController.ResetPasswordHandler)
+			auth.GET("/oidc/login", oidcController.LoginHandler)
+			auth.GET("/oidc/callback", oidcController.CallbackHandler)
 		}
-		user := api.Group("/user", middleware.JWTAuth())
+		sessions := api.Group("/auth", middleware.JWTAuth(), authorize, defaultLimit)
 		{
-			user.GET("/info", userController.GetUserInfo)
+			perms.Handle(sessions, consts.MethodPost, "/logout", model.PermissionSessionsManage, userController.Logout)
+			perms.Handle(sessions, consts.MethodPost, "/logout-all", model.PermissionSessionsManage, userController.LogoutAll)
 		}
-		transactions := api.Group("/transactions", middleware.JWTAuth())
+		user := api.Group("/user", middleware.JWTAuth(), authorize, defaultLimit)
 		{
-			transactions.GET("", transactionController.ListTransactionHandler)
-			transactions.GET("/:id", transactionController.GetTransactionHandler)
-			transactions.POST("", transactionController.CreateTransactionHandler)
-			transactions.PUT("/:id", transactionController.UpdateTransactionHandler)
-			transactions.DELETE("/:id", transactionController.DeleteTransactionHandler)
-			transactions.POST("/import", transactionController.ImportTransactionsHandler)
+			perms.Handle(user, consts.MethodGet, "/info", model.PermissionProfileRead, userController.GetUserInfo)
+			perms.Handle(user, consts.MethodGet, "/llm-usage", model.PermissionProfileRead, llmUsageController.UsageStatusHandler)
+			perms.Handle(user, consts.MethodPut, "/email", model.PermissionProfileWrite, userController.ChangeEmailHandler)
+			perms.Handle(user, consts.MethodPut, "/password", model.PermissionProfileWrite, userController.ChangePasswordHandler)
+			perms.Handle(user, consts.MethodGet, "/2fa", model.PermissionMFAManage, userController.MFAStatusHandler)
+			perms.Handle(user, consts.MethodPost, "/2fa/enroll", model.PermissionMFAManage, userController.EnrollTOTPHandler)
+			perms.Handle(user, consts.MethodPost, "/2fa/confirm", model.PermissionMFAManage, userController.ConfirmTOTPHandler)
+			perms.Handle(user, consts.MethodPost, "/2fa/disable", model.PermissionMFAManage, userController.DisableTOTPHandler)
+			perms.Handle(user, consts.MethodPost, "/2fa/recovery-codes", model.PermissionMFAManage, userController.RegenerateRecoveryCodesHandler)
 		}
-		fraudReports := api.Group("/fraud-reports", middleware.JWTAuth())
+		transactions := api.Group("/transactions", middleware.JWTAuth(), authorize, defaultLimit)
 		{
-			fraudReports.GET("", fraudReportController.ListFraudReportsHandler)
-			fraudReports.GET("/:id", fraudReportController.GetFraudReportHandler)
-			fraudReports.GET("/transaction/:transaction_id", fraudReportController.GetFraudReportByTransactionHandler)
-			fraudReports.POST("", fraudReportController.CreateFraudReportHandler)
-			fraudReports.PUT("/:id", fraudReportController.UpdateFraudReportHandler)
-			fraudReports.DELETE("/:id", fraudReportController.DeleteFraudReportHandler)
+			perms.Handle(transactions, consts.MethodGet, "", model.PermissionTransactionsRead, transactionController.ListTransactionHandler)
+			perms.Handle(transactions, consts.MethodGet, "/export", model.PermissionTransactionsExport, transactionController.ExportTransactionsHandler)
+			perms.Handle(transactions, consts.MethodGet, "/:id", model.PermissionTransactionsRead, transactionController.GetTransactionHandler)
+			perms.Handle(transactions, consts.MethodPost, "", model.PermissionTransactionsWrite, transactionController.CreateTransactionHandler)
+			perms.Handle(transactions, consts.MethodPut, "/:id", model.PermissionTransactionsWrite, transactionController.UpdateTransactionHandler)
+			perms.Handle(transactions, consts.MethodDelete, "/:id", model.PermissionTransactionsDelete, transactionController.DeleteTransactionHandler)
+			perms.Handle(transactions, consts.MethodPost, "/import", model.PermissionTransactionsImport,
+				limiter.Limit("import", rateLimit.Import), transactionController.ImportTransactionsHandler)
 		}
-		chat := api.Group("/chat", middleware.JWTAuth())
+		imports := api.Group("/imports", middleware.JWTAuth(), authorize, defaultLimit)
 		{
-			chat.POST("", chatController.ChatHandler)
+			perms.Handle(imports, consts.MethodGet, "/:id", model.PermissionTransactionsImport, importController.GetImportHandler)
+			perms.Handle(imports, consts.MethodPost, "/:id/cancel", model.PermissionTransactionsImport, importController.CancelImportHandler)
+			perms.Handle(imports, consts.MethodPost, "/:id/resume", model.PermissionTransactionsImport, importController.ResumeImportHandler)
+		}
+		importProfiles := api.Group("/import-profiles", middleware.JWTAuth(), authorize, defaultLimit)
+		{
+			perms.Handle(importProfiles, consts.MethodGet, "", model.PermissionImportProfilesRead, importProfileController.ListImportProfilesHandler)
+			perms.Handle(importProfiles, consts.MethodGet, "/:id", model.PermissionImportProfilesRead, importProfileController.GetImportProfileHandler)
+			perms.Handle(importProfiles, consts.MethodPost, "", model.PermissionImportProfilesEdit, importProfileController.CreateImportProfileHandler)
+			perms.Handle(importProfiles, consts.MethodPut, "/:id", model.PermissionImportProfilesEdit, importProfileController.UpdateImportProfileHandler)
+			perms.Handle(importProfiles, consts.MethodDelete, "/:id", model.PermissionImportProfilesEdit, importProfileController.DeleteImportProfileHandler)
+		}
+		fraudReports := api.Group("/fraud-reports", middleware.JWTAuth(), authorize, defaultLimit)
+		{
+			perms.Handle(fraudReports, consts.MethodGet, "", model.PermissionReportsRead, fraudReportController.ListFraudReportsHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/export", model.PermissionReportsExport, fraudReportController.ExportFraudReportsHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/:id", model.PermissionReportsRead, fraudReportController.GetFraudReportHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/:id/versions", model.PermissionReportsRead, fraudReportController.ListReportVersionsHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/:id/versions/:version", model.PermissionReportsRead, fraudReportController.GetReportVersionHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/:id/diff", model.PermissionReportsRead, fraudReportController.DiffReportVersionsHandler)
+			perms.Handle(fraudReports, consts.MethodGet, "/transaction/:transaction_id", model.PermissionReportsRead, fraudReportController.GetFraudReportByTransactionHandler)
+			perms.Handle(fraudReports, consts.MethodPost, "", model.PermissionReportsWrite, fraudReportController.CreateFraudReportHandler)
+			perms.Handle(fraudReports, consts.MethodPut, "/:id", model.PermissionReportsWrite, fraudReportController.UpdateFraudReportHandler)
+			perms.Handle(fraudReports, consts.MethodDelete, "/:id", model.PermissionReportsDelete, fraudReportController.DeleteFraudReportHandler)
+		}
+		analytics := api.Group("/analytics", middleware.JWTAuth(), authorize, defaultLimit)
+		{
+			perms.Handle(analytics, consts.MethodGet, "/volume", model.PermissionAnalyticsRead, analyticsController.VolumeHandler)
+			perms.Handle(analytics, consts.MethodGet, "/fraud-rate", model.PermissionAnalyticsRead, analyticsController.FraudRateHandler)
+			perms.Handle(analytics, consts.MethodGet, "/probability-histogram", model.PermissionAnalyticsRead, analyticsController.ProbabilityHistogramHandler)
+			perms.Handle(analytics, consts.MethodGet, "/top-accounts", model.PermissionAnalyticsRead, analyticsController.TopAccountsHandler)
+		}
+		audit := api.Group("/audit", middleware.JWTAuth(), authorize, defaultLimit)
+		{
+			perms.Handle(audit, consts.MethodGet, "", model.PermissionAuditRead, auditController.ListAuditLogsHandler)
+			perms.Handle(audit, consts.MethodGet, "/verify", model.PermissionAuditRead, auditController.VerifyAuditLogHandler)
+			perms.Handle(audit, consts.MethodGet, "/security-events", model.PermissionAuditRead, securityController.ListSecurityEventsHandler)
+			perms.Handle(audit, consts.MethodGet, "/:id", model.PermissionAuditRead, auditController.GetAuditLogHandler)
+		}
+		admin := api.Group("/admin", middleware.JWTAuth(), authorize, defaultLimit)
+		{
+			perms.Handle(admin, consts.MethodGet, "/roles", model.PermissionUsersManage, userController.ListRolesHandler)
+			perms.Handle(admin, consts.MethodPut, "/roles/:role/policy", model.PermissionUsersManage, userController.SetRolePolicyHandler)
+			perms.Handle(admin, consts.MethodGet, "/users", model.PermissionUsersManage, userController.ListUsersHandler)
+			perms.Handle(admin, consts.MethodGet, "/users/:id", model.PermissionUsersManage, userController.GetUserHandler)
+			perms.Handle(admin, consts.MethodDelete, "/users/:id", model.PermissionUsersManage, userController.DeleteUserHandler)
+			perms.Handle(admin, consts.MethodPost, "/users/:id/disable", model.PermissionUsersManage, userController.DisableUserHandler)
+			perms.Handle(admin, consts.MethodPost, "/users/:id/enable", model.PermissionUsersManage, userController.EnableUserHandler)
+			perms.Handle(admin, consts.MethodPut, "/users/:id/role", model.PermissionUsersManage, userController.AssignRoleHandler)
+			perms.Handle(admin, consts.MethodPost, "/users/:id/logout-all", model.PermissionUsersManage, userController.LogoutUserHandler)
+			perms.Handle(admin, consts.MethodDelete, "/users/:id/2fa", model.PermissionUsersManage, userController.ResetTOTPHandler)
+			perms.Handle(admin, consts.MethodPost, "/users/:id/unlock", model.PermissionUsersManage, userController.UnlockUserHandler)
+			perms.Handle(admin, consts.MethodGet, "/login-locks", model.PermissionUsersManage, securityController.ListLocksHandler)
+			perms.Handle(admin, consts.MethodPost, "/ips/:ip/unlock", model.PermissionUsersManage, securityController.UnlockIPHandler)
+			perms.Handle(admin, consts.MethodGet, "/api-keys", model.PermissionUsersManage, apiKeyController.ListAPIKeysHandler)
+			perms.Handle(admin, consts.MethodPost, "/api-keys", model.PermissionUsersManage, apiKeyController.CreateAPIKeyHandler)
+			perms.Handle(admin, consts.MethodDelete, "/api-keys/:id", model.PermissionUsersManage, apiKeyController.RevokeAPIKeyHandler)
+			perms.Handle(admin, consts.MethodGet, "/llm-usage", model.PermissionUsersManage, llmUsageController.UsageReportHandler)
+			perms.Handle(admin, consts.MethodGet, "/llm-budgets", model.PermissionUsersManage, llmUsageController.ListBudgetsHandler)
+			perms.Handle(admin, consts.MethodPut, "/llm-budgets/users/:id", model.PermissionUsersManage, llmUsageController.SetUserBudgetHandler)
+			perms.Handle(admin, consts.MethodDelete, "/llm-budgets/users/:id", model.PermissionUsersManage, llmUsageController.DeleteUserBudgetHandler)
+			perms.Handle(admin, consts.MethodPut, "/llm-budgets/roles/:role", model.PermissionUsersManage, llmUsageController.SetRoleBudgetHandler)
+			perms.Handle(admin, consts.MethodDelete, "/llm-budgets/roles/:role", model.PermissionUsersManage, llmUsageController.DeleteRoleBudgetHandler)
+		}
+		chat := api.Group("/chat", middleware.JWTAuth(), authorize, defaultLimit, limiter.Limit("chat", rateLimit.Chat))
+		{
+			perms.Handle(chat, consts.MethodPost, "", model.PermissionChatUse, chatController.ChatHandler)
 		}
 	}
 }
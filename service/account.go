@@ -0,0 +1,238 @@
+package service
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type UserTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmail confirms the address a verification link was sent to. For an
+// email change, that address becomes the user's email only now.
+func (s *UserService) VerifyEmail(req *UserTokenRequest, actor *model.Actor) error {
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		users := s.userRepository.WithTx(tx)
+		token, err := s.userTokenRepository.WithTx(tx).Consume(hashRefreshSecret(req.Token), model.UserTokenEmailVerification, time.Now())
+		if err != nil {
+			return err
+		}
+		user, err := users.FindByID(token.UserID)
+		if err != nil {
+			return utils.ErrInvalidUserToken
+		}
+		before := user.Email
+		if token.Email != user.Email {
+			if other, err := users.FindByEmail(token.Email); err == nil && other.ID != user.ID {
+				return utils.ErrExistedEmail
+			}
+			user.Email = token.Email
+		}
+		user.EmailVerified = true
+		if err := users.Update(user); err != nil {
+			return err
+		}
+		if before == user.Email {
+			return nil
+		}
+		changeActor := *actor
+		changeActor.UserID = user.ID
+		return audit.Record(&changeActor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+			map[string]string{"email": before}, map[string]string{"email": user.Email})
+	})
+}
+
+// ResendVerification sends a new verification link to an unverified user.
+// It reports success for unknown or verified addresses too, so it cannot be
+// used to find out which addresses are registered.
+func (s *UserService) ResendVerification(req *EmailRequest) error {
+	user, err := s.userRepository.FindByEmail(strings.TrimSpace(req.Email))
+	if err != nil || user.EmailVerified || user.Disabled {
+		return nil
+	}
+	return s.sendVerification(user, user.Email)
+}
+
+// ChangeEmail sends a verification link to the new address. The email only
+// changes once the link is followed, so a mistyped or someone else's address
+// never takes over the account.
+func (s *UserService) ChangeEmail(userID uint, req *ChangeEmailRequest) error {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return utils.ErrUserNotExists
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		return utils.ErrWrongPassword
+	}
+	email := strings.TrimSpace(req.Email)
+	if !emailRegex.MatchString(email) {
+		return utils.ErrInvalidEmail
+	}
+	if _, err := s.userRepository.FindByEmail(email); err == nil {
+		return utils.ErrExistedEmail
+	}
+	return s.sendVerification(user, email)
+}
+
+// ChangePassword sets a new password after checking the current one, and
+// logs out every other session.
+func (s *UserService) ChangePassword(userID uint, sessionID string, req *ChangePasswordRequest, actor *model.Actor) error {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return utils.ErrUserNotExists
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		return utils.ErrWrongPassword
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.setPassword(tx, user, req.NewPassword); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepository.WithTx(tx).RevokeOthers(user.ID, sessionID); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+			nil, map[string]string{"password": "changed"})
+	})
+}
+
+// ForgotPassword emails a reset link if the address belongs to a user. It
+// reports success either way.
+func (s *UserService) ForgotPassword(req *EmailRequest) error {
+	user, err := s.userRepository.FindByEmail(strings.TrimSpace(req.Email))
+	if err != nil || user.Disabled {
+		return nil
+	}
+	token, err := s.newUserToken(user, model.UserTokenPasswordReset, user.Email, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	s.sendMail(user.Email, "Reset your finsys password",
+		"Someone asked to reset the password of "+user.Username+". If it was you, set a new one here within an hour:\n\n"+
+			s.link("/reset-password", token)+"\n\nOtherwise you can ignore this email.")
+	return nil
+}
+
+// ResetPassword sets a new password with a reset link, logs out every
+// session and lifts any login lockout.
+func (s *UserService) ResetPassword(req *ResetPasswordRequest, actor *model.Actor) error {
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+	var user *model.User
+	err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		token, err := s.userTokenRepository.WithTx(tx).Consume(hashRefreshSecret(req.Token), model.UserTokenPasswordReset, time.Now())
+		if err != nil {
+			return err
+		}
+		user, err = s.userRepository.WithTx(tx).FindByID(token.UserID)
+		if err != nil || user.Disabled {
+			return utils.ErrInvalidUserToken
+		}
+		if err := s.setPassword(tx, user, req.Password); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepository.WithTx(tx).RevokeByUser(user.ID); err != nil {
+			return err
+		}
+		resetActor := *actor
+		resetActor.UserID = user.ID
+		return audit.Record(&resetActor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+			nil, map[string]string{"password": "reset"})
+	})
+	if err != nil {
+		return err
+	}
+	return s.securityService.RecordSuccess(user.Username)
+}
+
+// sendVerification emails a link that verifies email for user.
+func (s *UserService) sendVerification(user *model.User, email string) error {
+	token, err := s.newUserToken(user, model.UserTokenEmailVerification, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	s.sendMail(email, "Verify your finsys email address",
+		"Confirm that "+email+" belongs to "+user.Username+" by opening this link within a day:\n\n"+
+			s.link("/verify-email", token))
+	return nil
+}
+
+func (s *UserService) newUserToken(user *model.User, purpose, email string, ttl time.Duration) (string, error) {
+	token := randomHex(32)
+	now := time.Now()
+	if err := s.userTokenRepository.Create(&model.UserToken{
+		ID:        hashRefreshSecret(token),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *UserService) link(path, token string) string {
+	return strings.TrimSuffix(s.mailConfig.LinkBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMail sends in the background, so a slow mail server neither holds up
+// the request nor shows in its timing whether an address is registered.
+func (s *UserService) sendMail(to, subject, body string) {
+	go func() {
+		if err := s.mailer.Send(to, subject, body); err != nil {
+			log.Printf("Fail to send %q to %s: %v", subject, to, err)
+		}
+	}()
+}
+
+func (s *UserService) setPassword(tx *gorm.DB, user *model.User, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	user.Password = password
+	return s.userRepository.WithTx(tx).Update(user)
+}
+
+func validatePassword(password string) error {
+	if len(password) < 6 || len(password) > 20 {
+		return utils.ErrInvalidPassword
+	}
+	return nil
+}
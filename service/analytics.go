@@ -0,0 +1,133 @@
+package service
+
+import (
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHistogramBins = 10
+	maxHistogramBins     = 100
+	defaultTopAccounts   = 10
+	maxTopAccounts       = 100
+)
+
+type AnalyticsService struct {
+	analyticsRepository repository.AnalyticsRepository
+}
+
+func NewAnalyticsService(db *gorm.DB) *AnalyticsService {
+	return &AnalyticsService{
+		analyticsRepository: repository.NewAnalyticsRepository(db),
+	}
+}
+
+type VolumeResponse struct {
+	Bucket  string                `json:"bucket"`
+	Buckets []*model.VolumeBucket `json:"buckets"`
+}
+
+type FraudRateResponse struct {
+	Bucket  string                   `json:"bucket"`
+	Buckets []*model.FraudRateBucket `json:"buckets"`
+}
+
+type HistogramResponse struct {
+	Total int64                `json:"total"`
+	Bins  []model.HistogramBin `json:"bins"`
+}
+
+type TopAccountsResponse struct {
+	Side     string                `json:"side"`
+	Accounts []*model.AccountTotal `json:"accounts"`
+}
+
+func (s *AnalyticsService) Volume(bucket string, filter *model.TransactionFilter) (*VolumeResponse, error) {
+	if bucket == "" {
+		bucket = model.BucketDay
+	}
+	buckets, err := s.analyticsRepository.VolumeByType(bucket, filter)
+	if err != nil {
+		return nil, err
+	}
+	if buckets == nil {
+		buckets = []*model.VolumeBucket{}
+	}
+	return &VolumeResponse{Bucket: bucket, Buckets: buckets}, nil
+}
+
+func (s *AnalyticsService) FraudRate(bucket string, filter *model.TransactionFilter) (*FraudRateResponse, error) {
+	if bucket == "" {
+		bucket = model.BucketDay
+	}
+	buckets, err := s.analyticsRepository.FraudRate(bucket, filter)
+	if err != nil {
+		return nil, err
+	}
+	if buckets == nil {
+		buckets = []*model.FraudRateBucket{}
+	}
+	for _, b := range buckets {
+		if b.Total > 0 {
+			b.Rate = float64(b.Fraud) / float64(b.Total)
+		}
+	}
+	return &FraudRateResponse{Bucket: bucket, Buckets: buckets}, nil
+}
+
+func (s *AnalyticsService) ProbabilityHistogram(bins int, filter *model.TransactionFilter) (*HistogramResponse, error) {
+	if bins == 0 {
+		bins = defaultHistogramBins
+	}
+	if bins < 1 || bins > maxHistogramBins {
+		return nil, utils.ErrInvalidHistogramBins
+	}
+	counts, err := s.analyticsRepository.ProbabilityHistogram(bins, filter)
+	if err != nil {
+		return nil, err
+	}
+	response := &HistogramResponse{Bins: make([]model.HistogramBin, bins)}
+	width := 1 / float64(bins)
+	for i, count := range counts {
+		response.Bins[i] = model.HistogramBin{
+			Lower: float64(i) * width,
+			Upper: float64(i+1) * width,
+			Count: count,
+		}
+		response.Total += count
+	}
+	return response, nil
+}
+
+// TopAccounts ranks originators (side "orig") or destinations (side "dest")
+// by the total amount of their matching transactions.
+func (s *AnalyticsService) TopAccounts(side string, limit int, filter *model.TransactionFilter) (*TopAccountsResponse, error) {
+	if side == "" {
+		side = "orig"
+	}
+	var column string
+	switch side {
+	case "orig":
+		column = "name_orig"
+	case "dest":
+		column = "name_dest"
+	default:
+		return nil, utils.ErrInvalidAccountSide
+	}
+	if limit <= 0 {
+		limit = defaultTopAccounts
+	}
+	if limit > maxTopAccounts {
+		limit = maxTopAccounts
+	}
+	accounts, err := s.analyticsRepository.TopAccounts(column, limit, filter)
+	if err != nil {
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []*model.AccountTotal{}
+	}
+	return &TopAccountsResponse{Side: side, Accounts: accounts}, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+// APIKeyService issues and revokes the API keys scripts use instead of
+// logging in as a person.
+type APIKeyService struct {
+	apiKeyRepository repository.APIKeyRepository
+	userRepository   repository.UserRepository
+	auditService     *AuditService
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepository: repository.NewAPIKeyRepository(config.DB),
+		userRepository:   repository.NewUserRepository(config.DB),
+		auditService:     NewAuditService(config.DB),
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	UserID    uint       `json:"user_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	*model.APIKey
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyCreatedResponse carries the full key, which is shown only once.
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	Total int64            `json:"total"`
+	Page  int              `json:"page"`
+	Size  int              `json:"size"`
+	Keys  []APIKeyResponse `json:"keys"`
+}
+
+func newAPIKeyResponse(key *model.APIKey) APIKeyResponse {
+	return APIKeyResponse{APIKey: key, Scopes: key.ScopeList()}
+}
+
+// Create issues a key acting as req.UserID. Every scope has to be one keys
+// can hold and one the user's role grants.
+func (s *APIKeyService) Create(req *CreateAPIKeyRequest, actor *model.Actor) (*APIKeyCreatedResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, utils.ErrInvalidAPIKeyName
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, utils.ErrInvalidExpiry
+	}
+	user, err := s.userRepository.FindByID(req.UserID)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	if user.Disabled {
+		return nil, utils.ErrUserDisabled
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !model.ValidAPIKeyScope(scope) {
+			return nil, utils.ErrInvalidAPIKeyScope
+		}
+		if !model.HasPermission(user.Role, scope) {
+			return nil, utils.ErrAPIKeyScopeNotGranted
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, utils.ErrInvalidAPIKeyScope
+	}
+	prefix := model.APIKeyPrefix + randomHex(6)
+	secret := randomHex(32)
+	key := &model.APIKey{
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: model.HashAPIKeySecret(secret),
+		UserID:     user.ID,
+		Scopes:     strings.Join(scopes, ","),
+		CreatedBy:  actor.UserID,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	var response APIKeyResponse
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.apiKeyRepository.WithTx(tx).Create(key); err != nil {
+			return err
+		}
+		response = newAPIKeyResponse(key)
+		return audit.Record(actor, model.AuditActionCreate, model.AuditEntityAPIKey, key.ID, nil, response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyCreatedResponse{APIKeyResponse: response, Key: prefix + "_" + secret}, nil
+}
+
+func (s *APIKeyService) List(page, size int, userID *uint) (*APIKeyListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 20
+	}
+	keys, total, err := s.apiKeyRepository.List(page, size, userID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		responses = append(responses, newAPIKeyResponse(key))
+	}
+	return &APIKeyListResponse{
+		Total: total,
+		Page:  page,
+		Size:  size,
+		Keys:  responses,
+	}, nil
+}
+
+// Revoke stops a key from working. Revoking it again changes nothing.
+func (s *APIKeyService) Revoke(id uint, actor *model.Actor) (*APIKeyResponse, error) {
+	key, err := s.apiKeyRepository.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt == nil {
+		before := newAPIKeyResponse(key)
+		now := time.Now()
+		revoked := *key
+		revoked.RevokedAt = &now
+		err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+			if err := s.apiKeyRepository.WithTx(tx).Revoke(key.ID, now); err != nil {
+				return err
+			}
+			return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityAPIKey, key.ID,
+				before, newAPIKeyResponse(&revoked))
+		})
+		if err != nil {
+			return nil, err
+		}
+		key = &revoked
+	}
+	response := newAPIKeyResponse(key)
+	return &response, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"gorm.io/gorm"
+)
+
+const auditVerifyBatchSize = 1000
+
+type AuditService struct {
+	db                 *gorm.DB
+	auditLogRepository repository.AuditLogRepository
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{
+		db:                 db,
+		auditLogRepository: repository.NewAuditLogRepository(db),
+	}
+}
+
+// Transaction runs fn in a database transaction. Entries recorded through the
+// audit service passed to fn are written in that transaction, so a change and
+// its audit entry are committed or rolled back together. fn must make all of
+// its writes through tx.
+func (s *AuditService) Transaction(fn func(tx *gorm.DB, audit *AuditService) error) error {
+	return repository.AuditedTransaction(s.db, func(tx *gorm.DB) error {
+		return fn(tx, &AuditService{db: tx, auditLogRepository: s.auditLogRepository.WithTx(tx)})
+	})
+}
+
+type AuditLogResponse struct {
+	*model.AuditLog
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditListResponse struct {
+	Total   int64              `json:"total"`
+	Page    int                `json:"page"`
+	Size    int                `json:"size"`
+	Entries []AuditLogResponse `json:"entries"`
+}
+
+// AuditVerifyResponse reports the first entry whose hash or link to the
+// previous entry does not match. Removing entries from the end of the log
+// cannot be detected from the log alone.
+type AuditVerifyResponse struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenID uint   `json:"brokenId,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Record appends a change to the audit log. before and after are stored as
+// JSON; pass nil for the side that does not exist.
+func (s *AuditService) Record(actor *model.Actor, action, entity string, entityID uint, before, after interface{}) error {
+	entry := &model.AuditLog{
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+	}
+	if actor != nil {
+		entry.ActorID = actor.UserID
+		entry.RequestID = actor.RequestID
+		entry.IP = actor.IP
+	}
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		entry.Before = string(data)
+	}
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err != nil {
+			return err
+		}
+		entry.After = string(data)
+	}
+	return s.auditLogRepository.Append(entry)
+}
+
+func (s *AuditService) List(page, size int, filter *model.AuditFilter) (*AuditListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 20
+	}
+	entries, total, err := s.auditLogRepository.List(page, size, filter)
+	if err != nil {
+		return nil, err
+	}
+	response := &AuditListResponse{
+		Total:   total,
+		Page:    page,
+		Size:    size,
+		Entries: make([]AuditLogResponse, len(entries)),
+	}
+	for i, entry := range entries {
+		response.Entries[i] = newAuditLogResponse(entry)
+	}
+	return response, nil
+}
+
+func (s *AuditService) GetByID(id uint) (*AuditLogResponse, error) {
+	entry, err := s.auditLogRepository.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	response := newAuditLogResponse(entry)
+	return &response, nil
+}
+
+// Verify walks the log from the first entry and recomputes the hash chain.
+func (s *AuditService) Verify() (*AuditVerifyResponse, error) {
+	response := &AuditVerifyResponse{Valid: true}
+	prevHash := ""
+	err := s.auditLogRepository.Each(auditVerifyBatchSize, func(entries []*model.AuditLog) error {
+		for _, entry := range entries {
+			if !response.Valid {
+				return nil
+			}
+			response.Checked++
+			switch {
+			case entry.PrevHash != prevHash:
+				response.Valid, response.BrokenID, response.Reason = false, entry.ID, "entry does not link to the previous entry"
+			case entry.ComputeHash() != entry.Hash:
+				response.Valid, response.BrokenID, response.Reason = false, entry.ID, "entry content does not match its hash"
+			}
+			prevHash = entry.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func actorUserID(actor *model.Actor) uint {
+	if actor == nil {
+		return 0
+	}
+	return actor.UserID
+}
+
+func newAuditLogResponse(entry *model.AuditLog) AuditLogResponse {
+	response := AuditLogResponse{AuditLog: entry}
+	if entry.Before != "" {
+		response.Before = json.RawMessage(entry.Before)
+	}
+	if entry.After != "" {
+		response.After = json.RawMessage(entry.After)
+	}
+	return response
+}
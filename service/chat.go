@@ -6,13 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
 )
 
+// chatPromptOverheadTokens is a generous estimate of the tokens the system
+// prompt adds to every request, reserved along with the user's prompt.
+const chatPromptOverheadTokens = 1500
+
 type ChatService struct {
-	llms map[string]model.LLM
+	llms                map[string]model.LLM
+	userRepository      repository.UserRepository
+	llmUsageService     *LLMUsageService
+	maxCompletionTokens int64
 }
 
 type ChatRequest struct {
@@ -21,19 +32,30 @@ type ChatRequest struct {
 }
 
 type ChatResponse struct {
-	Reply string `json:"reply"`
+	Reply string              `json:"reply"`
+	Usage model.LLMTokenUsage `json:"usage"`
 }
 
 func NewChatService() *ChatService {
-	appConfig := config.DefaultConfig()
+	appConfig := config.Current()
 	llms := make(map[string]model.LLM)
-	llms["qwen"] = NewQwenLLM(appConfig.LLM.APIKey)
+	var qwen model.LLM = NewQwenLLM(appConfig.LLM.APIKey, appConfig.LLM.BaseURL)
+	if appConfig.Redaction.Enabled {
+		qwen = NewRedactingLLM(qwen, &appConfig.Redaction)
+	}
+	llms["qwen"] = qwen
 	return &ChatService{
-		llms: llms,
+		llms:                llms,
+		userRepository:      repository.NewUserRepository(config.DB),
+		llmUsageService:     NewLLMUsageService(),
+		maxCompletionTokens: appConfig.LLM.MaxCompletionTokens,
 	}
 }
 
-func (s *ChatService) HandleChat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+// HandleChat answers req for userID within their token budget and records
+// the tokens it used. The prompt is estimated at a token per character, which
+// overestimates most text, plus the system prompt and the longest reply.
+func (s *ChatService) HandleChat(ctx context.Context, req *ChatRequest, userID uint) (*ChatResponse, error) {
 	if req.Prompt == "" {
 		return nil, errors.New("prompt cannot be empty")
 	}
@@ -48,15 +70,30 @@ func (s *ChatService) HandleChat(ctx context.Context, req *ChatRequest) (*ChatRe
 	if llmClient == nil {
 		return nil, fmt.Errorf("unsupported model: %s", modelName)
 	}
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	reservation, err := s.llmUsageService.Reserve(user, modelName, model.LLMTokenUsage{
+		PromptTokens:     chatPromptOverheadTokens + int64(utf8.RuneCountInString(req.Prompt)),
+		CompletionTokens: s.maxCompletionTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
 	llmReq := &model.LLMChatRequest{
 		Model: modelName,
 		Messages: []model.LLMMessage{
 			{Role: "user", Content: req.Prompt},
 		},
+		MaxTokens: s.maxCompletionTokens,
 	}
+	start := time.Now()
 	llmResp, err := llmClient.Chat(ctx, llmReq)
 	if err != nil {
+		s.llmUsageService.Release(reservation)
 		return nil, fmt.Errorf("failed to get reply from LLM: %w", err)
 	}
-	return &ChatResponse{Reply: llmResp.Content}, nil
+	s.llmUsageService.Settle(reservation, llmResp.Usage, time.Since(start))
+	return &ChatResponse{Reply: llmResp.Content, Usage: llmResp.Usage}, nil
 }
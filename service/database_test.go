@@ -0,0 +1,32 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/migration"
+	"gorm.io/gorm"
+)
+
+// openTestDB returns a migrated SQLite database of the test's own. The
+// repository tests cover the other databases.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dbConfig := config.DefaultDBConfig()
+	dbConfig.Path = filepath.Join(t.TempDir(), "finsys.db")
+	dbConfig.LogLevel = "silent"
+	db, err := config.OpenDB(dbConfig)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if _, err := migration.Up(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/go-pdf/fpdf"
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportFormatCSV      = "csv"
+	ExportFormatJSONL    = "jsonl"
+	ExportFormatParquet  = "parquet"
+	ExportFormatMarkdown = "md"
+	ExportFormatPDF      = "pdf"
+
+	exportBatchSize = 1000
+)
+
+var transactionExportContentTypes = map[string]string{
+	ExportFormatCSV:     "text/csv; charset=utf-8",
+	ExportFormatJSONL:   "application/x-ndjson",
+	ExportFormatParquet: "application/vnd.apache.parquet",
+}
+
+func TransactionExportContentType(format string) (string, bool) {
+	contentType, ok := transactionExportContentTypes[format]
+	return contentType, ok
+}
+
+type ExportService struct {
+	transactionRepository repository.TransactionRepository
+	fraudReportRepository repository.FraudReportRepository
+}
+
+func NewExportService(db *gorm.DB) *ExportService {
+	return &ExportService{
+		transactionRepository: repository.NewTransactionRepository(db),
+		fraudReportRepository: newFraudReportRepository(db),
+	}
+}
+
+// TransactionExportRow is the exported form of a transaction. Its CSV header
+// matches the import columns, so an export can be imported again.
+type TransactionExportRow struct {
+	ID               uint      `json:"id" parquet:"id"`
+	Type             string    `json:"type" parquet:"type"`
+	Amount           float64   `json:"amount" parquet:"amount"`
+	NameOrig         string    `json:"nameOrig" parquet:"nameOrig"`
+	OldBalanceOrig   float64   `json:"oldBalanceOrig" parquet:"oldBalanceOrig"`
+	NewBalanceOrig   float64   `json:"newBalanceOrig" parquet:"newBalanceOrig"`
+	NameDest         string    `json:"nameDest" parquet:"nameDest"`
+	OldBalanceDest   float64   `json:"oldBalanceDest" parquet:"oldBalanceDest"`
+	NewBalanceDest   float64   `json:"newBalanceDest" parquet:"newBalanceDest"`
+	IsFraud          bool      `json:"isFraud" parquet:"isFraud"`
+	FraudProbability float64   `json:"fraudProbability" parquet:"fraudProbability"`
+	CreatedAt        time.Time `json:"createdAt" parquet:"createdAt,timestamp(millisecond)"`
+	UpdatedAt        time.Time `json:"updatedAt" parquet:"updatedAt,timestamp(millisecond)"`
+}
+
+var transactionExportHeader = []string{"id", "type", "amount", "nameOrig", "oldBalanceOrig", "newBalanceOrig", "nameDest", "oldBalanceDest", "newBalanceDest", "isFraud", "fraudProbability", "createdAt", "updatedAt"}
+
+func newTransactionExportRow(transaction *model.Transaction) TransactionExportRow {
+	return TransactionExportRow{
+		ID:               transaction.ID,
+		Type:             transaction.Type,
+		Amount:           transaction.Amount,
+		NameOrig:         transaction.NameOrig,
+		OldBalanceOrig:   transaction.OldBalanceOrig,
+		NewBalanceOrig:   transaction.NewBalanceOrig,
+		NameDest:         transaction.NameDest,
+		OldBalanceDest:   transaction.OldBalanceDest,
+		NewBalanceDest:   transaction.NewBalanceDest,
+		IsFraud:          transaction.IsFraud,
+		FraudProbability: transaction.FraudProbability,
+		CreatedAt:        transaction.CreatedAt,
+		UpdatedAt:        transaction.UpdatedAt,
+	}
+}
+
+// ExportTransactions writes every transaction matching filter to w in the
+// given format. Rows are read and written in batches so memory use does not
+// grow with the size of the table.
+func (s *ExportService) ExportTransactions(w io.Writer, format string, filter *model.TransactionFilter) error {
+	switch format {
+	case ExportFormatCSV:
+		return s.exportTransactionsCSV(w, filter)
+	case ExportFormatJSONL:
+		return s.exportTransactionsJSONL(w, filter)
+	case ExportFormatParquet:
+		return s.exportTransactionsParquet(w, filter)
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
+func (s *ExportService) exportTransactionsCSV(w io.Writer, filter *model.TransactionFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(transactionExportHeader); err != nil {
+		return err
+	}
+	err := s.transactionRepository.Each(filter, exportBatchSize, func(transactions []*model.Transaction) error {
+		for _, transaction := range transactions {
+			isFraud := "0"
+			if transaction.IsFraud {
+				isFraud = "1"
+			}
+			record := []string{
+				strconv.FormatUint(uint64(transaction.ID), 10),
+				transaction.Type,
+				formatExportFloat(transaction.Amount),
+				transaction.NameOrig,
+				formatExportFloat(transaction.OldBalanceOrig),
+				formatExportFloat(transaction.NewBalanceOrig),
+				transaction.NameDest,
+				formatExportFloat(transaction.OldBalanceDest),
+				formatExportFloat(transaction.NewBalanceDest),
+				isFraud,
+				formatExportFloat(transaction.FraudProbability),
+				transaction.CreatedAt.Format(time.RFC3339),
+				transaction.UpdatedAt.Format(time.RFC3339),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *ExportService) exportTransactionsJSONL(w io.Writer, filter *model.TransactionFilter) error {
+	encoder := json.NewEncoder(w)
+	return s.transactionRepository.Each(filter, exportBatchSize, func(transactions []*model.Transaction) error {
+		for _, transaction := range transactions {
+			if err := encoder.Encode(newTransactionExportRow(transaction)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// exportTransactionsParquet writes one row group per batch so that only a
+// single batch is buffered by the parquet writer at a time.
+func (s *ExportService) exportTransactionsParquet(w io.Writer, filter *model.TransactionFilter) error {
+	writer := parquet.NewGenericWriter[TransactionExportRow](w)
+	rows := make([]TransactionExportRow, 0, exportBatchSize)
+	err := s.transactionRepository.Each(filter, exportBatchSize, func(transactions []*model.Transaction) error {
+		rows = rows[:0]
+		for _, transaction := range transactions {
+			rows = append(rows, newTransactionExportRow(transaction))
+		}
+		if _, err := writer.Write(rows); err != nil {
+			return err
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// ExportFraudReports writes a ZIP archive to w with one Markdown or PDF file
+// per fraud report.
+func (s *ExportService) ExportFraudReports(w io.Writer, format string) error {
+	if format != ExportFormatMarkdown && format != ExportFormatPDF {
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+	archive := zip.NewWriter(w)
+	err := s.fraudReportRepository.Each(exportBatchSize, func(reports []*model.FraudReport) error {
+		for _, report := range reports {
+			header := &zip.FileHeader{
+				Name:     fmt.Sprintf("fraud-report-%d-transaction-%d.%s", report.ID, report.TransactionID, format),
+				Method:   zip.Deflate,
+				Modified: report.UpdatedAt,
+			}
+			file, err := archive.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if format == ExportFormatPDF {
+				err = renderReportPDF(file, report.Report)
+			} else {
+				_, err = io.WriteString(file, report.Report)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// renderReportPDF lays out the Markdown produced by the report generator:
+// headings, bullet lists and bold markers. Other Markdown is written as text.
+func renderReportPDF(w io.Writer, markdown string) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.ReplaceAll(strings.TrimRight(line, " "), "**", "")
+		switch {
+		case strings.HasPrefix(line, "# "):
+			pdf.SetFont("Helvetica", "B", 16)
+			pdf.MultiCell(0, 9, translate(strings.TrimPrefix(line, "# ")), "", "L", false)
+		case strings.HasPrefix(line, "## "):
+			pdf.Ln(2)
+			pdf.SetFont("Helvetica", "B", 13)
+			pdf.MultiCell(0, 7, translate(strings.TrimPrefix(line, "## ")), "", "L", false)
+		case strings.HasPrefix(line, "- "):
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(0, 6, translate("  • "+strings.TrimPrefix(line, "- ")), "", "L", false)
+		case line == "":
+			pdf.Ln(3)
+		default:
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(0, 6, translate(line), "", "L", false)
+		}
+	}
+	return pdf.Output(w)
+}
+
+func formatExportFloat(num float64) string {
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
@@ -1,10 +1,12 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/Mitsui515/finsys/config"
 	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/repository"
 	"github.com/Mitsui515/finsys/utils"
@@ -14,15 +16,26 @@ import (
 type FraudReportService struct {
 	fraudReportRepository repository.FraudReportRepository
 	transactionRepository repository.TransactionRepository
+	auditService          *AuditService
 }
 
 func NewFraudReportService(db *gorm.DB) *FraudReportService {
 	return &FraudReportService{
-		fraudReportRepository: repository.NewFraudReportRepository(db),
+		fraudReportRepository: newFraudReportRepository(db),
 		transactionRepository: repository.NewTransactionRepository(db),
+		auditService:          NewAuditService(db),
 	}
 }
 
+// newFraudReportRepository returns the repository for the configured report
+// storage. MongoDB storage needs config.InitMongoDB to have run.
+func newFraudReportRepository(db *gorm.DB) repository.FraudReportRepository {
+	if config.Current().Report.Storage == config.ReportStorageMongo && config.MongoDB != nil {
+		return repository.NewMongoFraudReportRepository(db, config.MongoDB)
+	}
+	return repository.NewFraudReportRepository(db)
+}
+
 type FraudReportRequest struct {
 	TransactionID uint `json:"transaction_id"`
 }
@@ -42,7 +55,14 @@ type FraudReportListResponse struct {
 	Reports []FraudReportResponse `json:"reports"`
 }
 
-func (s *FraudReportService) Create(req *FraudReportRequest) (uint, error) {
+type FraudReportCursorResponse struct {
+	Total      *int64                `json:"total,omitempty"`
+	Size       int                   `json:"size"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	Reports    []FraudReportResponse `json:"reports"`
+}
+
+func (s *FraudReportService) Create(req *FraudReportRequest, actor *model.Actor) (uint, error) {
 	if req.TransactionID == 0 {
 		return 0, utils.ErrInvalidTransactionID
 	}
@@ -59,23 +79,33 @@ func (s *FraudReportService) Create(req *FraudReportRequest) (uint, error) {
 		TransactionID: req.TransactionID,
 		Report:        reportContent,
 	}
-	if err := s.fraudReportRepository.Create(report); err != nil {
+	if err := s.create(report, newReportVersion(transaction, actorUserID(actor)), actor); err != nil {
 		return 0, err
 	}
 	return report.ID, nil
 }
 
-func (s *FraudReportService) Update(id uint) (*FraudReportResponse, error) {
+// Update regenerates the report from the current transaction and keeps the
+// previous content as an earlier version.
+func (s *FraudReportService) Update(id uint, actor *model.Actor) (*FraudReportResponse, error) {
 	report, err := s.fraudReportRepository.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := *report
 	transaction, err := s.transactionRepository.FindByID(report.TransactionID)
 	if err != nil {
 		return nil, err
 	}
 	report.Report = generateFraudAnalysisReport(transaction)
-	if err := s.fraudReportRepository.Update(report); err != nil {
+	version := newReportVersion(transaction, actorUserID(actor))
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.fraudReportRepository.WithTx(tx).Update(report, version); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityFraudReport, report.ID, before, report)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &FraudReportResponse{
@@ -87,8 +117,27 @@ func (s *FraudReportService) Update(id uint) (*FraudReportResponse, error) {
 	}, nil
 }
 
-func (s *FraudReportService) Delete(id uint) error {
-	return s.fraudReportRepository.Delete(id)
+func (s *FraudReportService) Delete(id uint, actor *model.Actor) error {
+	report, err := s.fraudReportRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.fraudReportRepository.WithTx(tx).Delete(id); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionDelete, model.AuditEntityFraudReport, id, report, nil)
+	})
+}
+
+// create stores a new report and its audit entry in one transaction.
+func (s *FraudReportService) create(report *model.FraudReport, version *model.FraudReportVersion, actor *model.Actor) error {
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.fraudReportRepository.WithTx(tx).Create(report, version); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionCreate, model.AuditEntityFraudReport, report.ID, nil, report)
+	})
 }
 
 func (s *FraudReportService) GetByID(id uint) (*FraudReportResponse, error) {
@@ -148,7 +197,48 @@ func (s *FraudReportService) List(page, size int) (*FraudReportListResponse, err
 	return response, nil
 }
 
-func (s *FraudReportService) GenerateReport(transactionID uint) (*FraudReportResponse, error) {
+// ListByCursor returns the page of reports after the opaque cursor token,
+// newest first. The total is only counted when withTotal is set.
+func (s *FraudReportService) ListByCursor(cursor string, size int, withTotal bool) (*FraudReportCursorResponse, error) {
+	if size <= 0 {
+		size = 10
+	}
+	scope := utils.CursorScope("fraud_reports", nil)
+	after, err := utils.DecodeCursor(cursor, scope)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := s.fraudReportRepository.ListAfter(after, size+1)
+	if err != nil {
+		return nil, err
+	}
+	response := &FraudReportCursorResponse{Size: size}
+	if len(reports) > size {
+		reports = reports[:size]
+		last := reports[size-1]
+		response.NextCursor = utils.EncodeCursor(model.PageCursor{Time: last.GeneratedAt, ID: last.ID}, scope)
+	}
+	response.Reports = make([]FraudReportResponse, len(reports))
+	for i, report := range reports {
+		response.Reports[i] = FraudReportResponse{
+			ID:            report.ID,
+			TransactionID: report.TransactionID,
+			Report:        report.Report,
+			GeneratedAt:   report.GeneratedAt,
+			UpdatedAt:     report.UpdatedAt,
+		}
+	}
+	if withTotal {
+		total, err := s.fraudReportRepository.Count()
+		if err != nil {
+			return nil, err
+		}
+		response.Total = &total
+	}
+	return response, nil
+}
+
+func (s *FraudReportService) GenerateReport(transactionID uint, actor *model.Actor) (*FraudReportResponse, error) {
 	transaction, err := s.transactionRepository.FindByID(transactionID)
 	if err != nil {
 		return nil, err
@@ -172,7 +262,7 @@ func (s *FraudReportService) GenerateReport(transactionID uint) (*FraudReportRes
 		GeneratedAt:   time.Now(),
 		UpdatedAt:     time.Now(),
 	}
-	if err := s.fraudReportRepository.Create(report); err != nil {
+	if err := s.create(report, newReportVersion(transaction, actorUserID(actor)), actor); err != nil {
 		return nil, err
 	}
 	return &FraudReportResponse{
@@ -184,6 +274,99 @@ func (s *FraudReportService) GenerateReport(transactionID uint) (*FraudReportRes
 	}, nil
 }
 
+// ReportGenerator names the generator of the reports built by
+// generateFraudAnalysisReport in version history.
+const ReportGenerator = "rule-based"
+
+type FraudReportVersionResponse struct {
+	Version       int             `json:"version"`
+	Generator     string          `json:"generator"`
+	AuthorID      uint            `json:"author_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	InputSnapshot json.RawMessage `json:"input_snapshot,omitempty"`
+	Content       string          `json:"content,omitempty"`
+}
+
+type FraudReportDiffResponse struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// newReportVersion records who generated a report and from which transaction
+// data, so a version can be explained after the transaction changes.
+func newReportVersion(transaction *model.Transaction, authorID uint) *model.FraudReportVersion {
+	snapshot, _ := json.Marshal(transaction)
+	return &model.FraudReportVersion{
+		Generator:     ReportGenerator,
+		InputSnapshot: string(snapshot),
+		AuthorID:      authorID,
+	}
+}
+
+// Versions lists the versions of a report, oldest first, without their
+// content.
+func (s *FraudReportService) Versions(reportID uint) ([]FraudReportVersionResponse, error) {
+	if _, err := s.fraudReportRepository.FindByID(reportID); err != nil {
+		return nil, err
+	}
+	versions, err := s.fraudReportRepository.ListVersions(reportID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]FraudReportVersionResponse, len(versions))
+	for i, version := range versions {
+		responses[i] = FraudReportVersionResponse{
+			Version:   version.Version,
+			Generator: version.Generator,
+			AuthorID:  version.AuthorID,
+			CreatedAt: version.CreatedAt,
+		}
+	}
+	return responses, nil
+}
+
+func (s *FraudReportService) GetVersion(reportID uint, number int) (*FraudReportVersionResponse, error) {
+	if _, err := s.fraudReportRepository.FindByID(reportID); err != nil {
+		return nil, err
+	}
+	version, err := s.fraudReportRepository.FindVersion(reportID, number)
+	if err != nil {
+		return nil, err
+	}
+	response := &FraudReportVersionResponse{
+		Version:   version.Version,
+		Generator: version.Generator,
+		AuthorID:  version.AuthorID,
+		CreatedAt: version.CreatedAt,
+		Content:   version.Content,
+	}
+	if version.InputSnapshot != "" {
+		response.InputSnapshot = json.RawMessage(version.InputSnapshot)
+	}
+	return response, nil
+}
+
+// Diff compares the content of two versions of a report as a unified diff.
+func (s *FraudReportService) Diff(reportID uint, from, to int) (*FraudReportDiffResponse, error) {
+	if _, err := s.fraudReportRepository.FindByID(reportID); err != nil {
+		return nil, err
+	}
+	fromVersion, err := s.fraudReportRepository.FindVersion(reportID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := s.fraudReportRepository.FindVersion(reportID, to)
+	if err != nil {
+		return nil, err
+	}
+	return &FraudReportDiffResponse{
+		From: from,
+		To:   to,
+		Diff: unifiedDiff(fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to), fromVersion.Content, toVersion.Content),
+	}, nil
+}
+
 func generateFraudAnalysisReport(transaction *model.Transaction) string {
 	var result string
 	result = "# Transaction Fraud Analysis Report\n\n"
@@ -0,0 +1,649 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	importBatchSize = 90
+	maxImportErrors = 1000
+)
+
+// importRunner tracks the import jobs running in this process. It is shared by
+// every ImportService so that a job can be cancelled from any request.
+type importRunner struct {
+	mu      sync.Mutex
+	cancels map[uint]context.CancelFunc
+	slots   chan struct{}
+}
+
+// importJobs is created by the first NewImportService, once the
+// configuration has been loaded.
+var (
+	importJobs     *importRunner
+	importJobsOnce sync.Once
+)
+
+func newImportRunner(maxConcurrent int) *importRunner {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return &importRunner{
+		cancels: make(map[uint]context.CancelFunc),
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (r *importRunner) register(id uint) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+	return ctx
+}
+
+func (r *importRunner) release(id uint) {
+	r.mu.Lock()
+	if cancel, ok := r.cancels[id]; ok {
+		cancel()
+		delete(r.cancels, id)
+	}
+	r.mu.Unlock()
+}
+
+func (r *importRunner) cancel(id uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+const spoolSweepInterval = time.Hour
+
+type ImportService struct {
+	db                      *gorm.DB
+	transactionRepository   repository.TransactionRepository
+	importJobRepository     repository.ImportJobRepository
+	importProfileRepository repository.ImportProfileRepository
+	spoolDir                string
+	maxUploadBytes          int64
+	spoolRetention          time.Duration
+}
+
+func NewImportService(db *gorm.DB) *ImportService {
+	importJobsOnce.Do(func() {
+		importJobs = newImportRunner(config.Current().Import.MaxConcurrent)
+	})
+	return &ImportService{
+		db:                      db,
+		transactionRepository:   repository.NewTransactionRepository(db),
+		importJobRepository:     repository.NewImportJobRepository(db),
+		importProfileRepository: repository.NewImportProfileRepository(db),
+		spoolDir:                config.Current().Import.SpoolDir,
+		maxUploadBytes:          config.Current().Import.MaxUploadBytes,
+		spoolRetention:          config.Current().Import.SpoolRetention,
+	}
+}
+
+// ImportUpload is an upload written to the spool directory that has not been
+// submitted yet.
+type ImportUpload struct {
+	Filename string
+	Path     string
+	Size     int64
+}
+
+// Discard deletes the spooled file of an upload that will not be submitted.
+func (u *ImportUpload) Discard() {
+	os.Remove(u.Path)
+}
+
+type ImportOptions struct {
+	Format    string
+	ProfileID uint
+	Mapping   ColumnMapping
+	DryRun    bool
+	UserID    uint
+}
+
+type ImportResult struct {
+	JobID          uint                   `json:"job_id"`
+	Filename       string                 `json:"filename"`
+	Format         string                 `json:"format"`
+	Status         string                 `json:"status"`
+	DryRun         bool                   `json:"dry_run"`
+	TotalRows      int                    `json:"total_rows"`
+	AcceptedRows   int                    `json:"accepted_rows"`
+	RejectedRows   int                    `json:"rejected_rows"`
+	Checkpoint     int                    `json:"checkpoint"`
+	BytesTotal     int64                  `json:"bytes_total"`
+	BytesRead      int64                  `json:"bytes_read"`
+	Progress       float64                `json:"progress"`
+	ElapsedSeconds float64                `json:"elapsed_seconds"`
+	RowsPerSecond  float64                `json:"rows_per_second"`
+	BytesPerSecond float64                `json:"bytes_per_second"`
+	Message        string                 `json:"message,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	StartedAt      time.Time              `json:"started_at"`
+	FinishedAt     time.Time              `json:"finished_at"`
+	Errors         []model.ImportRowError `json:"errors"`
+}
+
+// Spool copies an upload into the spool directory as it is read, so the
+// upload is never held in memory. Uploads larger than the configured limit are
+// rejected with ErrImportTooLarge.
+func (s *ImportService) Spool(filename string, src io.Reader) (*ImportUpload, error) {
+	if err := os.MkdirAll(s.spoolDir, 0o755); err != nil {
+		return nil, err
+	}
+	spool, err := os.CreateTemp(s.spoolDir, "import-*"+filepath.Ext(filename))
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(spool, io.LimitReader(src, s.maxUploadBytes+1))
+	if err == nil && size > s.maxUploadBytes {
+		err = utils.ErrImportTooLarge
+	}
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(spool.Name())
+		return nil, err
+	}
+	return &ImportUpload{Filename: filename, Path: spool.Name(), Size: size}, nil
+}
+
+// Submit records a queued import job for a spooled upload and processes it in
+// the background. The format is detected from the file name and content
+// unless opts.Format is set. The returned result describes the queued job.
+// The spooled file is deleted if the job cannot be created.
+func (s *ImportService) Submit(upload *ImportUpload, opts *ImportOptions) (*ImportResult, error) {
+	job, err := s.newJob(upload, opts)
+	if err != nil {
+		upload.Discard()
+		return nil, err
+	}
+	result := newImportResult(job, nil)
+	s.start(job, nil)
+	return result, nil
+}
+
+func (s *ImportService) newJob(upload *ImportUpload, opts *ImportOptions) (*model.ImportJob, error) {
+	settings, err := s.resolveSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	format := opts.Format
+	if format == "" {
+		if format, err = detectSpoolFormat(upload); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := NewImporter(format); err != nil {
+		return nil, err
+	}
+	job := &model.ImportJob{
+		Filename:   upload.Filename,
+		SpoolPath:  upload.Path,
+		Format:     format,
+		ProfileID:  opts.ProfileID,
+		Mapping:    string(mapping),
+		Status:     model.ImportStatusQueued,
+		DryRun:     opts.DryRun,
+		BytesTotal: upload.Size,
+		CreatedBy:  opts.UserID,
+	}
+	if err := s.importJobRepository.Create(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func detectSpoolFormat(upload *ImportUpload) (string, error) {
+	file, err := os.Open(upload.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return DetectImportFormat(upload.Filename, head[:n])
+}
+
+// resolveSettings combines the selected mapping profile with the column
+// mapping given for this import; the explicit mapping wins.
+func (s *ImportService) resolveSettings(opts *ImportOptions) (*ImportSettings, error) {
+	settings := &ImportSettings{}
+	if opts.ProfileID != 0 {
+		profile, err := s.importProfileRepository.FindByID(opts.ProfileID)
+		if err != nil {
+			return nil, err
+		}
+		if settings, err = newImportSettings(profile); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Mapping) > 0 {
+		if settings.Columns == nil {
+			settings.Columns = make(ColumnMapping)
+		}
+		for field, column := range opts.Mapping {
+			settings.Columns[field] = column
+		}
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// findJob loads a job for actor. Jobs belong to whoever submitted them, and
+// other users except administrators are told they do not exist.
+func (s *ImportService) findJob(id uint, actor *model.Actor) (*model.ImportJob, error) {
+	job, err := s.importJobRepository.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.CreatedBy != actor.UserID && actor.Role != model.RoleAdmin {
+		return nil, utils.ErrImportJobNotExists
+	}
+	return job, nil
+}
+
+// Resume restarts a failed or cancelled job from its last checkpoint, reusing
+// the spooled upload.
+func (s *ImportService) Resume(id uint, actor *model.Actor) (*ImportResult, error) {
+	job, err := s.findJob(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(job.SpoolPath); job.SpoolPath == "" || err != nil {
+		return nil, utils.ErrImportJobNotResume
+	}
+	requeued, err := s.importJobRepository.Requeue(id, model.ImportStatusFailed, model.ImportStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if !requeued {
+		return nil, utils.ErrImportJobNotResume
+	}
+	if job, err = s.importJobRepository.FindByID(id); err != nil {
+		return nil, err
+	}
+	rowErrors := decodeRowErrors(job.Errors)
+	result := newImportResult(job, rowErrors)
+	s.start(job, rowErrors)
+	return result, nil
+}
+
+func (s *ImportService) Cancel(id uint, actor *model.Actor) error {
+	job, err := s.findJob(id, actor)
+	if err != nil {
+		return err
+	}
+	if !job.IsActive() || !importJobs.cancel(id) {
+		return utils.ErrImportJobNotActive
+	}
+	return nil
+}
+
+func (s *ImportService) GetJob(id uint, actor *model.Actor) (*ImportResult, error) {
+	job, err := s.findJob(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	return newImportResult(job, decodeRowErrors(job.Errors)), nil
+}
+
+// RecoverInterrupted marks jobs left queued or running by a previous process
+// as failed so that they can be resumed.
+func (s *ImportService) RecoverInterrupted() error {
+	jobs, err := s.importJobRepository.FindByStatus(model.ImportStatusQueued, model.ImportStatusRunning)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		job.Status = model.ImportStatusFailed
+		job.Message = "interrupted by server restart"
+		job.FinishedAt = time.Now()
+		if err := s.importJobRepository.Update(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ImportService) start(job *model.ImportJob, rowErrors []model.ImportRowError) {
+	ctx := importJobs.register(job.ID)
+	go func() {
+		defer importJobs.release(job.ID)
+		select {
+		case importJobs.slots <- struct{}{}:
+			defer func() { <-importJobs.slots }()
+		case <-ctx.Done():
+			s.finishJob(job, rowErrors, model.ImportStatusCancelled, "cancelled before start")
+			return
+		}
+		if err := s.run(ctx, job, rowErrors); err != nil {
+			log.Printf("ERROR: import job %d failed: %v", job.ID, err)
+		}
+	}()
+}
+
+func (s *ImportService) run(ctx context.Context, job *model.ImportJob, rowErrors []model.ImportRowError) error {
+	file, err := os.Open(job.SpoolPath)
+	if err != nil {
+		s.finishJob(job, rowErrors, model.ImportStatusFailed, err.Error())
+		return err
+	}
+	defer file.Close()
+	job.Status = model.ImportStatusRunning
+	job.StartedAt = time.Now()
+	if err := s.importJobRepository.Update(job); err != nil {
+		return err
+	}
+	return s.importRows(ctx, job, rowErrors, &spooledFile{file: file, size: job.BytesTotal})
+}
+
+// importRows validates every row of the spooled file and stores the accepted
+// ones in batches. Each batch is committed in its own database transaction and
+// the position of the last committed row is saved on the import job, so a
+// failed or cancelled import can be resumed without duplicating rows.
+func (s *ImportService) importRows(ctx context.Context, job *model.ImportJob, rowErrors []model.ImportRowError, src *spooledFile) error {
+	// committed mirrors the job as of the last durable checkpoint; an
+	// interrupted import is recorded in that state so resuming it does not
+	// count rows twice.
+	committed, committedErrors := *job, len(rowErrors)
+	stop := func(status string, cause error) error {
+		*job = committed
+		s.finishJob(job, rowErrors[:committedErrors], status, cause.Error())
+		if status == model.ImportStatusCancelled {
+			return nil
+		}
+		return cause
+	}
+	var settings ImportSettings
+	if job.Mapping != "" {
+		if err := json.Unmarshal([]byte(job.Mapping), &settings); err != nil {
+			return stop(model.ImportStatusFailed, err)
+		}
+	}
+	parser, err := newRowParser(&settings)
+	if err != nil {
+		return stop(model.ImportStatusFailed, err)
+	}
+	importer, err := NewImporter(job.Format)
+	if err != nil {
+		return stop(model.ImportStatusFailed, err)
+	}
+	rows, err := importer.Open(src)
+	if err != nil {
+		return stop(model.ImportStatusFailed, err)
+	}
+	defer rows.Close()
+	if columns := rows.Columns(); columns != nil {
+		if err := settings.checkColumns(columns); err != nil {
+			return stop(model.ImportStatusFailed, err)
+		}
+	}
+	resumeFrom := job.Checkpoint
+	var transactions []model.Transaction
+	lastLine := 0
+	for {
+		if ctx.Err() != nil {
+			return stop(model.ImportStatusCancelled, errors.New("cancelled by user"))
+		}
+		line, row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		var decodeErr *RowDecodeError
+		if errors.As(err, &decodeErr) {
+			if decodeErr.Line > resumeFrom {
+				job.TotalRows++
+				job.RejectedRows++
+				rowErrors = appendRowErrors(rowErrors, model.ImportRowError{Line: decodeErr.Line, Reason: decodeErr.Error()})
+			}
+			continue
+		}
+		if err != nil {
+			return stop(model.ImportStatusFailed, err)
+		}
+		if line <= resumeFrom {
+			continue
+		}
+		job.TotalRows++
+		transaction, errs := parser.Parse(row, line)
+		if len(errs) > 0 {
+			job.RejectedRows++
+			rowErrors = appendRowErrors(rowErrors, errs...)
+			continue
+		}
+		transactions = append(transactions, transaction)
+		lastLine = line
+		if len(transactions) >= importBatchSize {
+			job.BytesRead = src.Count()
+			if err := s.commitBatch(job, transactions, lastLine); err != nil {
+				return stop(model.ImportStatusFailed, err)
+			}
+			committed, committedErrors = *job, len(rowErrors)
+			transactions = transactions[:0]
+		}
+	}
+	job.BytesRead = job.BytesTotal
+	if err := s.commitBatch(job, transactions, lastLine); err != nil {
+		return stop(model.ImportStatusFailed, err)
+	}
+	s.finishJob(job, rowErrors, model.ImportStatusCompleted, "")
+	return nil
+}
+
+// commitBatch stores a batch together with the job's counts and checkpoint in
+// one database transaction, so the checkpoint never points past or behind the
+// rows that were actually written.
+func (s *ImportService) commitBatch(job *model.ImportJob, transactions []model.Transaction, lastLine int) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	acceptedRows, checkpoint := job.AcceptedRows, job.Checkpoint
+	job.AcceptedRows += len(transactions)
+	job.Checkpoint = lastLine
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if !job.DryRun {
+			if err := s.transactionRepository.WithTx(tx).CreateBatch(transactions); err != nil {
+				return err
+			}
+		}
+		return s.importJobRepository.WithTx(tx).Update(job)
+	})
+	if err != nil {
+		job.AcceptedRows, job.Checkpoint = acceptedRows, checkpoint
+	}
+	return err
+}
+
+// finishJob records the final state of a job. The spooled upload is kept only
+// while the job can still be resumed.
+func (s *ImportService) finishJob(job *model.ImportJob, rowErrors []model.ImportRowError, status, message string) {
+	spoolPath := job.SpoolPath
+	resumable := !job.DryRun && (status == model.ImportStatusFailed || status == model.ImportStatusCancelled)
+	if !resumable {
+		job.SpoolPath = ""
+	}
+	job.Status = status
+	job.Message = message
+	job.FinishedAt = time.Now()
+	job.Errors = encodeRowErrors(rowErrors)
+	if err := s.importJobRepository.Update(job); err != nil {
+		log.Printf("ERROR: Failed to update import job %d: %v", job.ID, err)
+		return
+	}
+	if !resumable {
+		os.Remove(spoolPath)
+	}
+}
+
+// StartSpoolSweeper sweeps expired spooled uploads now and then periodically
+// in the background.
+func (s *ImportService) StartSpoolSweeper() {
+	sweep := func(now time.Time) {
+		if err := s.SweepSpools(now); err != nil {
+			log.Printf("Fail to sweep import spools: %v", err)
+		}
+	}
+	sweep(time.Now())
+	go func() {
+		for now := range time.Tick(spoolSweepInterval) {
+			sweep(now)
+		}
+	}()
+}
+
+// SweepSpools deletes the spooled uploads of failed and cancelled jobs that
+// finished longer than the spool retention ago. Such jobs can no longer be
+// resumed.
+func (s *ImportService) SweepSpools(now time.Time) error {
+	jobs, err := s.importJobRepository.FindFinishedBefore(now.Add(-s.spoolRetention),
+		model.ImportStatusFailed, model.ImportStatusCancelled)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		released, err := s.importJobRepository.ReleaseSpool(job.ID, model.ImportStatusFailed, model.ImportStatusCancelled)
+		if err != nil {
+			return err
+		}
+		if released {
+			os.Remove(job.SpoolPath)
+		}
+	}
+	return nil
+}
+
+// spooledFile is the ImportSource for a spooled upload. It counts the bytes
+// read so that progress can be reported while the job runs.
+type spooledFile struct {
+	file  *os.File
+	size  int64
+	count atomic.Int64
+}
+
+func (f *spooledFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.count.Add(int64(n))
+	return n, err
+}
+
+func (f *spooledFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	f.count.Add(int64(n))
+	return n, err
+}
+
+func (f *spooledFile) Size() int64 {
+	return f.size
+}
+
+func (f *spooledFile) Count() int64 {
+	count := f.count.Load()
+	if count > f.size {
+		return f.size
+	}
+	return count
+}
+
+func appendRowErrors(rowErrors []model.ImportRowError, errs ...model.ImportRowError) []model.ImportRowError {
+	for _, e := range errs {
+		if len(rowErrors) >= maxImportErrors {
+			break
+		}
+		rowErrors = append(rowErrors, e)
+	}
+	return rowErrors
+}
+
+func encodeRowErrors(rowErrors []model.ImportRowError) string {
+	if len(rowErrors) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(rowErrors)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeRowErrors(data string) []model.ImportRowError {
+	var rowErrors []model.ImportRowError
+	if data == "" {
+		return rowErrors
+	}
+	_ = json.Unmarshal([]byte(data), &rowErrors)
+	return rowErrors
+}
+
+func newImportResult(job *model.ImportJob, rowErrors []model.ImportRowError) *ImportResult {
+	if rowErrors == nil {
+		rowErrors = []model.ImportRowError{}
+	}
+	result := &ImportResult{
+		JobID:        job.ID,
+		Filename:     job.Filename,
+		Format:       job.Format,
+		Status:       job.Status,
+		DryRun:       job.DryRun,
+		TotalRows:    job.TotalRows,
+		AcceptedRows: job.AcceptedRows,
+		RejectedRows: job.RejectedRows,
+		Checkpoint:   job.Checkpoint,
+		BytesTotal:   job.BytesTotal,
+		BytesRead:    job.BytesRead,
+		Message:      job.Message,
+		CreatedAt:    job.CreatedAt,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+		Errors:       rowErrors,
+	}
+	if job.BytesTotal > 0 {
+		result.Progress = float64(job.BytesRead) / float64(job.BytesTotal) * 100
+	}
+	if !job.StartedAt.IsZero() {
+		end := job.FinishedAt
+		if end.IsZero() {
+			end = time.Now()
+		}
+		elapsed := end.Sub(job.StartedAt).Seconds()
+		result.ElapsedSeconds = elapsed
+		if elapsed > 0 {
+			result.RowsPerSecond = float64(job.TotalRows) / elapsed
+			result.BytesPerSecond = float64(job.BytesRead) / elapsed
+		}
+	}
+	return result
+}
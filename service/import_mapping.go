@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+)
+
+// ImportSettings describes how the rows of a source are read into
+// transactions. It is built from a mapping profile and snapshotted on the
+// import job, so a resumed job reads its file the same way.
+type ImportSettings struct {
+	Columns            ColumnMapping     `json:"columns,omitempty"`
+	TypeValues         map[string]string `json:"type_values,omitempty"`
+	TimestampColumn    string            `json:"timestamp_column,omitempty"`
+	TimestampFormat    string            `json:"timestamp_format,omitempty"`
+	Timezone           string            `json:"timezone,omitempty"`
+	DecimalSeparator   string            `json:"decimal_separator,omitempty"`
+	ThousandsSeparator string            `json:"thousands_separator,omitempty"`
+}
+
+// newImportSettings converts a profile, whose Columns map source columns to
+// transaction fields, into import settings.
+func newImportSettings(profile *model.ImportProfile) (*ImportSettings, error) {
+	columns := make(ColumnMapping, len(profile.Columns))
+	for column, field := range profile.Columns {
+		if _, duplicated := columns[field]; duplicated {
+			return nil, fmt.Errorf("%w: field %s is mapped from more than one column", utils.ErrInvalidImportMapping, field)
+		}
+		columns[field] = column
+	}
+	return &ImportSettings{
+		Columns:            columns,
+		TypeValues:         profile.TypeValues,
+		TimestampColumn:    profile.TimestampColumn,
+		TimestampFormat:    profile.TimestampFormat,
+		Timezone:           profile.Timezone,
+		DecimalSeparator:   profile.DecimalSeparator,
+		ThousandsSeparator: profile.ThousandsSeparator,
+	}, nil
+}
+
+func (s *ImportSettings) Validate() error {
+	for field := range s.Columns {
+		if !isImportField(field) {
+			return fmt.Errorf("%w: unknown transaction field %s", utils.ErrInvalidImportMapping, field)
+		}
+	}
+	if len(s.DecimalSeparator) > 1 || len(s.ThousandsSeparator) > 1 {
+		return utils.ErrInvalidSeparator
+	}
+	if s.ThousandsSeparator != "" && s.ThousandsSeparator == s.decimalSeparator() {
+		return utils.ErrInvalidSeparator
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return utils.ErrInvalidTimezone
+	}
+	return nil
+}
+
+func (s *ImportSettings) decimalSeparator() string {
+	if s.DecimalSeparator == "" {
+		return "."
+	}
+	return s.DecimalSeparator
+}
+
+func (s *ImportSettings) checkColumns(columns []string) error {
+	present := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		present[column] = true
+	}
+	for _, field := range ImportFields {
+		if field == "isFraud" {
+			continue
+		}
+		if column := s.Columns.Column(field); !present[column] {
+			return errors.New("import format error, there is no column " + column)
+		}
+	}
+	if s.TimestampColumn != "" && !present[s.TimestampColumn] {
+		return errors.New("import format error, there is no column " + s.TimestampColumn)
+	}
+	return nil
+}
+
+type rowParser struct {
+	settings *ImportSettings
+	location *time.Location
+}
+
+func newRowParser(settings *ImportSettings) (*rowParser, error) {
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, utils.ErrInvalidTimezone
+	}
+	return &rowParser{settings: settings, location: location}, nil
+}
+
+// Parse converts one source row into a transaction, collecting every problem
+// found in the row. When no timestamp column is configured the transaction is
+// stamped with the import time.
+func (p *rowParser) Parse(row map[string]string, line int) (model.Transaction, []model.ImportRowError) {
+	var errs []model.ImportRowError
+	columns := p.settings.Columns
+	value := func(field string) (string, string, bool) {
+		column := columns.Column(field)
+		raw, ok := row[column]
+		if !ok {
+			errs = append(errs, model.ImportRowError{Line: line, Column: column, Reason: "column is missing"})
+		}
+		return column, strings.TrimSpace(raw), ok
+	}
+	text := func(field string) string {
+		column, raw, ok := value(field)
+		if !ok {
+			return ""
+		}
+		if raw == "" {
+			errs = append(errs, model.ImportRowError{Line: line, Column: column, Reason: "value is required"})
+		} else if len(raw) > 50 {
+			errs = append(errs, model.ImportRowError{Line: line, Column: column, Reason: "value is longer than 50 characters"})
+		}
+		return raw
+	}
+	number := func(field string) float64 {
+		column, raw, ok := value(field)
+		if !ok {
+			return 0
+		}
+		parsed, err := strconv.ParseFloat(p.normalizeNumber(raw), 64)
+		if err != nil {
+			errs = append(errs, model.ImportRowError{Line: line, Column: column, Reason: "invalid number " + strconv.Quote(raw)})
+		}
+		return parsed
+	}
+	now := time.Now()
+	transaction := model.Transaction{
+		Type:           text("type"),
+		Amount:         number("amount"),
+		NameOrig:       text("nameOrig"),
+		OldBalanceOrig: number("oldBalanceOrig"),
+		NewBalanceOrig: number("newBalanceOrig"),
+		NameDest:       text("nameDest"),
+		OldBalanceDest: number("oldBalanceDest"),
+		NewBalanceDest: number("newBalanceDest"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if mapped, ok := p.settings.TypeValues[transaction.Type]; ok {
+		transaction.Type = mapped
+	}
+	if transaction.Amount <= 0 && len(errs) == 0 {
+		errs = append(errs, model.ImportRowError{Line: line, Column: columns.Column("amount"), Reason: utils.ErrInvalidAmount.Error()})
+	}
+	isFraudColumn := columns.Column("isFraud")
+	switch strings.ToLower(strings.TrimSpace(row[isFraudColumn])) {
+	case "1", "true":
+		transaction.IsFraud = true
+	case "0", "false", "":
+		transaction.IsFraud = false
+	default:
+		errs = append(errs, model.ImportRowError{Line: line, Column: isFraudColumn, Reason: "must be 0, 1, true or false"})
+	}
+	if column := p.settings.TimestampColumn; column != "" {
+		createdAt, err := p.parseTimestamp(strings.TrimSpace(row[column]))
+		if err != nil {
+			errs = append(errs, model.ImportRowError{Line: line, Column: column, Reason: err.Error()})
+		} else {
+			transaction.CreatedAt = createdAt
+		}
+	}
+	return transaction, errs
+}
+
+func (p *rowParser) normalizeNumber(raw string) string {
+	if sep := p.settings.ThousandsSeparator; sep != "" {
+		raw = strings.ReplaceAll(raw, sep, "")
+	}
+	if sep := p.settings.decimalSeparator(); sep != "." {
+		raw = strings.Replace(raw, sep, ".", 1)
+	}
+	return raw
+}
+
+// parseTimestamp reads a timestamp in the configured format: "unix" or
+// "unix_ms" for epoch values, otherwise a Go time layout, RFC 3339 by default.
+// Layouts without a zone are read in the configured timezone.
+func (p *rowParser) parseTimestamp(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, errors.New("value is required")
+	}
+	switch p.settings.TimestampFormat {
+	case "unix", "unix_ms":
+		epoch, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New("invalid epoch timestamp " + strconv.Quote(raw))
+		}
+		if p.settings.TimestampFormat == "unix_ms" {
+			return time.UnixMilli(epoch), nil
+		}
+		return time.Unix(epoch, 0), nil
+	}
+	layout := p.settings.TimestampFormat
+	if layout == "" || layout == "rfc3339" {
+		layout = time.RFC3339
+	}
+	parsed, err := time.ParseInLocation(layout, raw, p.location)
+	if err != nil {
+		return time.Time{}, errors.New("timestamp " + strconv.Quote(raw) + " does not match " + layout)
+	}
+	return parsed, nil
+}
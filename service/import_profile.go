@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+type ImportProfileService struct {
+	importProfileRepository repository.ImportProfileRepository
+	auditService            *AuditService
+}
+
+func NewImportProfileService(db *gorm.DB) *ImportProfileService {
+	return &ImportProfileService{
+		importProfileRepository: repository.NewImportProfileRepository(db),
+		auditService:            NewAuditService(db),
+	}
+}
+
+// ImportProfileRequest describes a saved mapping profile. Columns maps a
+// source column name to a transaction field (see ImportFields), TypeValues
+// maps source type values to transaction types, and TimestampFormat is
+// "unix", "unix_ms", "rfc3339" or a Go time layout.
+type ImportProfileRequest struct {
+	Name               string            `json:"name"`
+	Description        string            `json:"description"`
+	Columns            map[string]string `json:"columns"`
+	TypeValues         map[string]string `json:"typeValues"`
+	TimestampColumn    string            `json:"timestampColumn"`
+	TimestampFormat    string            `json:"timestampFormat"`
+	Timezone           string            `json:"timezone"`
+	DecimalSeparator   string            `json:"decimalSeparator"`
+	ThousandsSeparator string            `json:"thousandsSeparator"`
+}
+
+func (s *ImportProfileService) Create(req *ImportProfileRequest, actor *model.Actor) (uint, error) {
+	profile := &model.ImportProfile{CreatedBy: actorUserID(actor)}
+	applyImportProfileRequest(profile, req)
+	if err := s.validate(profile); err != nil {
+		return 0, err
+	}
+	err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.importProfileRepository.WithTx(tx).Create(profile); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionCreate, model.AuditEntityImportProfile, profile.ID, nil, profile)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return profile.ID, nil
+}
+
+func (s *ImportProfileService) Update(id uint, req *ImportProfileRequest, actor *model.Actor) (*model.ImportProfile, error) {
+	profile, err := s.importProfileRepository.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	before := *profile
+	applyImportProfileRequest(profile, req)
+	if err := s.validate(profile); err != nil {
+		return nil, err
+	}
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.importProfileRepository.WithTx(tx).Update(profile); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityImportProfile, profile.ID, before, profile)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *ImportProfileService) Delete(id uint, actor *model.Actor) error {
+	profile, err := s.importProfileRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.importProfileRepository.WithTx(tx).Delete(id); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionDelete, model.AuditEntityImportProfile, id, profile, nil)
+	})
+}
+
+func (s *ImportProfileService) GetByID(id uint) (*model.ImportProfile, error) {
+	return s.importProfileRepository.FindByID(id)
+}
+
+func (s *ImportProfileService) List() ([]*model.ImportProfile, error) {
+	return s.importProfileRepository.List()
+}
+
+func (s *ImportProfileService) validate(profile *model.ImportProfile) error {
+	if profile.Name == "" {
+		return utils.ErrInvalidImportProfile
+	}
+	existing, err := s.importProfileRepository.FindByName(profile.Name)
+	if err == nil && existing.ID != profile.ID {
+		return utils.ErrExistedImportProfile
+	} else if err != nil && !errors.Is(err, utils.ErrImportProfileNotExists) {
+		return err
+	}
+	settings, err := newImportSettings(profile)
+	if err != nil {
+		return err
+	}
+	return settings.Validate()
+}
+
+func applyImportProfileRequest(profile *model.ImportProfile, req *ImportProfileRequest) {
+	profile.Name = strings.TrimSpace(req.Name)
+	profile.Description = req.Description
+	profile.Columns = req.Columns
+	profile.TypeValues = req.TypeValues
+	profile.TimestampColumn = req.TimestampColumn
+	profile.TimestampFormat = req.TimestampFormat
+	profile.Timezone = req.Timezone
+	profile.DecimalSeparator = req.DecimalSeparator
+	profile.ThousandsSeparator = req.ThousandsSeparator
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mitsui515/finsys/utils"
+)
+
+const (
+	ImportFormatCSV     = "csv"
+	ImportFormatJSONL   = "jsonl"
+	ImportFormatParquet = "parquet"
+	ImportFormatXLSX    = "xlsx"
+)
+
+// ImportFields are the transaction fields an import source can be mapped onto.
+// The names match the JSON names of model.Transaction.
+var ImportFields = []string{"type", "amount", "nameOrig", "oldBalanceOrig", "newBalanceOrig", "nameDest", "oldBalanceDest", "newBalanceDest", "isFraud"}
+
+// ColumnMapping maps a transaction field to the column of the source file that
+// holds it. Fields that are not mapped are read from the column of the same name.
+type ColumnMapping map[string]string
+
+func (m ColumnMapping) Column(field string) string {
+	if column, ok := m[field]; ok && column != "" {
+		return column
+	}
+	return field
+}
+
+// ImportSource is the input handed to an Importer. Streaming formats only use
+// Read; formats with a footer or a zip directory need ReadAt and Size.
+type ImportSource interface {
+	io.Reader
+	io.ReaderAt
+	Size() int64
+}
+
+// RowReader yields the rows of an import source keyed by source column name.
+type RowReader interface {
+	// Columns returns the source column names, or nil when the format has no
+	// fixed header.
+	Columns() []string
+	// Next returns the 1-based position of the next row in the source and its
+	// values. It returns io.EOF after the last row and a *RowDecodeError for
+	// a row that cannot be decoded, after which reading may continue.
+	Next() (int, map[string]string, error)
+	Close() error
+}
+
+type Importer interface {
+	Open(src ImportSource) (RowReader, error)
+}
+
+type RowDecodeError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowDecodeError) Error() string {
+	return e.Err.Error()
+}
+
+var importers = map[string]Importer{
+	ImportFormatCSV:     csvImporter{},
+	ImportFormatJSONL:   jsonlImporter{},
+	ImportFormatParquet: parquetImporter{},
+	ImportFormatXLSX:    xlsxImporter{},
+}
+
+func NewImporter(format string) (Importer, error) {
+	importer, ok := importers[format]
+	if !ok {
+		return nil, utils.ErrUnsupportedImportFormat
+	}
+	return importer, nil
+}
+
+// DetectImportFormat picks the import format from the file extension, falling
+// back to the leading bytes of the content when the extension is unknown.
+func DetectImportFormat(filename string, head []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ImportFormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return ImportFormatJSONL, nil
+	case ".parquet":
+		return ImportFormatParquet, nil
+	case ".xlsx":
+		return ImportFormatXLSX, nil
+	}
+	trimmed := bytes.TrimLeft(head, " \t\r\n\ufeff")
+	switch {
+	case bytes.HasPrefix(head, []byte("PAR1")):
+		return ImportFormatParquet, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return ImportFormatXLSX, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return ImportFormatJSONL, nil
+	case bytes.ContainsRune(head, ',') && bytes.ContainsRune(head, '\n'):
+		return ImportFormatCSV, nil
+	}
+	return "", utils.ErrUnsupportedImportFormat
+}
+
+func isImportField(field string) bool {
+	for _, f := range ImportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type csvImporter struct{}
+
+func (csvImporter) Open(src ImportSource) (RowReader, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range headers {
+		headers[i] = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+	}
+	return &csvRowReader{reader: reader, headers: headers}, nil
+}
+
+type csvRowReader struct {
+	reader  *csv.Reader
+	headers []string
+}
+
+func (r *csvRowReader) Columns() []string {
+	return r.headers
+}
+
+func (r *csvRowReader) Next() (int, map[string]string, error) {
+	record, err := r.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, &RowDecodeError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	if len(record) != len(r.headers) {
+		return line, nil, &RowDecodeError{
+			Line: line,
+			Err:  errors.New("expected " + strconv.Itoa(len(r.headers)) + " fields, got " + strconv.Itoa(len(record))),
+		}
+	}
+	row := make(map[string]string, len(record))
+	for i, value := range record {
+		row[r.headers[i]] = value
+	}
+	return line, row, nil
+}
+
+func (r *csvRowReader) Close() error {
+	return nil
+}
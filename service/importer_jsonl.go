@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const maxJSONLLineSize = 1024 * 1024
+
+type jsonlImporter struct{}
+
+func (jsonlImporter) Open(src ImportSource) (RowReader, error) {
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLineSize)
+	return &jsonlRowReader{scanner: scanner}, nil
+}
+
+type jsonlRowReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *jsonlRowReader) Columns() []string {
+	return nil
+}
+
+func (r *jsonlRowReader) Next() (int, map[string]string, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return r.line, nil, &RowDecodeError{Line: r.line, Err: err}
+		}
+		row := make(map[string]string, len(object))
+		for key, value := range object {
+			row[key] = jsonValueString(value)
+		}
+		return r.line, row, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, io.EOF
+}
+
+func (r *jsonlRowReader) Close() error {
+	return nil
+}
+
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
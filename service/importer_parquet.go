@@ -0,0 +1,78 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetImporter struct{}
+
+func (parquetImporter) Open(src ImportSource) (RowReader, error) {
+	file, err := parquet.OpenFile(src, src.Size())
+	if err != nil {
+		return nil, err
+	}
+	paths := file.Schema().Columns()
+	columns := make([]string, len(paths))
+	for i, path := range paths {
+		columns[i] = strings.Join(path, ".")
+	}
+	return &parquetRowReader{
+		reader:  parquet.NewReader(file),
+		columns: columns,
+		rows:    make([]parquet.Row, 1),
+	}, nil
+}
+
+type parquetRowReader struct {
+	reader  *parquet.Reader
+	columns []string
+	rows    []parquet.Row
+	line    int
+}
+
+func (r *parquetRowReader) Columns() []string {
+	return r.columns
+}
+
+func (r *parquetRowReader) Next() (int, map[string]string, error) {
+	n, err := r.reader.ReadRows(r.rows)
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, nil, err
+	}
+	r.line++
+	row := make(map[string]string, len(r.columns))
+	for _, value := range r.rows[0] {
+		column := value.Column()
+		if column < 0 || column >= len(r.columns) {
+			continue
+		}
+		if _, seen := row[r.columns[column]]; seen {
+			continue
+		}
+		row[r.columns[column]] = parquetValueString(value)
+	}
+	return r.line, row, nil
+}
+
+func (r *parquetRowReader) Close() error {
+	return r.reader.Close()
+}
+
+func parquetValueString(value parquet.Value) string {
+	switch {
+	case value.IsNull():
+		return ""
+	case value.Kind() == parquet.Double:
+		return strconv.FormatFloat(value.Double(), 'f', -1, 64)
+	case value.Kind() == parquet.Float:
+		return strconv.FormatFloat(float64(value.Float()), 'f', -1, 32)
+	}
+	return value.String()
+}
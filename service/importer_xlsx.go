@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type xlsxImporter struct{}
+
+// Open reads the first worksheet; its first row is the header.
+func (xlsxImporter) Open(src ImportSource) (RowReader, error) {
+	file, err := excelize.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		file.Close()
+		return nil, errors.New("workbook has no worksheet")
+	}
+	rows, err := file.Rows(sheets[0])
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader := &xlsxRowReader{file: file, rows: rows}
+	if !rows.Next() {
+		reader.Close()
+		return nil, errors.New("worksheet " + sheets[0] + " is empty")
+	}
+	reader.line++
+	headers, err := rows.Columns()
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	for i, h := range headers {
+		headers[i] = strings.TrimSpace(h)
+	}
+	reader.headers = headers
+	return reader, nil
+}
+
+type xlsxRowReader struct {
+	file    *excelize.File
+	rows    *excelize.Rows
+	headers []string
+	line    int
+}
+
+func (r *xlsxRowReader) Columns() []string {
+	return r.headers
+}
+
+func (r *xlsxRowReader) Next() (int, map[string]string, error) {
+	for r.rows.Next() {
+		r.line++
+		cells, err := r.rows.Columns()
+		if err != nil {
+			return r.line, nil, &RowDecodeError{Line: r.line, Err: err}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		row := make(map[string]string, len(r.headers))
+		for i, header := range r.headers {
+			if i < len(cells) {
+				row[header] = cells[i]
+			} else {
+				row[header] = ""
+			}
+		}
+		return r.line, row, nil
+	}
+	if err := r.rows.Error(); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, io.EOF
+}
+
+func (r *xlsxRowReader) Close() error {
+	r.rows.Close()
+	return r.file.Close()
+}
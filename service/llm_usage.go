@@ -0,0 +1,292 @@
+package service
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+// LLMBudgetExceededError is ErrLLMBudgetExceeded along with how long until
+// the budget resets.
+type LLMBudgetExceededError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LLMBudgetExceededError) Error() string {
+	return utils.ErrLLMBudgetExceeded.Error()
+}
+
+func (e *LLMBudgetExceededError) Unwrap() error {
+	return utils.ErrLLMBudgetExceeded
+}
+
+// LLMUsageService meters the tokens chat requests use and enforces the
+// daily and monthly budgets. A request reserves its estimated tokens when its
+// budget is checked and settles them once answered, so requests running at
+// the same time count against the budget before any of them is answered.
+// Only the request that crosses a budget still completes.
+type LLMUsageService struct {
+	llmUsageRepository repository.LLMUsageRepository
+	userRepository     repository.UserRepository
+	auditService       *AuditService
+	config             config.LLMConfig
+}
+
+func NewLLMUsageService() *LLMUsageService {
+	return &LLMUsageService{
+		llmUsageRepository: repository.NewLLMUsageRepository(config.DB),
+		userRepository:     repository.NewUserRepository(config.DB),
+		auditService:       NewAuditService(config.DB),
+		config:             config.Current().LLM,
+	}
+}
+
+type LLMBudgetRequest struct {
+	DailyTokens   int64 `json:"daily_tokens"`
+	MonthlyTokens int64 `json:"monthly_tokens"`
+}
+
+type LLMUsageReportResponse struct {
+	GroupBy string                   `json:"groupBy"`
+	Total   model.LLMUsageSummary    `json:"total"`
+	Groups  []*model.LLMUsageSummary `json:"groups"`
+}
+
+// LLMUsageStatusResponse is a user's usage in the current UTC day and month
+// against their budget, where a limit of zero means none.
+type LLMUsageStatusResponse struct {
+	DailyTokens   int64 `json:"dailyTokens"`
+	DailyLimit    int64 `json:"dailyLimit"`
+	MonthlyTokens int64 `json:"monthlyTokens"`
+	MonthlyLimit  int64 `json:"monthlyLimit"`
+}
+
+// Reserve refuses a request from user once they have used up their daily or
+// monthly budget, counting the reservations of requests still running, and
+// otherwise records estimate as the usage of the request. The reservation
+// must be passed to Settle once the request is answered, or to Release if it
+// fails.
+func (s *LLMUsageService) Reserve(user *model.User, llmModel model.Model, estimate model.LLMTokenUsage) (*model.LLMUsage, error) {
+	record := &model.LLMUsage{UserID: user.ID, Model: llmModel}
+	s.setUsage(record, estimate)
+	err := s.llmUsageRepository.Reserve(record, func(llmUsageRepository repository.LLMUsageRepository) error {
+		return s.check(llmUsageRepository, user, time.Now().UTC())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Settle replaces the estimate in a reservation with the usage the provider
+// reported. A failure is logged rather than returned, since the user has
+// already been answered.
+func (s *LLMUsageService) Settle(record *model.LLMUsage, usage model.LLMTokenUsage, latency time.Duration) {
+	s.setUsage(record, usage)
+	record.LatencyMs = latency.Milliseconds()
+	if err := s.llmUsageRepository.Update(record); err != nil {
+		log.Printf("Fail to record LLM usage of user %d: %v", record.UserID, err)
+	}
+}
+
+// Release drops the reservation of a request that failed.
+func (s *LLMUsageService) Release(record *model.LLMUsage) {
+	if err := s.llmUsageRepository.Delete(record.ID); err != nil {
+		log.Printf("Fail to release LLM usage reservation %d: %v", record.ID, err)
+	}
+}
+
+func (s *LLMUsageService) check(llmUsageRepository repository.LLMUsageRepository, user *model.User, now time.Time) error {
+	status, err := s.status(llmUsageRepository, user, now)
+	if err != nil {
+		return err
+	}
+	day, month := periodStarts(now)
+	if status.MonthlyLimit > 0 && status.MonthlyTokens >= status.MonthlyLimit {
+		return &LLMBudgetExceededError{RetryAfter: month.AddDate(0, 1, 0).Sub(now)}
+	}
+	if status.DailyLimit > 0 && status.DailyTokens >= status.DailyLimit {
+		return &LLMBudgetExceededError{RetryAfter: day.AddDate(0, 0, 1).Sub(now)}
+	}
+	return nil
+}
+
+// setUsage puts usage and its cost in record.
+func (s *LLMUsageService) setUsage(record *model.LLMUsage, usage model.LLMTokenUsage) {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	record.PromptTokens = usage.PromptTokens
+	record.CompletionTokens = usage.CompletionTokens
+	record.TotalTokens = usage.TotalTokens
+	record.Cost = float64(usage.PromptTokens)/1000*s.config.PromptPricePer1K +
+		float64(usage.CompletionTokens)/1000*s.config.CompletionPricePer1K
+}
+
+// Status returns the user's usage against their budget.
+func (s *LLMUsageService) Status(userID uint) (*LLMUsageStatusResponse, error) {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	return s.status(s.llmUsageRepository, user, time.Now().UTC())
+}
+
+func (s *LLMUsageService) status(llmUsageRepository repository.LLMUsageRepository, user *model.User, now time.Time) (*LLMUsageStatusResponse, error) {
+	budget, err := s.budgetFor(llmUsageRepository, user)
+	if err != nil {
+		return nil, err
+	}
+	day, month := periodStarts(now)
+	daily, err := llmUsageRepository.SumTokens(user.ID, day)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := llmUsageRepository.SumTokens(user.ID, month)
+	if err != nil {
+		return nil, err
+	}
+	return &LLMUsageStatusResponse{
+		DailyTokens:   daily,
+		DailyLimit:    budget.DailyTokens,
+		MonthlyTokens: monthly,
+		MonthlyLimit:  budget.MonthlyTokens,
+	}, nil
+}
+
+// budgetFor returns the user's own budget, else their role's, else the
+// configured default.
+func (s *LLMUsageService) budgetFor(llmUsageRepository repository.LLMUsageRepository, user *model.User) (*model.LLMBudget, error) {
+	for _, subject := range []string{userBudgetSubject(user.ID), model.LLMBudgetRolePrefix + user.Role} {
+		budget, err := llmUsageRepository.FindBudget(subject)
+		if err != nil || budget != nil {
+			return budget, err
+		}
+	}
+	return &model.LLMBudget{
+		DailyTokens:   s.config.DailyTokenBudget,
+		MonthlyTokens: s.config.MonthlyTokenBudget,
+	}, nil
+}
+
+// Report totals usage by user, model or UTC day.
+func (s *LLMUsageService) Report(groupBy string, filter *model.LLMUsageFilter) (*LLMUsageReportResponse, error) {
+	if groupBy == "" {
+		groupBy = model.LLMUsageByUser
+	}
+	groups, err := s.llmUsageRepository.Summarize(groupBy, filter)
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []*model.LLMUsageSummary{}
+	}
+	response := &LLMUsageReportResponse{GroupBy: groupBy, Groups: groups}
+	for _, group := range groups {
+		response.Total.Requests += group.Requests
+		response.Total.PromptTokens += group.PromptTokens
+		response.Total.CompletionTokens += group.CompletionTokens
+		response.Total.TotalTokens += group.TotalTokens
+		response.Total.Cost += group.Cost
+	}
+	return response, nil
+}
+
+func (s *LLMUsageService) ListBudgets() ([]*model.LLMBudget, error) {
+	budgets, err := s.llmUsageRepository.ListBudgets()
+	if err != nil {
+		return nil, err
+	}
+	if budgets == nil {
+		budgets = []*model.LLMBudget{}
+	}
+	return budgets, nil
+}
+
+func (s *LLMUsageService) SetUserBudget(userID uint, req *LLMBudgetRequest, actor *model.Actor) (*model.LLMBudget, error) {
+	if _, err := s.userRepository.FindByID(userID); err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	return s.setBudget(userBudgetSubject(userID), req, actor)
+}
+
+func (s *LLMUsageService) SetRoleBudget(role string, req *LLMBudgetRequest, actor *model.Actor) (*model.LLMBudget, error) {
+	if !model.ValidRole(role) {
+		return nil, utils.ErrInvalidRole
+	}
+	return s.setBudget(model.LLMBudgetRolePrefix+role, req, actor)
+}
+
+// DeleteUserBudget puts the user back on their role's budget.
+func (s *LLMUsageService) DeleteUserBudget(userID uint, actor *model.Actor) error {
+	return s.deleteBudget(userBudgetSubject(userID), actor)
+}
+
+// DeleteRoleBudget puts the role back on the configured default.
+func (s *LLMUsageService) DeleteRoleBudget(role string, actor *model.Actor) error {
+	if !model.ValidRole(role) {
+		return utils.ErrInvalidRole
+	}
+	return s.deleteBudget(model.LLMBudgetRolePrefix+role, actor)
+}
+
+func (s *LLMUsageService) setBudget(subject string, req *LLMBudgetRequest, actor *model.Actor) (*model.LLMBudget, error) {
+	if req.DailyTokens < 0 || req.MonthlyTokens < 0 {
+		return nil, utils.ErrInvalidLLMBudget
+	}
+	before, err := s.llmUsageRepository.FindBudget(subject)
+	if err != nil {
+		return nil, err
+	}
+	budget := &model.LLMBudget{
+		Subject:       subject,
+		DailyTokens:   req.DailyTokens,
+		MonthlyTokens: req.MonthlyTokens,
+		UpdatedAt:     time.Now(),
+	}
+	action := model.AuditActionUpdate
+	if before == nil {
+		action = model.AuditActionCreate
+	}
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.llmUsageRepository.WithTx(tx).SaveBudget(budget); err != nil {
+			return err
+		}
+		return audit.Record(actor, action, model.AuditEntityLLMBudget, 0, before, budget)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (s *LLMUsageService) deleteBudget(subject string, actor *model.Actor) error {
+	before, err := s.llmUsageRepository.FindBudget(subject)
+	if err != nil || before == nil {
+		return err
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.llmUsageRepository.WithTx(tx).DeleteBudget(subject); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionDelete, model.AuditEntityLLMBudget, 0, before, nil)
+	})
+}
+
+func userBudgetSubject(userID uint) string {
+	return model.LLMBudgetUserPrefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+// periodStarts returns the start of now's UTC day and month.
+func periodStarts(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
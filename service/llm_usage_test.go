@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+)
+
+func newTestLLMUsageService(t *testing.T, llmConfig config.LLMConfig) *LLMUsageService {
+	t.Helper()
+	db := openTestDB(t)
+	return &LLMUsageService{
+		llmUsageRepository: repository.NewLLMUsageRepository(db),
+		userRepository:     repository.NewUserRepository(db),
+		auditService:       NewAuditService(db),
+		config:             llmConfig,
+	}
+}
+
+// TestReserveConcurrently checks that requests running at the same time each
+// count against the budget: with 400 tokens reserved apiece, the budget of
+// 1000 admits three before refusing the rest.
+func TestReserveConcurrently(t *testing.T) {
+	s := newTestLLMUsageService(t, config.LLMConfig{DailyTokenBudget: 1000})
+	user := &model.User{ID: 1, Role: model.RoleAnalyst}
+	estimate := model.LLMTokenUsage{PromptTokens: 100, CompletionTokens: 300}
+	var (
+		wg                sync.WaitGroup
+		mu                sync.Mutex
+		reserved, refused int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Reserve(user, model.QwenTurbo, estimate)
+			var exceeded *LLMBudgetExceededError
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reserved++
+			case errors.As(err, &exceeded) && errors.Is(err, utils.ErrLLMBudgetExceeded):
+				refused++
+				if exceeded.RetryAfter <= 0 || exceeded.RetryAfter > 24*time.Hour {
+					t.Errorf("RetryAfter is %v", exceeded.RetryAfter)
+				}
+			default:
+				t.Errorf("Reserve: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 3 || refused != 7 {
+		t.Errorf("%d requests were reserved and %d refused, want 3 and 7", reserved, refused)
+	}
+}
+
+func TestReserveSettleRelease(t *testing.T) {
+	s := newTestLLMUsageService(t, config.LLMConfig{
+		DailyTokenBudget:     1000,
+		PromptPricePer1K:     0.5,
+		CompletionPricePer1K: 2,
+	})
+	user := &model.User{ID: 1, Role: model.RoleAnalyst}
+	used := func() int64 {
+		t.Helper()
+		status, err := s.status(s.llmUsageRepository, user, time.Now())
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		return status.DailyTokens
+	}
+
+	record, err := s.Reserve(user, model.QwenTurbo, model.LLMTokenUsage{PromptTokens: 200, CompletionTokens: 800})
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if record.TotalTokens != 1000 || math.Abs(record.Cost-1.7) > 1e-9 {
+		t.Errorf("the reservation holds %d tokens costing %v, want 1000 costing 1.7", record.TotalTokens, record.Cost)
+	}
+	if _, err := s.Reserve(user, model.QwenTurbo, model.LLMTokenUsage{TotalTokens: 1}); !errors.Is(err, utils.ErrLLMBudgetExceeded) {
+		t.Errorf("Reserve over the budget returned %v", err)
+	}
+
+	// The reported usage replaces the estimate.
+	s.Settle(record, model.LLMTokenUsage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300}, 1500*time.Millisecond)
+	if got := used(); got != 300 {
+		t.Errorf("%d tokens are counted after settling, want 300", got)
+	}
+	if record.LatencyMs != 1500 || math.Abs(record.Cost-0.3) > 1e-9 {
+		t.Errorf("the settled request took %dms costing %v", record.LatencyMs, record.Cost)
+	}
+
+	failed, err := s.Reserve(user, model.QwenTurbo, model.LLMTokenUsage{TotalTokens: 500})
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if got := used(); got != 800 {
+		t.Errorf("%d tokens are counted with a request running, want 800", got)
+	}
+	s.Release(failed)
+	if got := used(); got != 300 {
+		t.Errorf("%d tokens are counted after releasing, want 300", got)
+	}
+}
+
+func TestBudgetFor(t *testing.T) {
+	s := newTestLLMUsageService(t, config.LLMConfig{DailyTokenBudget: 100, MonthlyTokenBudget: 1000})
+	analyst := &model.User{ID: 100, Role: model.RoleAnalyst}
+	admin := &model.User{ID: 101, Role: model.RoleAdmin}
+	if _, err := s.SetRoleBudget(model.RoleAnalyst, &LLMBudgetRequest{DailyTokens: 200}, nil); err != nil {
+		t.Fatalf("SetRoleBudget: %v", err)
+	}
+	own := &model.User{Username: "carol", Password: "secret", Email: "carol@example.com", Role: model.RoleAnalyst}
+	if err := s.userRepository.Create(own); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := s.SetUserBudget(own.ID, &LLMBudgetRequest{MonthlyTokens: 5000}, nil); err != nil {
+		t.Fatalf("SetUserBudget: %v", err)
+	}
+	tests := []struct {
+		name        string
+		user        *model.User
+		wantDaily   int64
+		wantMonthly int64
+	}{
+		{"role budget", analyst, 200, 0},
+		{"configured default", admin, 100, 1000},
+		{"own budget over the role's", own, 0, 5000},
+	}
+	for _, tt := range tests {
+		budget, err := s.budgetFor(s.llmUsageRepository, tt.user)
+		if err != nil {
+			t.Fatalf("%s: budgetFor: %v", tt.name, err)
+		}
+		if budget.DailyTokens != tt.wantDaily || budget.MonthlyTokens != tt.wantMonthly {
+			t.Errorf("%s: budget is %d a day and %d a month, want %d and %d",
+				tt.name, budget.DailyTokens, budget.MonthlyTokens, tt.wantDaily, tt.wantMonthly)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/Mitsui515/finsys/config"
+)
+
+// Mailer sends a plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailer returns an SMTP mailer, or one that only logs when no SMTP host
+// is configured.
+func NewMailer(mailConfig config.MailConfig) Mailer {
+	if mailConfig.SMTPHost == "" {
+		return logMailer{}
+	}
+	return &smtpMailer{config: mailConfig}
+}
+
+type smtpMailer struct {
+	config config.MailConfig
+}
+
+// Send uses STARTTLS when the server offers it. Credentials are only sent
+// over TLS or to localhost.
+func (m *smtpMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.SMTPHost)
+	}
+	var msg strings.Builder
+	msg.WriteString("From: " + m.config.From + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	addr := net.JoinHostPort(m.config.SMTPHost, strconv.Itoa(m.config.SMTPPort))
+	return smtp.SendMail(addr, auth, m.config.From, []string{to}, []byte(msg.String()))
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
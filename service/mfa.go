@@ -0,0 +1,458 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps.
+	totpIssuer = "finsys"
+	// mfaChallengeTTL is how long a user has to enter a code after the
+	// password.
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is how many wrong codes end a challenge. Guessing a
+	// six-digit code within it has odds of about one in 66,000.
+	mfaMaxAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+// LoginResponse is a token pair, or a challenge when the user has to pass a
+// second factor first. EnrollmentRequired means the user's role requires
+// TOTP but they have not set it up yet: they enroll with the challenge and
+// the first code completes both the enrollment and the login.
+type LoginResponse struct {
+	*TokenResponse
+	MFARequired        bool     `json:"mfa_required,omitempty"`
+	EnrollmentRequired bool     `json:"enrollment_required,omitempty"`
+	ChallengeToken     string   `json:"challenge_token,omitempty"`
+	ChallengeExpiresIn int64    `json:"challenge_expires_in,omitempty"`
+	RecoveryCodes      []string `json:"recovery_codes,omitempty"`
+}
+
+type MFAChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// MFAVerifyRequest completes a login. Code is a code from the authenticator
+// app or an unused recovery code.
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type RolePolicyRequest struct {
+	RequireTOTP bool `json:"require_totp"`
+}
+
+// TOTPEnrollmentResponse carries the new secret. URI is what the QR code
+// shown to the user encodes; Secret is for typing in by hand.
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// beginLogin finishes a login once the user has proved who they are to the
+// first factor: it refuses disabled users, then opens a session, or issues a
+// challenge when the user has TOTP enabled or their role requires it.
+func (s *UserService) beginLogin(user *model.User, ip, userAgent string) (*LoginResponse, error) {
+	if user.Disabled {
+		return nil, utils.ErrUserDisabled
+	}
+	totp, err := s.findTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.totpRequired(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	if !totp.Enabled() && !required {
+		tokens, err := s.startSession(user, ip, userAgent)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResponse{TokenResponse: tokens}, nil
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	token := randomHex(32)
+	now := time.Now()
+	challenge := &model.MFAChallenge{
+		ID:        hashRefreshSecret(token),
+		UserID:    user.ID,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(mfaChallengeTTL),
+	}
+	if err := s.mfaRepository.CreateChallenge(challenge); err != nil {
+		return nil, err
+	}
+	return &LoginResponse{
+		MFARequired:        true,
+		EnrollmentRequired: !totp.Enabled(),
+		ChallengeToken:     token,
+		ChallengeExpiresIn: int64(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyMFA completes a login that is waiting for a second factor.
+func (s *UserService) VerifyMFA(req *MFAVerifyRequest, actor *model.Actor) (*LoginResponse, error) {
+	challenge, err := s.mfaRepository.FindChallenge(hashRefreshSecret(req.ChallengeToken), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepository.FindByID(challenge.UserID)
+	if err != nil {
+		return nil, utils.ErrInvalidMFAChallenge
+	}
+	if err := s.securityService.CheckLogin(user.Username, actor.IP); err != nil {
+		return nil, err
+	}
+	totp, err := s.findTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, utils.ErrTOTPNotEnrolled
+	}
+	enrolling := !totp.Enabled()
+	var ok bool
+	var step int64
+	if enrolling {
+		step, ok = utils.ValidateTOTP(totp.Secret, req.Code, time.Now(), totp.LastStep)
+	} else {
+		ok, err = s.checkSecondFactor(totp, req.Code, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		// Wrong codes count towards the lockout as well, or new challenges
+		// would give an attacker who has the password unlimited guesses.
+		if err := s.mfaRepository.FailChallenge(challenge.ID, mfaMaxAttempts); err != nil {
+			return nil, err
+		}
+		if err := s.securityService.RecordFailure(user.Username, actor.IP, user.ID); err != nil {
+			return nil, err
+		}
+		return nil, utils.ErrInvalidTOTPCode
+	}
+	consumed, err := s.mfaRepository.ConsumeChallenge(challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, utils.ErrInvalidMFAChallenge
+	}
+	response := &LoginResponse{}
+	if enrolling {
+		enrollActor := *actor
+		enrollActor.UserID = user.ID
+		codes, err := s.enableTOTP(user.ID, step, &enrollActor)
+		if err != nil {
+			return nil, err
+		}
+		response.RecoveryCodes = codes
+	}
+	if response.TokenResponse, err = s.startSession(user, challenge.IP, challenge.UserAgent); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// EnrollTOTP generates a new secret for the user. It is not required at
+// login until ConfirmTOTP has seen a code from it, and enrolling again before
+// then replaces it.
+func (s *UserService) EnrollTOTP(userID uint) (*TOTPEnrollmentResponse, error) {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled() {
+		return nil, utils.ErrTOTPAlreadyEnabled
+	}
+	secret := utils.GenerateTOTPSecret()
+	if err := s.mfaRepository.SaveTOTP(&model.UserTOTP{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    utils.TOTPURI(totpIssuer, user.Username, secret),
+	}, nil
+}
+
+// EnrollTOTPForChallenge enrolls the user behind a login challenge, for users
+// whose role requires TOTP before they have set it up.
+func (s *UserService) EnrollTOTPForChallenge(req *MFAChallengeRequest) (*TOTPEnrollmentResponse, error) {
+	challenge, err := s.mfaRepository.FindChallenge(hashRefreshSecret(req.ChallengeToken), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.EnrollTOTP(challenge.UserID)
+}
+
+// ConfirmTOTP turns on a pending enrollment once the user enters a code from
+// it, and returns the user's recovery codes. They are shown only this once.
+func (s *UserService) ConfirmTOTP(userID uint, req *TOTPCodeRequest, actor *model.Actor) (*RecoveryCodesResponse, error) {
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, utils.ErrTOTPNotEnrolled
+	}
+	if totp.Enabled() {
+		return nil, utils.ErrTOTPAlreadyEnabled
+	}
+	step, ok := utils.ValidateTOTP(totp.Secret, req.Code, time.Now(), totp.LastStep)
+	if !ok {
+		return nil, utils.ErrInvalidTOTPCode
+	}
+	codes, err := s.enableTOTP(userID, step, actor)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP turns TOTP off after checking a current code or recovery code.
+// Users whose role requires TOTP cannot turn it off.
+func (s *UserService) DisableTOTP(userID uint, req *TOTPCodeRequest, actor *model.Actor) error {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return utils.ErrUserNotExists
+	}
+	required, err := s.totpRequired(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return utils.ErrTOTPRequired
+	}
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled() {
+		return utils.ErrTOTPNotEnrolled
+	}
+	ok, err := s.checkSecondFactor(totp, req.Code, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return utils.ErrInvalidTOTPCode
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.mfaRepository.WithTx(tx).DeleteTOTP(userID); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, userID,
+			map[string]bool{"totp": true}, map[string]bool{"totp": false})
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, after checking
+// a current code from the authenticator app.
+func (s *UserService) RegenerateRecoveryCodes(userID uint, req *TOTPCodeRequest) (*RecoveryCodesResponse, error) {
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !totp.Enabled() {
+		return nil, utils.ErrTOTPNotEnrolled
+	}
+	ok, err := s.checkSecondFactor(totp, req.Code, false)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, utils.ErrInvalidTOTPCode
+	}
+	codes, err := s.newRecoveryCodes(s.mfaRepository, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *UserService) MFAStatus(userID uint) (*MFAStatusResponse, error) {
+	user, err := s.userRepository.FindByID(userID)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.totpRequired(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatusResponse{Enabled: totp.Enabled(), Required: required}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.mfaRepository.CountRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// ResetTOTP lets an administrator remove the TOTP of a user who has lost both
+// their device and their recovery codes. If the role requires TOTP, the user
+// sets it up again at their next login.
+func (s *UserService) ResetTOTP(userID uint, actor *model.Actor) error {
+	if _, err := s.userRepository.FindByID(userID); err != nil {
+		return utils.ErrUserNotExists
+	}
+	totp, err := s.findTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if totp == nil {
+		return utils.ErrTOTPNotEnrolled
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.mfaRepository.WithTx(tx).DeleteTOTP(userID); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, userID,
+			map[string]bool{"totp": totp.Enabled()}, map[string]bool{"totp": false})
+	})
+}
+
+// SetRolePolicy changes whether users with role must use TOTP. Users who have
+// not set it up are asked to at their next login; existing sessions are not
+// affected.
+func (s *UserService) SetRolePolicy(role string, req *RolePolicyRequest, actor *model.Actor) (*model.RolePolicy, error) {
+	if !model.ValidRole(role) {
+		return nil, utils.ErrInvalidRole
+	}
+	policy, err := s.rolePolicyRepository.Find(role)
+	if err != nil {
+		return nil, err
+	}
+	before := *policy
+	policy.RequireTOTP = req.RequireTOTP
+	policy.UpdatedAt = time.Now()
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.rolePolicyRepository.WithTx(tx).Save(policy); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityRolePolicy, 0, before, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// findTOTP returns the user's TOTP, or nil when they have never enrolled.
+func (s *UserService) findTOTP(userID uint) (*model.UserTOTP, error) {
+	totp, err := s.mfaRepository.FindTOTP(userID)
+	if errors.Is(err, utils.ErrTOTPNotEnrolled) {
+		return nil, nil
+	}
+	return totp, err
+}
+
+func (s *UserService) totpRequired(role string) (bool, error) {
+	policy, err := s.rolePolicyRepository.Find(role)
+	if err != nil {
+		return false, err
+	}
+	return policy.RequireTOTP, nil
+}
+
+// checkSecondFactor accepts a code from the authenticator app or, when
+// allowRecovery is set, an unused recovery code. Either is spent by a
+// successful check.
+func (s *UserService) checkSecondFactor(totp *model.UserTOTP, code string, allowRecovery bool) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := utils.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastStep); ok {
+		return s.mfaRepository.UseTOTPStep(totp.UserID, step)
+	}
+	if !allowRecovery || code == "" {
+		return false, nil
+	}
+	return s.mfaRepository.UseRecoveryCode(totp.UserID, hashRecoveryCode(code), time.Now())
+}
+
+func (s *UserService) enableTOTP(userID uint, step int64, actor *model.Actor) ([]string, error) {
+	var codes []string
+	err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		mfaRepository := s.mfaRepository.WithTx(tx)
+		if err := mfaRepository.ConfirmTOTP(userID, step, time.Now()); err != nil {
+			return err
+		}
+		var err error
+		if codes, err = s.newRecoveryCodes(mfaRepository, userID); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, userID,
+			map[string]bool{"totp": false}, map[string]bool{"totp": true})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones. Each is ten base32 characters, 50 random bits, shown as two groups of
+// five.
+func (s *UserService) newRecoveryCodes(mfaRepository repository.MFARepository, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes(7)))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := mfaRepository.ReplaceRecoveryCodes(userID, hashes, time.Now()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, so the code can be typed
+// back however it was written down.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+
+// newTestMFA enrolls user 1 in TOTP and returns the service, the secret and
+// the recovery codes.
+func newTestMFA(t *testing.T) (*UserService, *model.UserTOTP, []string) {
+	t.Helper()
+	mfaRepository := repository.NewMFARepository(openTestDB(t))
+	s := &UserService{mfaRepository: mfaRepository}
+	totp := &model.UserTOTP{UserID: 1, Secret: utils.GenerateTOTPSecret()}
+	if err := mfaRepository.SaveTOTP(totp); err != nil {
+		t.Fatalf("SaveTOTP: %v", err)
+	}
+	codes, err := s.newRecoveryCodes(mfaRepository, 1)
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	return s, totp, codes
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	s, _, codes := newTestMFA(t)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes were issued, want %d", len(codes), recoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !recoveryCodeFormat.MatchString(code) {
+			t.Errorf("recovery code %q is not two groups of five base32 characters", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q was issued twice", code)
+		}
+		seen[code] = true
+	}
+	if count, err := s.mfaRepository.CountRecoveryCodes(1); err != nil || count != recoveryCodeCount {
+		t.Errorf("CountRecoveryCodes returned %d, %v", count, err)
+	}
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	s, totp, codes := newTestMFA(t)
+	current, err := utils.TOTPCode(totp.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	tests := []struct {
+		name          string
+		code          string
+		allowRecovery bool
+		want          bool
+	}{
+		{"authenticator code", current, false, true},
+		{"replayed authenticator code", current, false, false},
+		{"recovery code where not allowed", codes[0], false, false},
+		{"recovery code", codes[0], true, true},
+		{"spent recovery code", codes[0], true, false},
+		{"recovery code in capitals without the dash", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), true, true},
+		{"recovery code with spaces", " " + strings.ReplaceAll(codes[2], "-", " ") + " ", true, true},
+		{"unknown recovery code", "aaaaa-aaaaa", true, false},
+		{"empty", "", true, false},
+	}
+	for _, tt := range tests {
+		found, err := s.mfaRepository.FindTOTP(1)
+		if err != nil {
+			t.Fatalf("FindTOTP: %v", err)
+		}
+		ok, err := s.checkSecondFactor(found, tt.code, tt.allowRecovery)
+		if err != nil {
+			t.Fatalf("%s: checkSecondFactor: %v", tt.name, err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: checkSecondFactor returned %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+	if count, err := s.mfaRepository.CountRecoveryCodes(1); err != nil || count != recoveryCodeCount-3 {
+		t.Errorf("%d recovery codes are left, want %d", count, recoveryCodeCount-3)
+	}
+}
+
+func TestNewRecoveryCodesReplacesOld(t *testing.T) {
+	s, totp, old := newTestMFA(t)
+	codes, err := s.newRecoveryCodes(s.mfaRepository, 1)
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	if ok, _ := s.checkSecondFactor(totp, old[0], true); ok {
+		t.Error("a replaced recovery code was accepted")
+	}
+	if ok, _ := s.checkSecondFactor(totp, codes[0], true); !ok {
+		t.Error("a new recovery code was refused")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := hashRecoveryCode("abcde-fghij")
+	for _, code := range []string{"abcdefghij", "ABCDE-FGHIJ", "abcde fghij", "ab-cde-fg hij"} {
+		if got := hashRecoveryCode(code); got != want {
+			t.Errorf("%q hashes differently from abcde-fghij", code)
+		}
+	}
+	if hashRecoveryCode("abcde-fghik") == want {
+		t.Error("different codes hash the same")
+	}
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// OIDCLoginTTL is how long a user has to finish signing in at the provider.
+const OIDCLoginTTL = 10 * time.Minute
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+type OIDCService struct {
+	userService        *UserService
+	identityRepository repository.UserIdentityRepository
+	config             config.OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		userService:        NewUserService(),
+		identityRepository: repository.NewUserIdentityRepository(config.DB),
+		config:             config.Current().OIDC,
+	}
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `query:"code"`
+	State string `query:"state"`
+}
+
+// oidcClaims are the ID token claims used to find or create the user.
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// FrontendRedirectURL is where the callback hands the tokens to, or empty to
+// return them as JSON.
+func (s *OIDCService) FrontendRedirectURL() string {
+	return s.config.FrontendRedirectURL
+}
+
+// getProvider fetches the provider's discovery document on first use rather
+// than at startup, so the server still starts while the provider is down.
+func (s *OIDCService) getProvider(ctx context.Context) (*oidc.Provider, error) {
+	if !s.config.Enabled {
+		return nil, utils.ErrOIDCDisabled
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(context.WithoutCancel(ctx), s.config.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("cannot reach identity provider: %w", err)
+		}
+		s.provider = provider
+	}
+	return s.provider, nil
+}
+
+func (s *OIDCService) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		RedirectURL:  s.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       s.config.Scopes,
+	}
+}
+
+// AuthURL starts a login and returns the provider URL to send the browser
+// to, along with a binder for the browser to keep in a cookie. The state,
+// nonce, PKCE verifier and the binder's hash are kept server-side until the
+// callback, which only completes the login when it presents the same binder.
+func (s *OIDCService) AuthURL(ctx context.Context) (string, string, error) {
+	provider, err := s.getProvider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	binder := randomHex(16)
+	login := &model.OIDCLogin{
+		State:        randomHex(16),
+		Nonce:        randomHex(16),
+		CodeVerifier: oauth2.GenerateVerifier(),
+		BinderHash:   hashRefreshSecret(binder),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCLoginTTL),
+	}
+	if err := s.identityRepository.CreateLogin(login); err != nil {
+		return "", "", err
+	}
+	return s.oauth2Config(provider).AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.S256ChallengeOption(login.CodeVerifier),
+	), binder, nil
+}
+
+// LoginCookieSecure reports whether the login binder cookie needs HTTPS,
+// which it does whenever the provider redirects back over HTTPS.
+func (s *OIDCService) LoginCookieSecure() bool {
+	return strings.HasPrefix(s.config.RedirectURL, "https://")
+}
+
+// Callback completes a login: it checks that binder is the one handed to the
+// browser that started it, exchanges the code, verifies the ID token, finds
+// or creates the user and logs them in. Users with TOTP still have to pass
+// its challenge, as with a password login.
+func (s *OIDCService) Callback(ctx context.Context, req *OIDCCallbackRequest, binder string, actor *model.Actor, userAgent string) (*LoginResponse, error) {
+	provider, err := s.getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	login, err := s.identityRepository.ConsumeLogin(req.State, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if binder == "" || subtle.ConstantTimeCompare([]byte(hashRefreshSecret(binder)), []byte(login.BinderHash)) != 1 {
+		return nil, utils.ErrInvalidOIDCState
+	}
+	token, err := s.oauth2Config(provider).Exchange(ctx, req.Code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("cannot exchange authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("identity provider returned no ID token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, errors.New("invalid ID token: nonce does not match")
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	user, err := s.resolveUser(idToken.Issuer, idToken.Subject, &claims, actor)
+	if err != nil {
+		return nil, err
+	}
+	return s.userService.beginLogin(user, actor.IP, userAgent)
+}
+
+// resolveUser returns the user linked to the identity, linking it to the
+// user with the same email or provisioning a new user on first login. An
+// existing user is only linked when both the provider and finsys have
+// verified the email; oidc.require_verified_email only decides whether a new
+// user may be provisioned from an unverified one.
+func (s *OIDCService) resolveUser(issuer, subject string, claims *oidcClaims, actor *model.Actor) (*model.User, error) {
+	identity, err := s.identityRepository.FindByIssuerSubject(issuer, subject)
+	if err == nil {
+		if err := s.identityRepository.TouchLogin(identity.ID, time.Now()); err != nil {
+			return nil, err
+		}
+		user, err := s.userService.userRepository.FindByID(identity.UserID)
+		if err != nil {
+			return nil, utils.ErrUserNotExists
+		}
+		return user, nil
+	}
+	if !errors.Is(err, utils.ErrIdentityNotLinked) {
+		return nil, err
+	}
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return nil, utils.ErrOIDCEmailRequired
+	}
+	verified := claims.EmailVerified != nil && *claims.EmailVerified
+	var user *model.User
+	err = s.userService.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		users := s.userService.userRepository.WithTx(tx)
+		var err error
+		if user, err = users.FindByEmail(email); err == nil {
+			if !verified || !user.EmailVerified {
+				return utils.ErrOIDCEmailNotVerified
+			}
+		} else {
+			if !s.config.AutoProvision {
+				return utils.ErrIdentityNotLinked
+			}
+			if s.config.RequireVerifiedEmail && !verified {
+				return utils.ErrOIDCEmailRequired
+			}
+			if user, err = s.provisionUser(users, audit, email, claims, actor); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		identity := &model.UserIdentity{
+			UserID:      user.ID,
+			Issuer:      issuer,
+			Subject:     subject,
+			Email:       email,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		}
+		if err := s.identityRepository.WithTx(tx).Create(identity); err != nil {
+			return err
+		}
+		linkActor := *actor
+		linkActor.UserID = user.ID
+		return audit.Record(&linkActor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+			nil, map[string]string{"linked_issuer": issuer, "linked_subject": subject})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates a user for a first-time SSO login. The password is
+// random, so the user can only sign in through the provider.
+func (s *OIDCService) provisionUser(users repository.UserRepository, audit *AuditService, email string, claims *oidcClaims, actor *model.Actor) (*model.User, error) {
+	username, err := availableUsername(users, claims.PreferredUsername, email)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username:      username,
+		Password:      randomHex(16),
+		Email:         email,
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Role:          s.config.DefaultRole,
+	}
+	if err := users.Create(user); err != nil {
+		return nil, err
+	}
+	provisionActor := *actor
+	provisionActor.UserID = user.ID
+	if err := audit.Record(&provisionActor, model.AuditActionCreate, model.AuditEntityUser, user.ID,
+		nil, newUserResponse(user)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a username that fits the 3 to 20 character rule
+// from the preferred username or the email's local part, adding a number when
+// it is taken.
+func availableUsername(users repository.UserRepository, preferred, email string) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(preferred, "")
+	if len(base) < 3 {
+		local, _, _ := strings.Cut(email, "@")
+		base = usernameInvalidChars.ReplaceAllString(local, "")
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	for i := 1; i <= 100; i++ {
+		suffix := ""
+		if i > 1 {
+			suffix = fmt.Sprintf("%d", i)
+		}
+		candidate := base
+		if len(candidate)+len(suffix) > 20 {
+			candidate = candidate[:20-len(suffix)]
+		}
+		candidate += suffix
+		if _, err := users.FindByUsername(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "user" + randomHex(8), nil
+}
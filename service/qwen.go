@@ -14,11 +14,12 @@ import (
 
 type QwenLLM struct {
 	apiKey       string
+	apiURL       string
 	client       *http.Client
 	systemPrompt string
 }
 
-func NewQwenLLM(apiKey string) *QwenLLM {
+func NewQwenLLM(apiKey, apiURL string) *QwenLLM {
 	systemPrompt := `
 # Role and Goal
 You are FinBot, an advanced AI financial assistant embedded within the 'finsys' financial analytics platform. Your core duties are:
@@ -81,6 +82,7 @@ When you need to retrieve information from the system, you MUST NOT fabricate da
 `
 	return &QwenLLM{
 		apiKey:       apiKey,
+		apiURL:       apiURL,
 		client:       &http.Client{},
 		systemPrompt: systemPrompt,
 	}
@@ -91,6 +93,7 @@ type qwenAPIRequest struct {
 	Messages    []model.LLMMessage `json:"messages"`
 	Temperature float64            `json:"temperature,omitempty"`
 	TopP        float64            `json:"top_p,omitempty"`
+	MaxTokens   int64              `json:"max_tokens,omitempty"`
 }
 
 // --- UPDATED: Response struct for OpenAI-compatible endpoint ---
@@ -100,15 +103,14 @@ type qwenAPIResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage model.LLMTokenUsage `json:"usage"`
 }
 
 func (q *QwenLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.LLMChatResponse, error) {
 	if q.apiKey == "" || q.apiKey == "YOUR_DASHSCOPE_API_KEY" {
-		return nil, errors.New("Qwen API key is not configured in config/config.go")
+		return nil, errors.New("Qwen API key is not configured, set llm.api_key or FINSYS_LLM_API_KEY")
 	}
 
-	apiURL := "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions"
-
 	messagesWithSystemPrompt := append([]model.LLMMessage{{Role: "system", Content: q.systemPrompt}}, req.Messages...)
 
 	apiRequest := qwenAPIRequest{
@@ -116,6 +118,7 @@ func (q *QwenLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.L
 		Messages:    messagesWithSystemPrompt,
 		Temperature: 0.7,
 		TopP:        0.8,
+		MaxTokens:   req.MaxTokens,
 	}
 
 	reqBody, err := json.Marshal(apiRequest)
@@ -123,7 +126,7 @@ func (q *QwenLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.L
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", q.apiURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, err
 	}
@@ -157,5 +160,6 @@ func (q *QwenLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.L
 
 	return &model.LLMChatResponse{
 		Content: apiResponse.Choices[0].Message.Content,
+		Usage:   apiResponse.Usage,
 	}, nil
 }
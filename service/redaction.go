@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+)
+
+const (
+	redactAccount = "ACCOUNT"
+	redactEmail   = "EMAIL"
+	redactAmount  = "AMOUNT"
+)
+
+// redactIDContextBytes is how much of the text before a number is searched
+// for words that make it an ID.
+const redactIDContextBytes = 64
+
+var (
+	redactEmailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	// Any number can be an amount. ISO dates are matched as a whole by the
+	// first group so that their parts are left alone.
+	redactAmountPattern = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b|\b(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?\b`)
+	// redactYearPattern matches a number that is taken for a year, as in
+	// "in 2024", rather than an amount. An amount of 2024 is therefore sent
+	// as it is.
+	redactYearPattern = regexp.MustCompile(`^(?:19|20)\d{2}$`)
+	// redactIDContextPattern matches the text just before a number that names
+	// a record rather than an amount, as in "transaction 42", "id: 42",
+	// "txnId=42", `"transaction_id": 42`, "#42" or the later numbers of
+	// "transactions 41, 42 and 43". The model has to pass those back to its
+	// tools unchanged.
+	redactIDContextPattern = regexp.MustCompile(`(?:(?i:\b(?:ids?|transactions?|txns?))|[a-z](?:Id|ID)s?|_(?i:ids?)|#)["']?\s*[:=#]?\s*(?:\d+\s*(?:,|and|or|&)\s*)*$`)
+	// Placeholders are matched loosely, since the model may drop the brackets
+	// or the rounded amount when it repeats one.
+	redactPlaceholderPattern = regexp.MustCompile(`\[?\b((?:ACCOUNT|EMAIL|AMOUNT)_\d+)\b(?: ~[\d.]+)?\]?`)
+)
+
+// Redactor swaps the details in one request's messages for placeholders and
+// back. The mapping lives only as long as the Redactor, so it is never
+// stored or sent anywhere.
+type Redactor struct {
+	accountPattern *regexp.Regexp
+	amountDigits   int
+	placeholders   map[string]string
+	originals      map[string]string
+	counts         map[string]int
+}
+
+func newRedactor(accountPattern *regexp.Regexp, amountDigits int) *Redactor {
+	return &Redactor{
+		accountPattern: accountPattern,
+		amountDigits:   amountDigits,
+		placeholders:   make(map[string]string),
+		originals:      make(map[string]string),
+		counts:         make(map[string]int),
+	}
+}
+
+// Redact replaces emails, account names and precise amounts in text. The
+// same value always gets the same placeholder.
+func (r *Redactor) Redact(text string) string {
+	text = redactEmailPattern.ReplaceAllStringFunc(text, func(email string) string {
+		return r.placeholder(redactEmail, email, "")
+	})
+	text = r.accountPattern.ReplaceAllStringFunc(text, func(account string) string {
+		return r.placeholder(redactAccount, account, "")
+	})
+	return r.redactAmounts(text)
+}
+
+// redactAmounts replaces numbers more precise than amountDigits, skipping
+// dates, years and numbers that the words before them mark as IDs.
+func (r *Redactor) redactAmounts(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range redactAmountPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[0], match[1]
+		if match[2] >= 0 || redactIDContextPattern.MatchString(text[max(0, start-redactIDContextBytes):start]) {
+			continue
+		}
+		amount := text[start:end]
+		if redactYearPattern.MatchString(amount) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		rounded, approximate := roundSignificant(value, r.amountDigits)
+		if rounded == value {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(r.placeholder(redactAmount, amount, approximate))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Restore puts the original values back in place of the placeholders.
+func (r *Redactor) Restore(text string) string {
+	return redactPlaceholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := redactPlaceholderPattern.FindStringSubmatch(match)[1]
+		if original, ok := r.originals[name]; ok {
+			return original
+		}
+		return match
+	})
+}
+
+func (r *Redactor) placeholder(kind, original, approximate string) string {
+	name, ok := r.placeholders[original]
+	if !ok {
+		r.counts[kind]++
+		name = fmt.Sprintf("%s_%d", kind, r.counts[kind])
+		r.placeholders[original] = name
+		r.originals[name] = original
+	}
+	if approximate != "" {
+		return "[" + name + " ~" + approximate + "]"
+	}
+	return "[" + name + "]"
+}
+
+// roundSignificant rounds value to digits significant digits and formats the
+// result without spurious decimals.
+func roundSignificant(value float64, digits int) (float64, string) {
+	if value == 0 {
+		return 0, "0"
+	}
+	exponent := int(math.Floor(math.Log10(math.Abs(value)))) - digits + 1
+	scale := math.Pow(10, float64(exponent))
+	rounded := math.Round(value/scale) * scale
+	return rounded, strconv.FormatFloat(rounded, 'f', max(0, -exponent), 64)
+}
+
+// RedactingLLM keeps personal and financial details from leaving the system:
+// it redacts every message before passing the request on to the wrapped LLM
+// and restores the details in the reply.
+type RedactingLLM struct {
+	next           model.LLM
+	accountPattern *regexp.Regexp
+	amountDigits   int
+}
+
+func NewRedactingLLM(next model.LLM, redactionConfig *config.RedactionConfig) *RedactingLLM {
+	return &RedactingLLM{
+		next:           next,
+		accountPattern: regexp.MustCompile(redactionConfig.AccountPattern),
+		amountDigits:   redactionConfig.AmountSignificantDigits,
+	}
+}
+
+func (l *RedactingLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.LLMChatResponse, error) {
+	redactor := newRedactor(l.accountPattern, l.amountDigits)
+	redacted := &model.LLMChatRequest{
+		Model:     req.Model,
+		Messages:  make([]model.LLMMessage, len(req.Messages)),
+		MaxTokens: req.MaxTokens,
+	}
+	for i, message := range req.Messages {
+		redacted.Messages[i] = model.LLMMessage{Role: message.Role, Content: redactor.Redact(message.Content)}
+	}
+	resp, err := l.next.Chat(ctx, redacted)
+	if err != nil {
+		return nil, err
+	}
+	restored := *resp
+	restored.Content = redactor.Restore(resp.Content)
+	return &restored, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+)
+
+// testAccountPattern is the default account pattern.
+var testAccountPattern = regexp.MustCompile(`\b[CM]\d{5,}\b`)
+
+func TestRedactorRoundTrip(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"C12345 sent 1234.56 to M67890", "[ACCOUNT_1] sent [AMOUNT_1 ~1200] to [ACCOUNT_2]"},
+		{"mail bob@example.com about C12345", "mail [EMAIL_1] about [ACCOUNT_1]"},
+		{"C12345 paid C12345 twice", "[ACCOUNT_1] paid [ACCOUNT_1] twice"},
+		{"C1234 is too short to be an account", "C1234 is too short to be an account"},
+		// Amounts no more precise than two significant digits are kept.
+		{"paid 1200 and 50 and 0.5", "paid 1200 and 50 and 0.5"},
+		{"total 1,234,567.89", "total [AMOUNT_1 ~1200000]"},
+		{"on 2024-01-15 at 13", "on 2024-01-15 at 13"},
+		// Standalone years are kept, but not amounts that merely start like one.
+		{"in 2024 and FY2023, up from 1999", "in 2024 and FY2023, up from 1999"},
+		{"paid 2024.5 and 20245 and 2,024 in 2024.", "paid [AMOUNT_1 ~2000] and [AMOUNT_2 ~20000] and [AMOUNT_3 ~2000] in 2024."},
+		{"paid 1899 and 2101", "paid [AMOUNT_1 ~1900] and [AMOUNT_2 ~2100]"},
+		// Numbers the words before them mark as IDs are kept.
+		{"transaction 12345 moved 1234.5", "transaction 12345 moved [AMOUNT_1 ~1200]"},
+		{"txnId=987654, #4321 and id: 5555", "txnId=987654, #4321 and id: 5555"},
+		{"transactions 41, 42 and 4345", "transactions 41, 42 and 4345"},
+		{`{"transaction_id": 987654, "amount": 181.0}`, `{"transaction_id": 987654, "amount": [AMOUNT_1 ~180]}`},
+	}
+	for _, tt := range tests {
+		redactor := newRedactor(testAccountPattern, 2)
+		redacted := redactor.Redact(tt.text)
+		if redacted != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, redacted, tt.want)
+		}
+		if restored := redactor.Restore(redacted); restored != tt.text {
+			t.Errorf("Restore(%q) = %q, want %q", redacted, restored, tt.text)
+		}
+	}
+}
+
+func TestRedactorRestore(t *testing.T) {
+	redactor := newRedactor(testAccountPattern, 2)
+	redactor.Redact("C12345 sent 1234.56")
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{"[ACCOUNT_1] looks fine", "C12345 looks fine"},
+		// The model may drop the brackets or the rounded amount.
+		{"ACCOUNT_1 sent [AMOUNT_1]", "C12345 sent 1234.56"},
+		{"it was AMOUNT_1 ~1200", "it was 1234.56"},
+		{"unknown [ACCOUNT_2] and EMAIL_1", "unknown [ACCOUNT_2] and EMAIL_1"},
+	}
+	for _, tt := range tests {
+		if got := redactor.Restore(tt.reply); got != tt.want {
+			t.Errorf("Restore(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestRoundSignificant(t *testing.T) {
+	tests := []struct {
+		value       float64
+		digits      int
+		want        float64
+		wantPrinted string
+	}{
+		{1234.56, 2, 1200, "1200"},
+		{0.012345, 2, 0.012, "0.012"},
+		{-987, 1, -1000, "-1000"},
+		{50, 2, 50, "50"},
+		{0, 2, 0, "0"},
+	}
+	for _, tt := range tests {
+		got, printed := roundSignificant(tt.value, tt.digits)
+		if got != tt.want || printed != tt.wantPrinted {
+			t.Errorf("roundSignificant(%v, %d) = %v, %q, want %v, %q", tt.value, tt.digits, got, printed, tt.want, tt.wantPrinted)
+		}
+	}
+}
+
+type recordingLLM struct {
+	request *model.LLMChatRequest
+	reply   string
+}
+
+func (l *recordingLLM) Chat(ctx context.Context, req *model.LLMChatRequest) (*model.LLMChatResponse, error) {
+	l.request = req
+	return &model.LLMChatResponse{Content: l.reply, Usage: model.LLMTokenUsage{TotalTokens: 7}}, nil
+}
+
+func TestRedactingLLM(t *testing.T) {
+	next := &recordingLLM{reply: "[ACCOUNT_1] sent [AMOUNT_1 ~1200] to [EMAIL_1]"}
+	llm := NewRedactingLLM(next, &config.RedactionConfig{AccountPattern: testAccountPattern.String(), AmountSignificantDigits: 2})
+	resp, err := llm.Chat(context.Background(), &model.LLMChatRequest{Messages: []model.LLMMessage{
+		{Role: "system", Content: "Answer about C12345."},
+		{Role: "user", Content: "Did C12345 send 1234.56 to bob@example.com?"},
+	}})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	sent := []string{"Answer about [ACCOUNT_1].", "Did [ACCOUNT_1] send [AMOUNT_1 ~1200] to [EMAIL_1]?"}
+	for i, message := range next.request.Messages {
+		if message.Content != sent[i] {
+			t.Errorf("message %d was sent as %q, want %q", i, message.Content, sent[i])
+		}
+	}
+	if want := "C12345 sent 1234.56 to bob@example.com"; resp.Content != want {
+		t.Errorf("reply is %q, want %q", resp.Content, want)
+	}
+	if resp.Usage.TotalTokens != 7 {
+		t.Errorf("reply lost its usage: %+v", resp.Usage)
+	}
+}
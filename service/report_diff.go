@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script turning a into b, from a longest common
+// subsequence of lines. Reports are a few dozen lines, so the quadratic table
+// is small.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders the difference between two texts in unified diff
+// format, with fromName and toName as the file names. It returns an empty
+// string when the texts are equal.
+func unifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(strings.Split(from, "\n"), strings.Split(to, "\n"))
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the hunk around it.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		first := max(start-diffContext, 0)
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*diffContext {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= max(unchanged-diffContext, 0)
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:first] {
+			if op.kind != '+' {
+				fromLine++
+			}
+			if op.kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[first:end] {
+			if op.kind != '+' {
+				fromCount++
+			}
+			if op.kind != '-' {
+				toCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+		for _, op := range ops[first:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		start = end
+	}
+	return out.String()
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/config"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/repository"
+	"github.com/Mitsui515/finsys/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	userThrottlePrefix = "user:"
+	ipThrottlePrefix   = "ip:"
+)
+
+// LoginThrottledError is ErrLoginThrottled along with how long the client
+// has to wait.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return utils.ErrLoginThrottled.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return utils.ErrLoginThrottled
+}
+
+// SecurityService tracks failed logins, locks out usernames and IPs that
+// keep failing, and keeps the security log of those locks.
+type SecurityService struct {
+	securityRepository repository.SecurityRepository
+	config             config.LoginConfig
+}
+
+func NewSecurityService(db *gorm.DB) *SecurityService {
+	return &SecurityService{
+		securityRepository: repository.NewSecurityRepository(db),
+		config:             config.Current().Login,
+	}
+}
+
+type SecurityEventListResponse struct {
+	Total  int64                  `json:"total"`
+	Page   int                    `json:"page"`
+	Size   int                    `json:"size"`
+	Events []*model.SecurityEvent `json:"events"`
+}
+
+// CheckLogin refuses an attempt while the username or IP is locked, or while
+// the username still has to wait after its last failure.
+func (s *SecurityService) CheckLogin(username, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, target := range []string{userTarget(username), ipThrottlePrefix + ip} {
+		throttle, err := s.securityRepository.FindThrottle(target)
+		if err != nil {
+			return err
+		}
+		if d := s.waitFor(throttle, now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt against the username and the IP and
+// locks either once it reaches its limit. userID is zero for unknown
+// usernames.
+func (s *SecurityService) RecordFailure(username, ip string, userID uint) error {
+	now := time.Now()
+	locked, err := s.countFailure(userTarget(username), s.config.MaxFailures, now)
+	if err != nil {
+		return err
+	}
+	if locked != nil {
+		if err := s.securityRepository.CreateEvent(&model.SecurityEvent{
+			Type:      model.SecurityEventAccountLocked,
+			Username:  strings.TrimPrefix(locked.Target, userThrottlePrefix),
+			UserID:    userID,
+			IP:        ip,
+			Details:   fmt.Sprintf("%d failed logins, locked until %s", locked.Failures, locked.LockedUntil.UTC().Format(time.RFC3339)),
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+	}
+	locked, err = s.countFailure(ipThrottlePrefix+ip, s.config.IPMaxFailures, now)
+	if err != nil {
+		return err
+	}
+	if locked != nil {
+		return s.securityRepository.CreateEvent(&model.SecurityEvent{
+			Type:      model.SecurityEventIPLocked,
+			Username:  strings.TrimPrefix(userTarget(username), userThrottlePrefix),
+			IP:        ip,
+			Details:   fmt.Sprintf("%d failed logins, locked until %s", locked.Failures, locked.LockedUntil.UTC().Format(time.RFC3339)),
+			CreatedAt: now,
+		})
+	}
+	return nil
+}
+
+// RecordSuccess clears the username's failures. The IP's are left to expire,
+// or one valid account would let an attacker reset them at will.
+func (s *SecurityService) RecordSuccess(username string) error {
+	_, err := s.securityRepository.DeleteThrottle(userTarget(username))
+	return err
+}
+
+// UnlockUser lifts the lock on a user and clears their failures.
+func (s *SecurityService) UnlockUser(user *model.User, actor *model.Actor) error {
+	if _, err := s.securityRepository.DeleteThrottle(userTarget(user.Username)); err != nil {
+		return err
+	}
+	return s.securityRepository.CreateEvent(&model.SecurityEvent{
+		Type:      model.SecurityEventUnlocked,
+		Username:  user.Username,
+		UserID:    user.ID,
+		ActorID:   actor.UserID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// UnlockIP lifts the lock on a client IP and clears its failures.
+func (s *SecurityService) UnlockIP(ip string, actor *model.Actor) error {
+	if _, err := s.securityRepository.DeleteThrottle(ipThrottlePrefix + ip); err != nil {
+		return err
+	}
+	return s.securityRepository.CreateEvent(&model.SecurityEvent{
+		Type:      model.SecurityEventUnlocked,
+		IP:        ip,
+		ActorID:   actor.UserID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Locks returns the usernames and IPs that are locked out now.
+func (s *SecurityService) Locks() ([]*model.LoginThrottle, error) {
+	return s.securityRepository.ListLocked(time.Now())
+}
+
+func (s *SecurityService) ListEvents(page, size int, eventType string) (*SecurityEventListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 20
+	}
+	events, total, err := s.securityRepository.ListEvents(page, size, eventType)
+	if err != nil {
+		return nil, err
+	}
+	return &SecurityEventListResponse{
+		Total:  total,
+		Page:   page,
+		Size:   size,
+		Events: events,
+	}, nil
+}
+
+// countFailure adds a failure to target and returns it when this failure
+// locked it. The count is updated in the database rather than read and
+// written back, so concurrent guesses cannot overwrite each other's failures.
+func (s *SecurityService) countFailure(target string, maxFailures int, now time.Time) (*model.LoginThrottle, error) {
+	if err := s.securityRepository.AddFailure(target, now, now.Add(-s.config.FailureWindow)); err != nil {
+		return nil, err
+	}
+	locked, err := s.securityRepository.LockThrottle(target, maxFailures, now.Add(s.config.LockoutDuration))
+	if err != nil || !locked {
+		return nil, err
+	}
+	return s.securityRepository.FindThrottle(target)
+}
+
+func (s *SecurityService) waitFor(throttle *model.LoginThrottle, now time.Time) time.Duration {
+	if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now)
+	}
+	if !strings.HasPrefix(throttle.Target, userThrottlePrefix) || now.Sub(throttle.LastFailureAt) > s.config.FailureWindow {
+		return 0
+	}
+	return throttle.LastFailureAt.Add(s.delay(throttle.Failures)).Sub(now)
+}
+
+// delay is how long a username waits after the given number of failures.
+func (s *SecurityService) delay(failures int) time.Duration {
+	if failures < s.config.DelayAfter {
+		return 0
+	}
+	d := time.Second << min(failures-s.config.DelayAfter, 16)
+	return min(d, s.config.MaxDelay)
+}
+
+// userTarget keys a username's failures. Usernames longer than any real one
+// are cut short so they still fit the column.
+func userTarget(username string) string {
+	if len(username) > 100 {
+		username = username[:100]
+	}
+	return userThrottlePrefix + username
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/middleware"
+	"github.com/Mitsui515/finsys/model"
+	"github.com/Mitsui515/finsys/utils"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// startSession opens a session for user and issues its first token pair.
+func (s *UserService) startSession(user *model.User, ip, userAgent string) (*TokenResponse, error) {
+	secret, hash := newRefreshSecret()
+	now := time.Now()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := &model.Session{
+		ID:          randomHex(16),
+		UserID:      user.ID,
+		RefreshHash: hash,
+		IP:          ip,
+		UserAgent:   userAgent,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(middleware.DefaultJWTConfig().RefreshTokenExpire),
+	}
+	if err := s.sessionRepository.Create(session); err != nil {
+		return nil, err
+	}
+	if err := s.securityService.RecordSuccess(user.Username); err != nil {
+		return nil, err
+	}
+	return issueTokens(user, session.ID, secret)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once: presenting the one that was last exchanged means it leaked, so
+// the whole session is revoked. Any other mismatch is rejected without
+// touching the session, so a guessed or garbled token cannot log anyone out.
+func (s *UserService) Refresh(req *RefreshRequest) (*TokenResponse, error) {
+	sessionID, secret, ok := strings.Cut(req.RefreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+	session, err := s.sessionRepository.FindByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+	hash := hashRefreshSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshHash)) != 1 {
+		if session.PreviousRefreshHash == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(session.PreviousRefreshHash)) != 1 {
+			return nil, utils.ErrInvalidRefreshToken
+		}
+		if err := s.sessionRepository.Revoke(session.ID); err != nil {
+			return nil, err
+		}
+		return nil, utils.ErrRefreshTokenReused
+	}
+	user, err := s.userRepository.FindByID(session.UserID)
+	if err != nil || user.Disabled {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+	newSecret, newHash := newRefreshSecret()
+	expiresAt := time.Now().Add(middleware.DefaultJWTConfig().RefreshTokenExpire)
+	rotated, err := s.sessionRepository.Rotate(session.ID, session.RefreshHash, newHash, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, utils.ErrInvalidRefreshToken
+	}
+	return issueTokens(user, session.ID, newSecret)
+}
+
+// Logout revokes one session, along with its refresh token and any access
+// tokens issued for it.
+func (s *UserService) Logout(sessionID string) error {
+	return s.sessionRepository.Revoke(sessionID)
+}
+
+// LogoutAll revokes every session of the user and returns how many were
+// still active.
+func (s *UserService) LogoutAll(userID uint) (int64, error) {
+	if _, err := s.userRepository.FindByID(userID); err != nil {
+		return 0, utils.ErrUserNotExists
+	}
+	return s.sessionRepository.RevokeByUser(userID)
+}
+
+func issueTokens(user *model.User, sessionID, secret string) (*TokenResponse, error) {
+	token, err := middleware.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		Token:        token,
+		RefreshToken: sessionID + "." + secret,
+		ExpiresIn:    int64(middleware.DefaultJWTConfig().TokenExpire.Seconds()),
+	}, nil
+}
+
+// newRefreshSecret returns a random refresh secret and the hash stored in
+// its place.
+func newRefreshSecret() (string, string) {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	return secret, hashRefreshSecret(secret)
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
+
+func randomBytes(n int) []byte {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return buf
+}
@@ -2,11 +2,7 @@ package service
 
 import (
 	"context"
-	"encoding/csv"
-	"errors"
-	"io"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/Mitsui515/finsys/config"
@@ -20,11 +16,13 @@ import (
 
 type TransactionService struct {
 	transactionRepository repository.TransactionRepository
+	auditService          *AuditService
 }
 
 func NewTransactionService(db *gorm.DB) *TransactionService {
 	return &TransactionService{
 		transactionRepository: repository.NewTransactionRepository(db),
+		auditService:          NewAuditService(db),
 	}
 }
 
@@ -40,18 +38,20 @@ type TransactionRequest struct {
 }
 
 type TransactionResponse struct {
-	ID             uint      `json:"id"`
-	Type           string    `json:"type"`
-	Amount         float64   `json:"amount"`
-	NameOrig       string    `json:"nameOrig"`
-	OldBalanceOrig float64   `json:"oldBalanceOrig"`
-	NewBalanceOrig float64   `json:"newBalanceOrig"`
-	NameDest       string    `json:"nameDest"`
-	OldBalanceDest float64   `json:"oldBalanceDest"`
-	NewBalanceDest float64   `json:"newBalanceDest"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt,omitempty"`
-	DeletedAt      time.Time `json:"deletedAt,omitempty"`
+	ID               uint      `json:"id"`
+	Type             string    `json:"type"`
+	Amount           float64   `json:"amount"`
+	NameOrig         string    `json:"nameOrig"`
+	OldBalanceOrig   float64   `json:"oldBalanceOrig"`
+	NewBalanceOrig   float64   `json:"newBalanceOrig"`
+	NameDest         string    `json:"nameDest"`
+	OldBalanceDest   float64   `json:"oldBalanceDest"`
+	NewBalanceDest   float64   `json:"newBalanceDest"`
+	IsFraud          bool      `json:"isFraud"`
+	FraudProbability float64   `json:"fraudProbability"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt,omitempty"`
+	DeletedAt        time.Time `json:"deletedAt,omitempty"`
 }
 
 type TransactionListResponse struct {
@@ -61,6 +61,13 @@ type TransactionListResponse struct {
 	Transactions []TransactionResponse `json:"transactions"`
 }
 
+type TransactionCursorResponse struct {
+	Total        *int64                `json:"total,omitempty"`
+	Size         int                   `json:"size"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+	Transactions []TransactionResponse `json:"transactions"`
+}
+
 func (s *TransactionService) GetByID(id uint) (*TransactionResponse, error) {
 	transaction, err := s.transactionRepository.FindByID(id)
 	if err != nil {
@@ -70,54 +77,99 @@ func (s *TransactionService) GetByID(id uint) (*TransactionResponse, error) {
 		return nil, err
 	}
 	return &TransactionResponse{
-		ID:             transaction.ID,
-		Type:           transaction.Type,
-		Amount:         transaction.Amount,
-		NameOrig:       transaction.NameOrig,
-		OldBalanceOrig: transaction.OldBalanceOrig,
-		NewBalanceOrig: transaction.NewBalanceOrig,
-		NameDest:       transaction.NameDest,
-		OldBalanceDest: transaction.OldBalanceDest,
-		NewBalanceDest: transaction.NewBalanceDest,
-		CreatedAt:      transaction.CreatedAt,
+		ID:               transaction.ID,
+		Type:             transaction.Type,
+		Amount:           transaction.Amount,
+		NameOrig:         transaction.NameOrig,
+		OldBalanceOrig:   transaction.OldBalanceOrig,
+		NewBalanceOrig:   transaction.NewBalanceOrig,
+		NameDest:         transaction.NameDest,
+		OldBalanceDest:   transaction.OldBalanceDest,
+		NewBalanceDest:   transaction.NewBalanceDest,
+		IsFraud:          transaction.IsFraud,
+		FraudProbability: transaction.FraudProbability,
+		CreatedAt:        transaction.CreatedAt,
 	}, nil
 }
 
-func (s *TransactionService) ListByPage(page, size int, transactionType string, startTime, endTime *time.Time) (*TransactionListResponse, error) {
+func (s *TransactionService) ListByPage(page, size int, filter *model.TransactionFilter) (*TransactionListResponse, error) {
 	if page <= 0 {
 		page = 1
 	}
 	if size <= 0 {
 		size = 10
 	}
-	transactions, total, err := s.transactionRepository.List(page, size, transactionType, startTime, endTime)
+	transactions, total, err := s.transactionRepository.List(page, size, filter)
 	if err != nil {
 		return nil, err
 	}
-	responses := make([]TransactionResponse, len(transactions))
-	for i, transaction := range transactions {
-		responses[i] = TransactionResponse{
-			ID:             transaction.ID,
-			Type:           transaction.Type,
-			Amount:         transaction.Amount,
-			NameOrig:       transaction.NameOrig,
-			OldBalanceOrig: transaction.OldBalanceOrig,
-			NewBalanceOrig: transaction.NewBalanceOrig,
-			NameDest:       transaction.NameDest,
-			OldBalanceDest: transaction.OldBalanceDest,
-			NewBalanceDest: transaction.NewBalanceDest,
-			CreatedAt:      transaction.CreatedAt,
-		}
-	}
 	return &TransactionListResponse{
 		Total:        int(total),
 		Page:         page,
 		Size:         size,
-		Transactions: responses,
+		Transactions: newTransactionResponses(transactions),
 	}, nil
 }
 
-func (s *TransactionService) Create(req *TransactionRequest) (uint, error) {
+// ListByCursor returns the page of transactions after the opaque cursor
+// token, or the first page when it is empty. The total is only counted when
+// withTotal is set, since counting a large table is what cursors avoid.
+func (s *TransactionService) ListByCursor(cursor string, size int, filter *model.TransactionFilter, withTotal bool) (*TransactionCursorResponse, error) {
+	if size <= 0 {
+		size = 10
+	}
+	scope := utils.CursorScope("transactions", filter)
+	after, err := utils.DecodeCursor(cursor, scope)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.transactionRepository.ListAfter(after, size+1, filter)
+	if err != nil {
+		return nil, err
+	}
+	response := &TransactionCursorResponse{Size: size}
+	if len(transactions) > size {
+		transactions = transactions[:size]
+		last := transactions[size-1]
+		response.NextCursor = utils.EncodeCursor(model.PageCursor{Time: last.CreatedAt, ID: last.ID}, scope)
+	}
+	response.Transactions = newTransactionResponses(transactions)
+	if withTotal {
+		total, err := s.transactionRepository.Count(filter)
+		if err != nil {
+			return nil, err
+		}
+		response.Total = &total
+	}
+	return response, nil
+}
+
+func newTransactionResponses(transactions []*model.Transaction) []TransactionResponse {
+	responses := make([]TransactionResponse, len(transactions))
+	for i, transaction := range transactions {
+		responses[i] = TransactionResponse{
+			ID:               transaction.ID,
+			Type:             transaction.Type,
+			Amount:           transaction.Amount,
+			NameOrig:         transaction.NameOrig,
+			OldBalanceOrig:   transaction.OldBalanceOrig,
+			NewBalanceOrig:   transaction.NewBalanceOrig,
+			NameDest:         transaction.NameDest,
+			OldBalanceDest:   transaction.OldBalanceDest,
+			NewBalanceDest:   transaction.NewBalanceDest,
+			IsFraud:          transaction.IsFraud,
+			FraudProbability: transaction.FraudProbability,
+			CreatedAt:        transaction.CreatedAt,
+		}
+	}
+	return responses
+}
+
+func (s *TransactionService) ValidateFilter(filter *model.TransactionFilter) error {
+	return repository.ValidateTransactionFilter(filter)
+}
+
+func (s *TransactionService) Create(req *TransactionRequest, actor *model.Actor) (uint, error) {
 	if err := validateTransaction(req); err != nil {
 		return 0, err
 	}
@@ -132,14 +184,20 @@ func (s *TransactionService) Create(req *TransactionRequest) (uint, error) {
 		NewBalanceDest: req.NewBalanceDest,
 		IsFraud:        false,
 	}
-	if err := s.transactionRepository.Create(&transaction); err != nil {
+	err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.transactionRepository.WithTx(tx).Create(&transaction); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionCreate, model.AuditEntityTransaction, transaction.ID, nil, transaction)
+	})
+	if err != nil {
 		return 0, err
 	}
 	go s.predictFraud(&transaction)
 	return transaction.ID, nil
 }
 
-func (s *TransactionService) Update(id uint, req *TransactionRequest) (*TransactionResponse, error) {
+func (s *TransactionService) Update(id uint, req *TransactionRequest, actor *model.Actor) (*TransactionResponse, error) {
 	if err := validateTransaction(req); err != nil {
 		return nil, err
 	}
@@ -147,6 +205,7 @@ func (s *TransactionService) Update(id uint, req *TransactionRequest) (*Transact
 	if err != nil {
 		return nil, err
 	}
+	before := *transaction
 	transaction.Type = req.Type
 	transaction.Amount = req.Amount
 	transaction.NameOrig = req.NameOrig
@@ -155,93 +214,44 @@ func (s *TransactionService) Update(id uint, req *TransactionRequest) (*Transact
 	transaction.NameDest = req.NameDest
 	transaction.OldBalanceDest = req.OldBalanceDest
 	transaction.NewBalanceDest = req.NewBalanceDest
-	if err := s.transactionRepository.Update(transaction); err != nil {
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.transactionRepository.WithTx(tx).Update(transaction); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityTransaction, transaction.ID, before, transaction)
+	})
+	if err != nil {
 		return nil, err
 	}
 	go s.predictFraud(transaction)
 	return &TransactionResponse{
-		ID:             transaction.ID,
-		Type:           transaction.Type,
-		Amount:         transaction.Amount,
-		NameOrig:       transaction.NameOrig,
-		OldBalanceOrig: transaction.OldBalanceOrig,
-		NewBalanceOrig: transaction.NewBalanceOrig,
-		NameDest:       transaction.NameDest,
-		OldBalanceDest: transaction.OldBalanceDest,
-		NewBalanceDest: transaction.NewBalanceDest,
-		CreatedAt:      transaction.CreatedAt,
-		UpdatedAt:      transaction.UpdatedAt,
+		ID:               transaction.ID,
+		Type:             transaction.Type,
+		Amount:           transaction.Amount,
+		NameOrig:         transaction.NameOrig,
+		OldBalanceOrig:   transaction.OldBalanceOrig,
+		NewBalanceOrig:   transaction.NewBalanceOrig,
+		NameDest:         transaction.NameDest,
+		OldBalanceDest:   transaction.OldBalanceDest,
+		NewBalanceDest:   transaction.NewBalanceDest,
+		IsFraud:          transaction.IsFraud,
+		FraudProbability: transaction.FraudProbability,
+		CreatedAt:        transaction.CreatedAt,
+		UpdatedAt:        transaction.UpdatedAt,
 	}, nil
 }
 
-func (s *TransactionService) Delete(id uint) error {
-	return s.transactionRepository.Delete(id)
-}
-
-func (s *TransactionService) ImportFromCSV(reader io.Reader) (int, error) {
-	csvReader := csv.NewReader(reader)
-	headers, err := csvReader.Read()
+func (s *TransactionService) Delete(id uint, actor *model.Actor) error {
+	transaction, err := s.transactionRepository.FindByID(id)
 	if err != nil {
-		return 0, err
-	}
-	headerMap := make(map[string]int)
-	for i, h := range headers {
-		headerMap[h] = i
-	}
-	requiredColumns := []string{"type", "amount", "nameOrig", "oldBalanceOrig", "newBalanceOrig", "nameDest", "oldBalanceDest", "newBalanceDest", "isFraud"}
-	for _, col := range requiredColumns {
-		if _, exists := headerMap[col]; !exists {
-			return 0, errors.New("CSV format error, there is no column " + col)
-		}
+		return err
 	}
-	var transactions []model.Transaction
-	batchSize := 90
-	totalImported := 0
-	for {
-		record, err := csvReader.Read()
-		if err == io.EOF {
-			break
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.transactionRepository.WithTx(tx).Delete(id); err != nil {
+			return err
 		}
-		if err != nil {
-			return totalImported, err
-		}
-		amount, err := strconv.ParseFloat(record[headerMap["amount"]], 64)
-		if err != nil {
-			continue
-		}
-		oldBalanceOrig, _ := strconv.ParseFloat(record[headerMap["oldBalanceOrig"]], 64)
-		newBalanceOrig, _ := strconv.ParseFloat(record[headerMap["newBalanceOrig"]], 64)
-		oldBalanceDest, _ := strconv.ParseFloat(record[headerMap["oldBalanceDest"]], 64)
-		newBalanceDest, _ := strconv.ParseFloat(record[headerMap["newBalanceDest"]], 64)
-		transaction := model.Transaction{
-			Type:           record[headerMap["type"]],
-			Amount:         amount,
-			NameOrig:       record[headerMap["nameOrig"]],
-			OldBalanceOrig: oldBalanceOrig,
-			NewBalanceOrig: newBalanceOrig,
-			NameDest:       record[headerMap["nameDest"]],
-			OldBalanceDest: oldBalanceDest,
-			NewBalanceDest: newBalanceDest,
-			IsFraud:        record[headerMap["isFraud"]] == "1",
-			CreatedAt:      time.Now(),
-			UpdatedAt:      time.Now(),
-		}
-		transactions = append(transactions, transaction)
-		if len(transactions) >= batchSize {
-			if err := config.DB.CreateInBatches(transactions, batchSize).Error; err != nil {
-				return totalImported, err
-			}
-			totalImported += len(transactions)
-			transactions = transactions[:0]
-		}
-	}
-	if len(transactions) > 0 {
-		if err := config.DB.CreateInBatches(transactions, len(transactions)).Error; err != nil {
-			return totalImported, err
-		}
-		totalImported += len(transactions)
-	}
-	return totalImported, nil
+		return audit.Record(actor, model.AuditActionDelete, model.AuditEntityTransaction, id, transaction, nil)
+	})
 }
 
 func validateTransaction(req *TransactionRequest) error {
@@ -261,7 +271,8 @@ func validateTransaction(req *TransactionRequest) error {
 }
 
 func (s *TransactionService) predictFraud(transaction *model.Transaction) {
-	transport, err := thrift.NewTSocket("localhost:9090")
+	thriftConfig := config.Current().Thrift
+	transport, err := thrift.NewTSocket(thriftConfig.Address)
 	if err != nil {
 		log.Fatalf("Error opening socket: %v", err)
 		return
@@ -285,7 +296,7 @@ func (s *TransactionService) predictFraud(transaction *model.Transaction) {
 		NewBalanceDest_: transaction.NewBalanceDest,
 		Timestamp:       thrift.StringPtr(transaction.CreatedAt.Format(time.RFC3339)),
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), thriftConfig.Timeout)
 	defer cancel()
 	prediction, err := client.PredictFraud(ctx, thriftTransaction)
 	if err != nil {
@@ -1,22 +1,46 @@
 package service
 
 import (
-	"regexp"
+	"sync"
 
 	"github.com/Mitsui515/finsys/config"
-	"github.com/Mitsui515/finsys/middleware"
 	"github.com/Mitsui515/finsys/model"
 	"github.com/Mitsui515/finsys/repository"
 	"github.com/Mitsui515/finsys/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// dummyPasswordHash is checked against when the username is unknown. It is
+// made on first use since hashing is deliberately slow.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("finsys"), bcrypt.DefaultCost)
+	return hash
+})
+
 type UserService struct {
-	userRepository repository.UserRepository
+	userRepository       repository.UserRepository
+	sessionRepository    repository.SessionRepository
+	mfaRepository        repository.MFARepository
+	rolePolicyRepository repository.RolePolicyRepository
+	userTokenRepository  repository.UserTokenRepository
+	auditService         *AuditService
+	securityService      *SecurityService
+	mailer               Mailer
+	mailConfig           config.MailConfig
 }
 
 func NewUserService() *UserService {
 	return &UserService{
-		userRepository: repository.NewUserRepository(config.DB),
+		userRepository:       repository.NewUserRepository(config.DB),
+		sessionRepository:    repository.NewSessionRepository(config.DB),
+		mfaRepository:        repository.NewMFARepository(config.DB),
+		rolePolicyRepository: repository.NewRolePolicyRepository(config.DB),
+		auditService:         NewAuditService(config.DB),
+		userTokenRepository:  repository.NewUserTokenRepository(config.DB),
+		securityService:      NewSecurityService(config.DB),
+		mailer:               NewMailer(config.Current().Mail),
+		mailConfig:           config.Current().Mail,
 	}
 }
 
@@ -31,49 +55,143 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+type UserResponse struct {
+	ID            uint   `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	Role          string `json:"role"`
+	Disabled      bool   `json:"disabled"`
+	CreatedAt     int64  `json:"createdAt"`
+}
+
+type UserListResponse struct {
+	Total int64          `json:"total"`
+	Page  int            `json:"page"`
+	Size  int            `json:"size"`
+	Users []UserResponse `json:"users"`
+}
+
+type RoleResponse struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	RequireTOTP bool     `json:"requireTotp"`
+}
+
 func (s *UserService) Register(req *RegisterRequest) (uint, error) {
-	if len(req.Username) < 3 || len(req.Username) > 20 {
-		return 0, utils.ErrInvalidUsername
-	}
-	if len(req.Password) < 6 || len(req.Password) > 20 {
-		return 0, utils.ErrInvalidPassword
-	}
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(req.Email) {
-		return 0, utils.ErrInvalidEmail
-	}
-	_, err := s.userRepository.FindByUsername(req.Username)
-	if err == nil {
-		return 0, utils.ErrExistedUsername
-	}
-	_, err = s.userRepository.FindByEmail(req.Email)
-	if err == nil {
-		return 0, utils.ErrExistedEmail
+	if err := s.checkRegistration(req); err != nil {
+		return 0, err
 	}
 	user := model.User{
 		Username: req.Username,
 		Password: req.Password,
 		Email:    req.Email,
+		Role:     model.RoleViewer,
 	}
 	if err := s.userRepository.Create(&user); err != nil {
 		return 0, err
 	}
+	if err := s.sendVerification(&user, user.Email); err != nil {
+		return 0, err
+	}
 	return user.ID, nil
 }
 
-func (s *UserService) Login(req *LoginRequest) (string, error) {
+func (s *UserService) checkRegistration(req *RegisterRequest) error {
+	if len(req.Username) < 3 || len(req.Username) > 20 {
+		return utils.ErrInvalidUsername
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+	if !emailRegex.MatchString(req.Email) {
+		return utils.ErrInvalidEmail
+	}
+	if _, err := s.userRepository.FindByUsername(req.Username); err == nil {
+		return utils.ErrExistedUsername
+	}
+	if _, err := s.userRepository.FindByEmail(req.Email); err == nil {
+		return utils.ErrExistedEmail
+	}
+	return nil
+}
+
+// CreateAdmin creates an administrator, for bootstrapping a database that has
+// none. The email is taken as verified, since the operator supplied it.
+func (s *UserService) CreateAdmin(req *RegisterRequest) (*UserResponse, error) {
+	if err := s.checkRegistration(req); err != nil {
+		return nil, err
+	}
+	user := model.User{
+		Username:      req.Username,
+		Password:      req.Password,
+		Email:         req.Email,
+		EmailVerified: true,
+		Role:          model.RoleAdmin,
+	}
+	err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.userRepository.WithTx(tx).Create(&user); err != nil {
+			return err
+		}
+		return audit.Record(nil, model.AuditActionCreate, model.AuditEntityUser, user.ID, nil, newUserResponse(&user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	response := newUserResponse(&user)
+	return &response, nil
+}
+
+// PromoteAdmin makes an existing user an administrator, for bootstrapping a
+// database that has none.
+func (s *UserService) PromoteAdmin(username string) (*UserResponse, error) {
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	return s.AssignRole(user.ID, &RoleRequest{Role: model.RoleAdmin}, nil)
+}
+
+func (s *UserService) Login(req *LoginRequest, ip, userAgent string) (*LoginResponse, error) {
+	if err := s.securityService.CheckLogin(req.Username, ip); err != nil {
+		return nil, err
+	}
 	user, err := s.userRepository.FindByUsername(req.Username)
 	if err != nil {
-		return "", utils.ErrFalseUsername
+		// Spend as long as a password check would, so response times do not
+		// reveal which usernames exist.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		return nil, s.loginFailed(req.Username, ip, 0)
 	}
 	if !user.CheckPassword(req.Password) {
-		return "", utils.ErrFalsePassword
+		return nil, s.loginFailed(req.Username, ip, user.ID)
 	}
-	token, err := middleware.GenerateToken(user)
+	if s.mailConfig.RequireVerifiedEmail && !user.EmailVerified {
+		return nil, utils.ErrEmailNotVerified
+	}
+	return s.beginLogin(user, ip, userAgent)
+}
+
+// loginFailed records a failed attempt and returns the error for it, the same
+// whether the username or the password was wrong.
+func (s *UserService) loginFailed(username, ip string, userID uint) error {
+	if err := s.securityService.RecordFailure(username, ip, userID); err != nil {
+		return err
+	}
+	return utils.ErrInvalidCredentials
+}
+
+// UnlockUser lifts a login lockout on the user.
+func (s *UserService) UnlockUser(id uint, actor *model.Actor) error {
+	user, err := s.userRepository.FindByID(id)
 	if err != nil {
-		return "", err
+		return utils.ErrUserNotExists
 	}
-	return token, nil
+	return s.securityService.UnlockUser(user, actor)
 }
 
 func (s *UserService) GetByID(id uint) (*model.User, error) {
@@ -83,3 +201,178 @@ func (s *UserService) GetByID(id uint) (*model.User, error) {
 	}
 	return user, nil
 }
+
+func (s *UserService) List(page, size int, filter *model.UserFilter) (*UserListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 20
+	}
+	if filter != nil && filter.Role != "" && !model.ValidRole(filter.Role) {
+		return nil, utils.ErrInvalidRole
+	}
+	users, total, err := s.userRepository.List(page, size, filter)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]UserResponse, len(users))
+	for i, user := range users {
+		responses[i] = newUserResponse(user)
+	}
+	return &UserListResponse{
+		Total: total,
+		Page:  page,
+		Size:  size,
+		Users: responses,
+	}, nil
+}
+
+func (s *UserService) Roles() ([]RoleResponse, error) {
+	policies, err := s.rolePolicyRepository.List()
+	if err != nil {
+		return nil, err
+	}
+	requireTOTP := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		requireTOTP[policy.Role] = policy.RequireTOTP
+	}
+	roles := make([]RoleResponse, len(model.Roles))
+	for i, role := range model.Roles {
+		roles[i] = RoleResponse{Role: role, Permissions: model.RolePermissions(role), RequireTOTP: requireTOTP[role]}
+	}
+	return roles, nil
+}
+
+// AssignRole changes a user's role. The last administrator cannot be demoted,
+// so there is always someone left who can assign roles.
+func (s *UserService) AssignRole(id uint, req *RoleRequest, actor *model.Actor) (*UserResponse, error) {
+	if !model.ValidRole(req.Role) {
+		return nil, utils.ErrInvalidRole
+	}
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	before := user.Role
+	if before == req.Role {
+		response := newUserResponse(user)
+		return &response, nil
+	}
+	if err := s.checkNotLastAdmin(user); err != nil {
+		return nil, err
+	}
+	user.Role = req.Role
+	err = s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.userRepository.WithTx(tx).Update(user); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+			map[string]string{"role": before}, map[string]string{"role": user.Role})
+	})
+	if err != nil {
+		return nil, err
+	}
+	response := newUserResponse(user)
+	return &response, nil
+}
+
+func (s *UserService) Get(id uint) (*UserResponse, error) {
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	response := newUserResponse(user)
+	return &response, nil
+}
+
+// SetDisabled disables or re-enables a user. Disabling logs them out
+// everywhere and stops them logging in until re-enabled.
+func (s *UserService) SetDisabled(id uint, disabled bool, actor *model.Actor) (*UserResponse, error) {
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return nil, utils.ErrUserNotExists
+	}
+	if user.Disabled != disabled {
+		if disabled {
+			if err := s.checkManageable(user, actor); err != nil {
+				return nil, err
+			}
+		}
+		user.Disabled = disabled
+		err := s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+			if err := s.userRepository.WithTx(tx).Update(user); err != nil {
+				return err
+			}
+			if disabled {
+				if _, err := s.sessionRepository.WithTx(tx).RevokeByUser(user.ID); err != nil {
+					return err
+				}
+			}
+			return audit.Record(actor, model.AuditActionUpdate, model.AuditEntityUser, user.ID,
+				map[string]bool{"disabled": !disabled}, map[string]bool{"disabled": disabled})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	response := newUserResponse(user)
+	return &response, nil
+}
+
+// Delete removes a user and logs them out everywhere. The row is kept, marked
+// deleted, so that audit entries and reports still resolve who made them.
+func (s *UserService) Delete(id uint, actor *model.Actor) error {
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return utils.ErrUserNotExists
+	}
+	if err := s.checkManageable(user, actor); err != nil {
+		return err
+	}
+	return s.auditService.Transaction(func(tx *gorm.DB, audit *AuditService) error {
+		if err := s.userRepository.WithTx(tx).Delete(user.ID); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepository.WithTx(tx).RevokeByUser(user.ID); err != nil {
+			return err
+		}
+		return audit.Record(actor, model.AuditActionDelete, model.AuditEntityUser, user.ID,
+			newUserResponse(user), nil)
+	})
+}
+
+// checkManageable stops administrators from disabling or deleting themselves
+// or the last administrator who can still log in.
+func (s *UserService) checkManageable(user *model.User, actor *model.Actor) error {
+	if user.ID == actor.UserID {
+		return utils.ErrManageSelf
+	}
+	return s.checkNotLastAdmin(user)
+}
+
+func (s *UserService) checkNotLastAdmin(user *model.User) error {
+	if user.Role != model.RoleAdmin || user.Disabled {
+		return nil
+	}
+	admins, err := s.userRepository.CountByRole(model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return utils.ErrLastAdmin
+	}
+	return nil
+}
+
+func newUserResponse(user *model.User) UserResponse {
+	return UserResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Disabled:      user.Disabled,
+		CreatedAt:     user.CreatedAt,
+	}
+}
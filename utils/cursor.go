@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+)
+
+// CursorScope identifies the listing a cursor belongs to: the list name and
+// its filter, including the sort order. A cursor only resumes the listing it
+// was issued for.
+func CursorScope(list string, filter interface{}) string {
+	data, _ := json.Marshal(filter)
+	sum := sha256.Sum256(append([]byte(list+":"), data...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncodeCursor turns a page cursor into an opaque token for clients, bound to
+// the scope returned by CursorScope.
+func EncodeCursor(cursor model.PageCursor, scope string) string {
+	raw := strconv.FormatInt(cursor.Time.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(cursor.ID), 10) + ":" + scope
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reads a token produced by EncodeCursor with the same scope. An
+// empty token means the first page and decodes to nil.
+func DecodeCursor(token, scope string) (*model.PageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCursor
+	}
+	if parts[2] != scope {
+		return nil, fmt.Errorf("%w: it was issued for a different filter or sort order", ErrInvalidCursor)
+	}
+	unixNano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parsedID, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &model.PageCursor{Time: time.Unix(0, unixNano), ID: uint(parsedID)}, nil
+}
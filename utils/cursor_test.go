@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mitsui515/finsys/model"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	scope := CursorScope("transactions", map[string]string{"sort": "created_at"})
+	tests := []model.PageCursor{
+		{Time: time.Date(2024, 1, 2, 3, 4, 5, 678901234, time.UTC), ID: 42},
+		{Time: time.Unix(0, 0), ID: 1},
+		{Time: time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC), ID: 4294967295},
+	}
+	for _, cursor := range tests {
+		decoded, err := DecodeCursor(EncodeCursor(cursor, scope), scope)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%v): %v", cursor, err)
+		}
+		if !decoded.Time.Equal(cursor.Time) || decoded.ID != cursor.ID {
+			t.Errorf("cursor %v decoded as %v", cursor, *decoded)
+		}
+	}
+}
+
+func TestDecodeCursorFirstPage(t *testing.T) {
+	cursor, err := DecodeCursor("", "scope")
+	if cursor != nil || err != nil {
+		t.Errorf("DecodeCursor of an empty token returned %v, %v", cursor, err)
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	scope := CursorScope("transactions", nil)
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "***"},
+		{"too few parts", encode("1:2")},
+		{"too many parts", encode("1:2:" + scope + ":x")},
+		{"other scope", EncodeCursor(model.PageCursor{Time: time.Unix(1, 0), ID: 2}, CursorScope("fraud_reports", nil))},
+		{"bad time", encode("x:2:" + scope)},
+		{"bad ID", encode("1:x:" + scope)},
+		{"negative ID", encode("1:-2:" + scope)},
+		{"ID out of range", encode("1:4294967296:" + scope)},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeCursor(tt.token, scope); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: DecodeCursor returned %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+func TestCursorScope(t *testing.T) {
+	type filter struct {
+		Sort  string
+		Limit int
+	}
+	base := CursorScope("transactions", filter{Sort: "amount"})
+	if again := CursorScope("transactions", filter{Sort: "amount"}); again != base {
+		t.Errorf("the same listing has scopes %s and %s", base, again)
+	}
+	for name, scope := range map[string]string{
+		"list":   CursorScope("fraud_reports", filter{Sort: "amount"}),
+		"sort":   CursorScope("transactions", filter{Sort: "created_at"}),
+		"filter": CursorScope("transactions", filter{Sort: "amount", Limit: 1}),
+	} {
+		if scope == base {
+			t.Errorf("a different %s has the same scope", name)
+		}
+	}
+}
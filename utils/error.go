@@ -3,19 +3,69 @@ package utils
 import "errors"
 
 var (
-	ErrMissingType          = errors.New("transaction type is required")
-	ErrInvalidAmount        = errors.New("transaction amount must be larger than 0")
-	ErrInvalidOrig          = errors.New("")
-	ErrInvalidDest          = errors.New("")
-	ErrTransactionNotExists = errors.New("transaction does not exist")
-	ErrInvalidUsername      = errors.New("username length must be between 3 and 20")
-	ErrInvalidPassword      = errors.New("password length must be between 6 and 20")
-	ErrInvalidEmail         = errors.New("invalid email")
-	ErrExistedUsername      = errors.New("username has been existed")
-	ErrExistedEmail         = errors.New("email has been existed")
-	ErrFalseUsername        = errors.New("username error")
-	ErrFalsePassword        = errors.New("password error")
-	ErrFraudReportNotExists = errors.New("fraud report does not exist")
-	ErrInvalidReport        = errors.New("report content is required")
-	ErrInvalidTransactionID = errors.New("transaction ID is required")
+	ErrMissingType             = errors.New("transaction type is required")
+	ErrInvalidAmount           = errors.New("transaction amount must be larger than 0")
+	ErrInvalidOrig             = errors.New("")
+	ErrInvalidDest             = errors.New("")
+	ErrTransactionNotExists    = errors.New("transaction does not exist")
+	ErrInvalidUsername         = errors.New("username length must be between 3 and 20")
+	ErrInvalidPassword         = errors.New("password length must be between 6 and 20")
+	ErrInvalidEmail            = errors.New("invalid email")
+	ErrExistedUsername         = errors.New("username has been existed")
+	ErrExistedEmail            = errors.New("email has been existed")
+	ErrInvalidCredentials      = errors.New("invalid username or password")
+	ErrFraudReportNotExists    = errors.New("fraud report does not exist")
+	ErrReportVersionNotExists  = errors.New("fraud report version does not exist")
+	ErrInvalidReport           = errors.New("report content is required")
+	ErrInvalidTransactionID    = errors.New("transaction ID is required")
+	ErrImportJobNotExists      = errors.New("import job does not exist")
+	ErrImportJobNotResume      = errors.New("only failed or cancelled import jobs with a spooled file can be resumed")
+	ErrImportJobNotActive      = errors.New("import job is not queued or running")
+	ErrImportTooLarge          = errors.New("upload exceeds the import size limit")
+	ErrUnsupportedImportFormat = errors.New("unsupported import format, expected csv, jsonl, parquet or xlsx")
+	ErrInvalidImportMapping    = errors.New("invalid column mapping")
+	ErrImportProfileNotExists  = errors.New("import profile does not exist")
+	ErrExistedImportProfile    = errors.New("import profile name has been existed")
+	ErrInvalidImportProfile    = errors.New("import profile name is required")
+	ErrInvalidSeparator        = errors.New("decimal and thousands separators must be single characters and differ")
+	ErrInvalidTimezone         = errors.New("invalid timezone")
+	ErrInvalidTransactionQuery = errors.New("invalid transaction query")
+	ErrInvalidSortField        = errors.New("invalid sort field")
+	ErrAuditLogNotExists       = errors.New("audit log entry does not exist")
+	ErrInvalidCursor           = errors.New("invalid pagination cursor")
+	ErrInvalidAnalyticsBucket  = errors.New("bucket must be hour, day or week")
+	ErrInvalidHistogramBins    = errors.New("bins must be between 1 and 100")
+	ErrInvalidAccountSide      = errors.New("side must be orig or dest")
+	ErrCursorSortField         = errors.New("cursor pagination only supports sorting by createdAt")
+	ErrUserNotExists           = errors.New("user does not exist")
+	ErrInvalidRole             = errors.New("role must be viewer, analyst, supervisor or admin")
+	ErrLastAdmin               = errors.New("the last administrator cannot be demoted, disabled or deleted")
+	ErrTokenRevoked            = errors.New("token has been revoked")
+	ErrInvalidRefreshToken     = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused      = errors.New("refresh token has already been used, the session has been revoked")
+	ErrOIDCDisabled            = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState        = errors.New("single sign-on login is invalid or has expired, start again")
+	ErrIdentityNotLinked       = errors.New("no account is linked to this identity")
+	ErrOIDCEmailRequired       = errors.New("identity provider did not supply a verified email")
+	ErrOIDCEmailNotVerified    = errors.New("an account with this email exists; it can only be linked once both the identity provider and finsys have verified the email")
+	ErrTOTPNotEnrolled         = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTOTPRequired            = errors.New("two-factor authentication is required for this role")
+	ErrInvalidTOTPCode         = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge     = errors.New("two-factor challenge is invalid or has expired, log in again")
+	ErrLoginThrottled          = errors.New("too many failed login attempts, try again later")
+	ErrUserDisabled            = errors.New("user is disabled")
+	ErrEmailNotVerified        = errors.New("email address has not been verified")
+	ErrInvalidUserToken        = errors.New("link is invalid or has expired")
+	ErrWrongPassword           = errors.New("current password is incorrect")
+	ErrManageSelf              = errors.New("administrators cannot disable or delete their own account")
+	ErrAPIKeyNotExists         = errors.New("API key does not exist")
+	ErrInvalidAPIKey           = errors.New("invalid, expired or revoked API key")
+	ErrInvalidAPIKeyName       = errors.New("API key name must be between 1 and 100 characters")
+	ErrInvalidAPIKeyScope      = errors.New("API key scopes must be data permissions, not account or user management")
+	ErrAPIKeyScopeNotGranted   = errors.New("the user's role does not grant every requested scope")
+	ErrInvalidExpiry           = errors.New("expires_at must be in the future")
+	ErrInvalidUsageGroup       = errors.New("group_by must be user, model or day")
+	ErrInvalidLLMBudget        = errors.New("token budgets must not be negative")
+	ErrLLMBudgetExceeded       = errors.New("LLM token budget exceeded")
 )
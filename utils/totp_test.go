@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC lists eight-digit codes; these are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+	if _, err := TOTPCode("not base32!", time.Unix(59, 0)); err == nil {
+		t.Error("TOTPCode accepted a secret that is not base32")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	code := func(offset int64) string {
+		code, err := totpCodeAt(rfc6238Secret, step+offset)
+		if err != nil {
+			t.Fatalf("totpCodeAt: %v", err)
+		}
+		return code
+	}
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", code(0), 0, step, true},
+		{"surrounding spaces", " " + code(0) + "\n", 0, step, true},
+		{"previous period", code(-1), 0, step - 1, true},
+		{"next period", code(1), 0, step + 1, true},
+		{"two periods old", code(-2), 0, 0, false},
+		{"two periods ahead", code(2), 0, 0, false},
+		{"replayed", code(0), step, 0, false},
+		{"later than last use", code(1), step, step + 1, true},
+		{"too short", code(0)[:5], 0, 0, false},
+		{"too long", code(0) + "0", 0, 0, false},
+		{"empty", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		gotStep, ok := ValidateTOTP(rfc6238Secret, tt.code, now, tt.lastStep)
+		if ok != tt.wantOK || gotStep != tt.wantStep {
+			t.Errorf("%s: ValidateTOTP returned %d, %v, want %d, %v", tt.name, gotStep, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", code(0), now, 0); ok {
+		t.Error("ValidateTOTP accepted a code for a secret that is not base32")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret holds %d bytes, want 20", len(key))
+	}
+	if GenerateTOTPSecret() == secret {
+		t.Error("two secrets are the same")
+	}
+	if _, err := TOTPCode(secret, time.Now()); err != nil {
+		t.Errorf("TOTPCode with a generated secret: %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("FinSys", "alice@example.com", "ABC"))
+	if err != nil {
+		t.Fatalf("TOTPURI is not a URL: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/FinSys:alice@example.com" {
+		t.Errorf("TOTPURI is %s", uri)
+	}
+	query := uri.Query()
+	for key, want := range map[string]string{"secret": "ABC", "issuer": "FinSys", "digits": "6", "period": "30", "algorithm": "SHA1"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("TOTPURI has %s=%q, want %q", key, got, want)
+		}
+	}
+}